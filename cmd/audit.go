@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const (
+	noEvents     = "none"
+	objectEvents = "object"
+	runEvents    = "run"
+)
+
+// Actions of the downtimes created and cancelled by update --mute-during and unmute
+const (
+	mutedAction   = "muted"
+	unmutedAction = "unmuted"
+)
+
+type auditOptions struct {
+	logFilePath   string
+	operator      string
+	migrationName string
+	events        string
+}
+
+func addAuditFlags(cmd *cobra.Command, opts *auditOptions) {
+	cmd.Flags().StringVar(&opts.logFilePath, "audit-log", "audit.jsonl", "Path to the JSONL audit log recording every mutation")
+	cmd.Flags().StringVar(&opts.operator, "operator", "", "Name of the operator recorded in the audit log (default: current user)")
+	cmd.Flags().StringVar(&opts.migrationName, "migration", "", "Name of the migration recorded in the audit log and events")
+	cmd.Flags().StringVar(&opts.events, "post-events", noEvents, "Post Datadog events for mutations: none, object or run")
+}
+
+func (opts auditOptions) validate() error {
+	switch opts.events {
+	case noEvents, objectEvents, runEvents:
+		return nil
+	default:
+		return fmt.Errorf("unknown events mode: %s", opts.events)
+	}
+}
+
+func currentOperator() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// auditRecord is one line of the audit log, describing a mutation of a Datadog object.
+type auditRecord struct {
+	Time           time.Time            `json:"time"`
+	Operator       string               `json:"operator"`
+	Migration      string               `json:"migration,omitempty"`
+	Action         string               `json:"action"`
+	OrgID          int                  `json:"org_id"`
+	Ref            migrate.ObjectRef    `json:"ref"`
+	NewRef         *migrate.ObjectRef   `json:"new_ref,omitempty"`
+	Patcher        string               `json:"patcher,omitempty"`
+	PatcherVersion string               `json:"patcher_version,omitempty"`
+	Patchers       []migrate.PatcherRef `json:"patchers,omitempty"`
+	BeforeHash     string               `json:"before_hash,omitempty"`
+	AfterHash      string               `json:"after_hash,omitempty"`
+	DowntimeID     int64                `json:"downtime_id,omitempty"`
+	DowntimeEnd    *time.Time           `json:"downtime_end,omitempty"`
+}
+
+// auditor appends mutations to the audit log and optionally posts them as Datadog events.
+type auditor struct {
+	opts      auditOptions
+	cfg       config.Config
+	file      *os.File
+	eventsAPI *datadogV1.EventsApi
+	runCounts map[int]map[string]int
+}
+
+func newAuditor(cfg config.Config, opts auditOptions) (*auditor, error) {
+	if opts.operator == "" {
+		opts.operator = currentOperator()
+	}
+
+	file, err := os.OpenFile(opts.logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", opts.logFilePath, err)
+	}
+
+	return &auditor{
+		opts:      opts,
+		cfg:       cfg,
+		file:      file,
+		eventsAPI: datadogV1.NewEventsApi(client.Datadog()),
+		runCounts: map[int]map[string]int{},
+	}, nil
+}
+
+// newAuditRecord fills the operator and migration of a record for the given mutation.
+func (a *auditor) newAuditRecord(action string, ref migrate.ObjectRef) auditRecord {
+	return auditRecord{
+		Time:      time.Now().UTC(),
+		Operator:  a.opts.operator,
+		Migration: a.opts.migrationName,
+		Action:    action,
+		OrgID:     ref.OrgID,
+		Ref:       ref,
+	}
+}
+
+// auditChange records a change of an object made in Datadog, with the state of the object before it, nil if it
+// was not tracked.
+func (a *auditor) auditChange(ctx context.Context, action string, ref migrate.ObjectRef, newRef *migrate.ObjectRef, content []byte, before *migrate.ObjectState) error {
+	rec := a.newAuditRecord(action, ref)
+	rec.NewRef = newRef
+	rec.BeforeHash = before.LastPushedHash()
+	rec.AfterHash = migrate.ContentHash(content)
+	if before != nil {
+		rec.Patcher, rec.PatcherVersion = before.Patcher, before.PatcherVersion
+		rec.Patchers = before.Patchers
+	}
+
+	return a.record(ctx, rec)
+}
+
+// auditDowntime records a downtime of a monitor created or cancelled in Datadog.
+func (a *auditor) auditDowntime(ctx context.Context, action string, downtime migrate.DowntimeRecord) error {
+	rec := a.newAuditRecord(action, migrate.ObjectRef{OrgID: downtime.OrgID, Type: migrate.MonitorType, ID: downtime.MonitorID})
+	rec.DowntimeID = downtime.DowntimeID
+	rec.DowntimeEnd = &downtime.End
+
+	return a.record(ctx, rec)
+}
+
+func (a *auditor) record(ctx context.Context, rec auditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record for %s: %w", rec.Ref, err)
+	}
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record for %s: %w", rec.Ref, err)
+	}
+
+	if a.runCounts[rec.OrgID] == nil {
+		a.runCounts[rec.OrgID] = map[string]int{}
+	}
+	a.runCounts[rec.OrgID][rec.Ref.Type+" "+rec.Action]++
+
+	if a.opts.events == objectEvents {
+		title := fmt.Sprintf("%s %s %s by migrate-tool", rec.Ref.Type, rec.Ref.ID, rec.Action)
+		text := fmt.Sprintf("Operator: %s\nPatcher: %s\nBefore: %s\nAfter: %s",
+			rec.Operator, describePatchers(rec.Patcher, rec.PatcherVersion, rec.Patchers), rec.BeforeHash, rec.AfterHash)
+		if rec.NewRef != nil {
+			text += fmt.Sprintf("\nNew ID: %s", rec.NewRef.ID)
+		}
+		if rec.DowntimeEnd != nil {
+			text = fmt.Sprintf("Operator: %s\nDowntime: %d\nEnd: %s", rec.Operator, rec.DowntimeID, rec.DowntimeEnd.Format(time.RFC3339))
+		}
+
+		tags := append(a.eventTags(), rec.Ref.Type+"_id:"+rec.Ref.ID)
+		if err := a.postEvent(ctx, rec.OrgID, title, text, tags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close posts the run summary events if requested and closes the audit log.
+func (a *auditor) Close(ctx context.Context) error {
+	var postErr error
+
+	if a.opts.events == runEvents {
+		for orgID, counts := range a.runCounts {
+			lines := make([]string, 0, len(counts))
+			for mutation, count := range counts {
+				lines = append(lines, fmt.Sprintf("%s: %d", mutation, count))
+			}
+			sort.Strings(lines)
+
+			title := "migrate-tool run"
+			if a.opts.migrationName != "" {
+				title = fmt.Sprintf("migrate-tool run for migration %s", a.opts.migrationName)
+			}
+			text := fmt.Sprintf("Operator: %s\n%s", a.opts.operator, strings.Join(lines, "\n"))
+
+			if err := a.postEvent(ctx, orgID, title, text, a.eventTags()); err != nil && postErr == nil {
+				postErr = err
+			}
+		}
+	}
+
+	if err := a.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log %s: %w", a.opts.logFilePath, err)
+	}
+
+	return postErr
+}
+
+func (a *auditor) eventTags() []string {
+	tags := []string{"source:migrate-tool"}
+	if a.opts.migrationName != "" {
+		tags = append(tags, "migration:"+a.opts.migrationName)
+	}
+	if a.opts.operator != "" {
+		tags = append(tags, "operator:"+a.opts.operator)
+	}
+	return tags
+}
+
+func (a *auditor) postEvent(ctx context.Context, orgID int, title, text string, tags []string) error {
+	credCtx, err := client.DatadogCredentials(ctx, a.cfg, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+
+	_, _, err = a.eventsAPI.CreateEvent(credCtx, datadogV1.EventCreateRequest{
+		Title:     title,
+		Text:      text,
+		Tags:      tags,
+		AlertType: datadogV1.EVENTALERTTYPE_INFO.Ptr(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to post event in org %d: %w", orgID, err)
+	}
+
+	return nil
+}
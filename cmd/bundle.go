@@ -0,0 +1,524 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const (
+	bundleMetadataName = "bundle.json"
+	bundleObjectsDir   = "objects"
+	bundleReportsDir   = "reports"
+	bundleFormat       = 1
+	defaultSite        = "datadoghq.com"
+)
+
+func newBundleCommand(config *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Pack objects in a single archive, or unpack it",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(newBundleCreateCommand(config))
+	cmd.AddCommand(newBundleExtractCommand(config))
+
+	return cmd
+}
+
+func newBundleCreateCommand(_ *config.Config) *cobra.Command {
+	var inputDirectory, bundlePath string
+	var reportPaths []string
+	var sites map[string]string
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Pack objects in input directory, their state manifest and run reports in a tar.gz bundle",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return createBundle(inputDirectory, bundlePath, reportPaths, sites)
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().StringVarP(&bundlePath, "output", "o", "bundle.tar.gz", "Path of the bundle")
+	cmd.Flags().StringSliceVar(&reportPaths, "reports", nil, "Run reports to add to the bundle")
+	cmd.Flags().StringToStringVar(&sites, "site", nil, "Datadog site of an org, e.g. 3000=datadoghq.eu, orgs without site use "+defaultSite)
+
+	return cmd
+}
+
+func newBundleExtractCommand(_ *config.Config) *cobra.Command {
+	var bundlePath, outputDirectory string
+
+	cmd := &cobra.Command{
+		Use:   "extract",
+		Short: "Verify the checksums of a bundle and unpack it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if bundlePath == "" {
+				cmd.Usage()
+				return fmt.Errorf("missing bundle")
+			}
+
+			metadata, err := extractBundle(bundlePath, filepath.Join(outputDirectory, bundleObjectsDir), outputDirectory)
+			if err != nil {
+				return err
+			}
+			metadata.print(bundlePath)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&bundlePath, "file", "f", "", "Path of the bundle")
+	cmd.Flags().StringVarP(&outputDirectory, "output", "o", ".", "Output folder, objects are extracted in its objects folder")
+
+	return cmd
+}
+
+// bundleMetadata describes the content of a bundle. It is stored at the root of the archive.
+type bundleMetadata struct {
+	Format      int                    `json:"format"`
+	ToolVersion string                 `json:"tool_version"`
+	CreatedAt   time.Time              `json:"created_at"`
+	CreatedBy   string                 `json:"created_by,omitempty"`
+	Orgs        map[string]bundleOrg   `json:"orgs"`
+	Patchers    []bundlePatcher        `json:"patchers,omitempty"`
+	Timestamps  bundleStateTimestamps  `json:"timestamps"`
+	Files       map[string]bundleEntry `json:"files"`
+}
+
+type bundleOrg struct {
+	Site    string `json:"site"`
+	Objects int    `json:"objects"`
+}
+
+type bundlePatcher struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Objects int    `json:"objects"`
+}
+
+// bundleStateTimestamps summarises the state manifest of the bundled objects.
+type bundleStateTimestamps struct {
+	FirstDumpedAt *time.Time `json:"first_dumped_at,omitempty"`
+	LastDumpedAt  *time.Time `json:"last_dumped_at,omitempty"`
+	LastPatchedAt *time.Time `json:"last_patched_at,omitempty"`
+	LastUpdatedAt *time.Time `json:"last_updated_at,omitempty"`
+}
+
+type bundleEntry struct {
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// toolVersion returns the version of the tool from the build information.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			version += " (" + setting.Value + ")"
+		}
+	}
+	return version
+}
+
+func createBundle(inputDirectory, bundlePath string, reportPaths []string, sites map[string]string) error {
+	manifest, err := migrate.LoadManifest(inputDirectory)
+	if err != nil {
+		return err
+	}
+
+	metadata := newBundleMetadata(manifest, sites)
+	files := map[string][]byte{}
+
+	failures, err := migrate.NewStore(inputDirectory).Walk(func(filePath string, ref migrate.ObjectRef) {
+		orgID := strconv.Itoa(ref.OrgID)
+		org := metadata.Orgs[orgID]
+		org.Objects++
+		if org.Site == "" {
+			org.Site = defaultSite
+		}
+		metadata.Orgs[orgID] = org
+
+		rel, _ := filepath.Rel(inputDirectory, filePath)
+		files[path.Join(bundleObjectsDir, filepath.ToSlash(rel))] = nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to list objects in %s, err: %w", inputDirectory, errors.Join(failures...))
+	}
+
+	if _, err := os.Stat(migrate.ManifestPath(inputDirectory)); err == nil {
+		files[path.Join(bundleObjectsDir, migrate.StateFileName)] = nil
+	}
+
+	for name := range files {
+		content, err := os.ReadFile(filepath.Join(inputDirectory, filepath.FromSlash(strings.TrimPrefix(name, bundleObjectsDir+"/"))))
+		if err != nil {
+			return fmt.Errorf("failed to read file at %s, err: %w", name, err)
+		}
+		files[name] = content
+	}
+	for _, reportPath := range reportPaths {
+		content, err := os.ReadFile(reportPath)
+		if err != nil {
+			return fmt.Errorf("failed to read report at %s, err: %w", reportPath, err)
+		}
+		name := path.Join(bundleReportsDir, filepath.Base(reportPath))
+		if _, found := files[name]; found {
+			return fmt.Errorf("failed to add report %s: another report is named %s", reportPath, filepath.Base(reportPath))
+		}
+		files[name] = content
+	}
+
+	for name, content := range files {
+		metadata.Files[name] = bundleEntry{Size: len(content), SHA256: migrate.ContentHash(content)}
+	}
+
+	metadataContent, err := json.MarshalIndent(metadata, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle metadata, err: %w", err)
+	}
+
+	if err := writeBundle(bundlePath, metadataContent, files); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nFinished bundling %s\n", inputDirectory)
+	fmt.Printf("Bundle: %s\n", bundlePath)
+	fmt.Printf("Files: %d\n", len(files))
+	fmt.Println()
+	return nil
+}
+
+func newBundleMetadata(manifest *migrate.Manifest, sites map[string]string) *bundleMetadata {
+	metadata := &bundleMetadata{
+		Format:      bundleFormat,
+		ToolVersion: toolVersion(),
+		CreatedAt:   time.Now().UTC(),
+		CreatedBy:   currentOperator(),
+		Orgs:        map[string]bundleOrg{},
+		Files:       map[string]bundleEntry{},
+	}
+	for orgID, site := range sites {
+		metadata.Orgs[orgID] = bundleOrg{Site: site}
+	}
+
+	patchers := map[bundlePatcher]int{}
+	for _, state := range manifest.Objects {
+		if state.Patcher != "" {
+			patchers[bundlePatcher{Name: state.Patcher, Version: state.PatcherVersion}]++
+		}
+
+		ts := &metadata.Timestamps
+		if state.DumpedAt != nil && (ts.FirstDumpedAt == nil || state.DumpedAt.Before(*ts.FirstDumpedAt)) {
+			ts.FirstDumpedAt = state.DumpedAt
+		}
+		if state.DumpedAt != nil && (ts.LastDumpedAt == nil || state.DumpedAt.After(*ts.LastDumpedAt)) {
+			ts.LastDumpedAt = state.DumpedAt
+		}
+		if state.PatchedAt != nil && (ts.LastPatchedAt == nil || state.PatchedAt.After(*ts.LastPatchedAt)) {
+			ts.LastPatchedAt = state.PatchedAt
+		}
+		if state.UpdatedAt != nil && (ts.LastUpdatedAt == nil || state.UpdatedAt.After(*ts.LastUpdatedAt)) {
+			ts.LastUpdatedAt = state.UpdatedAt
+		}
+	}
+
+	for patcher, count := range patchers {
+		patcher.Objects = count
+		metadata.Patchers = append(metadata.Patchers, patcher)
+	}
+	sort.Slice(metadata.Patchers, func(i, j int) bool {
+		if metadata.Patchers[i].Name != metadata.Patchers[j].Name {
+			return metadata.Patchers[i].Name < metadata.Patchers[j].Name
+		}
+		return metadata.Patchers[i].Version < metadata.Patchers[j].Version
+	})
+
+	return metadata
+}
+
+// writeBundle writes the archive, with the metadata first and files sorted by name.
+func writeBundle(bundlePath string, metadata []byte, files map[string][]byte) (err error) {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle at %s, err: %w", bundlePath, err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("failed to write bundle at %s, err: %w", bundlePath, closeErr)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	write := func(name string, content []byte) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0o660,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+
+	if err := write(bundleMetadataName, metadata); err != nil {
+		return fmt.Errorf("failed to write bundle at %s, err: %w", bundlePath, err)
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return fmt.Errorf("failed to write bundle at %s, err: %w", bundlePath, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle at %s, err: %w", bundlePath, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle at %s, err: %w", bundlePath, err)
+	}
+	return nil
+}
+
+// readBundle reads the archive and verifies the files against the checksums of the metadata.
+// The files returned include the metadata file.
+func readBundle(bundlePath string) (*bundleMetadata, map[string][]byte, error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open bundle at %s, err: %w", bundlePath, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bundle at %s, err: %w", bundlePath, err)
+	}
+	tr := tar.NewReader(gz)
+
+	files := map[string][]byte{}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read bundle at %s, err: %w", bundlePath, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("invalid bundle %s: unexpected entry %s", bundlePath, header.Name)
+		}
+
+		name := path.Clean(header.Name)
+		if !fs.ValidPath(name) {
+			return nil, nil, fmt.Errorf("invalid bundle %s: unsafe path %s", bundlePath, header.Name)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s in bundle %s, err: %w", name, bundlePath, err)
+		}
+		files[name] = content
+	}
+
+	metadataContent, found := files[bundleMetadataName]
+	if !found {
+		return nil, nil, fmt.Errorf("invalid bundle %s: missing %s", bundlePath, bundleMetadataName)
+	}
+
+	metadata := &bundleMetadata{}
+	if err := json.Unmarshal(metadataContent, metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal metadata of bundle %s, err: %w", bundlePath, err)
+	}
+	if metadata.Format != bundleFormat {
+		return nil, nil, fmt.Errorf("unsupported bundle format %d in %s", metadata.Format, bundlePath)
+	}
+
+	var mismatches []error
+	for name, entry := range metadata.Files {
+		content, found := files[name]
+		switch {
+		case !found:
+			mismatches = append(mismatches, fmt.Errorf("missing file %s", name))
+		case migrate.ContentHash(content) != entry.SHA256:
+			mismatches = append(mismatches, fmt.Errorf("checksum mismatch for %s", name))
+		}
+	}
+	for name := range files {
+		if _, found := metadata.Files[name]; !found && name != bundleMetadataName {
+			mismatches = append(mismatches, fmt.Errorf("unexpected file %s", name))
+		}
+	}
+	if len(mismatches) > 0 {
+		return nil, nil, fmt.Errorf("failed to verify bundle %s, err: %w", bundlePath, errors.Join(mismatches...))
+	}
+
+	return metadata, files, nil
+}
+
+// extractBundle verifies the bundle and writes its objects to objectsDirectory, and the metadata
+// and reports to outputDirectory. A non-empty objects folder must hold the objects of the bundle, as
+// extracted by an earlier run: it is then kept as is, with its state manifest.
+func extractBundle(bundlePath, objectsDirectory, outputDirectory string) (*bundleMetadata, error) {
+	metadata, files, err := readBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	extracted, err := verifyExtractedObjects(files, objectsDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract bundle %s into %s, err: %w", bundlePath, objectsDirectory, err)
+	}
+
+	// The metadata and reports are written next to existing files, which must not be overwritten
+	targets := make(map[string]string, len(files))
+	for name, content := range files {
+		if rel, found := strings.CutPrefix(name, bundleObjectsDir+"/"); found {
+			if !extracted {
+				targets[name] = filepath.Join(objectsDirectory, filepath.FromSlash(rel))
+			}
+			continue
+		}
+
+		target := filepath.Join(outputDirectory, filepath.FromSlash(name))
+		existing, err := os.ReadFile(target)
+		if err == nil {
+			if bytes.Equal(existing, content) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to extract bundle %s: file %s already exists", bundlePath, target)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to check file %s, err: %w", target, err)
+		}
+		targets[name] = target
+	}
+
+	for name, target := range targets {
+		if err := os.MkdirAll(filepath.Dir(target), 0o770); err != nil {
+			return nil, fmt.Errorf("failed to create folder %s: %w", filepath.Dir(target), err)
+		}
+		if err := os.WriteFile(target, files[name], 0o660); err != nil {
+			return nil, fmt.Errorf("failed to write %s, err: %w", target, err)
+		}
+	}
+
+	return metadata, nil
+}
+
+// verifyExtractedObjects reports whether the objects of the bundle are already in objectsDirectory.
+// It fails if the folder is not empty but holds other objects, or objects with other content.
+func verifyExtractedObjects(files map[string][]byte, objectsDirectory string) (bool, error) {
+	if entries, err := os.ReadDir(objectsDirectory); err != nil || len(entries) == 0 {
+		return false, nil
+	}
+
+	var mismatches []error
+	found := map[string]bool{}
+	failures, err := migrate.NewStore(objectsDirectory).Walk(func(filePath string, _ migrate.ObjectRef) {
+		rel, _ := filepath.Rel(objectsDirectory, filePath)
+		name := path.Join(bundleObjectsDir, filepath.ToSlash(rel))
+		found[name] = true
+
+		expected, bundled := files[name]
+		if !bundled {
+			mismatches = append(mismatches, fmt.Errorf("unexpected file %s", filePath))
+			return
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Errorf("failed to read file at %s, err: %w", filePath, err))
+		} else if !bytes.Equal(content, expected) {
+			mismatches = append(mismatches, fmt.Errorf("checksum mismatch for %s", filePath))
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	mismatches = append(mismatches, failures...)
+
+	// The state manifest is not compared, it records the progress of the runs since the extraction
+	for name := range files {
+		if strings.HasPrefix(name, bundleObjectsDir+"/") && name != path.Join(bundleObjectsDir, migrate.StateFileName) && !found[name] {
+			mismatches = append(mismatches, fmt.Errorf("missing file %s", name))
+		}
+	}
+	if len(mismatches) > 0 {
+		return false, fmt.Errorf("the folder is not empty and does not hold the objects of the bundle, err: %w", errors.Join(mismatches...))
+	}
+	return true, nil
+}
+
+func (metadata *bundleMetadata) print(bundlePath string) {
+	orgIDs := make([]string, 0, len(metadata.Orgs))
+	for orgID := range metadata.Orgs {
+		orgIDs = append(orgIDs, orgID)
+	}
+	sort.Strings(orgIDs)
+
+	fmt.Printf("\nVerified and extracted %s\n", bundlePath)
+	fmt.Printf("Created at %s by %s with %s\n", metadata.CreatedAt.Format(time.RFC3339), metadata.CreatedBy, metadata.ToolVersion)
+	for _, orgID := range orgIDs {
+		org := metadata.Orgs[orgID]
+		fmt.Printf("Org %s (%s): %d objects\n", orgID, org.Site, org.Objects)
+	}
+	for _, patcher := range metadata.Patchers {
+		fmt.Printf("Patched with %s %s: %d objects\n", patcher.Name, patcher.Version, patcher.Objects)
+	}
+	fmt.Println()
+}
+
+// useBundle extracts the bundle given to patch or update into the input folder, once verified.
+// The metadata and reports are extracted next to the input folder.
+func useBundle(bundlePath, inputDirectory string) error {
+	if bundlePath == "" {
+		return nil
+	}
+
+	metadata, err := extractBundle(bundlePath, inputDirectory, filepath.Dir(filepath.Clean(inputDirectory)))
+	if err != nil {
+		return err
+	}
+	metadata.print(bundlePath)
+	return nil
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// writeFiles writes the files, by path relative to the directory.
+func writeFiles(t *testing.T, directory string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		target := filepath.Join(directory, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o770); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0o660); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles returns the content of the files of the directory, by path relative to it.
+func readFiles(t *testing.T, directory string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(directory, func(filePath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(directory, filePath)
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// newTestBundle bundles the objects and a report, and returns the path of the bundle.
+func newTestBundle(t *testing.T, objects map[string]string) string {
+	t.Helper()
+	directory := t.TempDir()
+	writeFiles(t, filepath.Join(directory, "objects"), objects)
+	writeFiles(t, directory, map[string]string{"patch-report.json": `{"objects":[]}`})
+
+	bundlePath := filepath.Join(directory, "bundle.tar.gz")
+	reportPaths := []string{filepath.Join(directory, "patch-report.json")}
+	if err := createBundle(filepath.Join(directory, "objects"), bundlePath, reportPaths, map[string]string{"3000": "datadoghq.eu"}); err != nil {
+		t.Fatal(err)
+	}
+	return bundlePath
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	objects := map[string]string{
+		migrate.StateFileName:     `{"objects":{}}`,
+		"3000/monitor-1.json":     `{"id": 1, "name": "a"}`,
+		"3000/dashboard-abc.yaml": "id: abc\ntitle: b\n",
+		"4000/monitor-2.json":     `{"id": 2, "name": "c"}`,
+	}
+	bundlePath := newTestBundle(t, objects)
+
+	output := t.TempDir()
+	metadata, err := extractBundle(bundlePath, filepath.Join(output, "objects"), output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrgs := map[string]bundleOrg{"3000": {Site: "datadoghq.eu", Objects: 2}, "4000": {Site: defaultSite, Objects: 1}}
+	if !reflect.DeepEqual(metadata.Orgs, wantOrgs) {
+		t.Errorf("got orgs %v, want %v", metadata.Orgs, wantOrgs)
+	}
+	if len(metadata.Files) != 5 {
+		t.Errorf("got files %v", metadata.Files)
+	}
+
+	got := readFiles(t, output)
+	if _, found := got[bundleMetadataName]; !found {
+		t.Errorf("missing %s", bundleMetadataName)
+	}
+	delete(got, bundleMetadataName)
+	want := map[string]string{"reports/patch-report.json": `{"objects":[]}`}
+	for name, content := range objects {
+		want["objects/"+name] = content
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBundleExtractExisting(t *testing.T) {
+	objects := map[string]string{
+		migrate.StateFileName: `{"objects":{}}`,
+		"3000/monitor-1.json": `{"id": 1, "name": "a"}`,
+	}
+	bundlePath := newTestBundle(t, objects)
+
+	tests := []struct {
+		name    string
+		change  map[string]string
+		wantErr string
+	}{
+		{
+			name: "already extracted, with a state updated since",
+			// The state manifest records the progress of an interrupted update
+			change: map[string]string{"objects/" + migrate.StateFileName: `{"objects":{"3000/monitor/1":{}}}`},
+		},
+		{
+			name:    "changed object",
+			change:  map[string]string{"objects/3000/monitor-1.json": `{"id": 1, "name": "b"}`},
+			wantErr: "checksum mismatch for",
+		},
+		{
+			name:    "other object",
+			change:  map[string]string{"objects/3000/monitor-2.json": `{"id": 2}`},
+			wantErr: "unexpected file",
+		},
+		{
+			name:    "changed report",
+			change:  map[string]string{"reports/patch-report.json": `{}`},
+			wantErr: "already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := t.TempDir()
+			if _, err := extractBundle(bundlePath, filepath.Join(output, "objects"), output); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, output, tt.change)
+			want := readFiles(t, output)
+
+			_, err := extractBundle(bundlePath, filepath.Join(output, "objects"), output)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+
+			// Files already extracted are never overwritten
+			if got := readFiles(t, output); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBundleExtractMissingObject(t *testing.T) {
+	bundlePath := newTestBundle(t, map[string]string{
+		"3000/monitor-1.json": `{"id": 1}`,
+		"3000/monitor-2.json": `{"id": 2}`,
+	})
+
+	output := t.TempDir()
+	writeFiles(t, output, map[string]string{"objects/3000/monitor-1.json": `{"id": 1}`})
+
+	_, err := extractBundle(bundlePath, filepath.Join(output, "objects"), output)
+	if err == nil || !strings.Contains(err.Error(), "missing file objects/3000/monitor-2.json") {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(output, "objects", "3000", "monitor-2.json")); !os.IsNotExist(err) {
+		t.Errorf("got extracted object, err: %v", err)
+	}
+}
+
+func TestBundleChecksumMismatch(t *testing.T) {
+	bundlePath := newTestBundle(t, map[string]string{"3000/monitor-1.json": `{"id": 1, "name": "a"}`})
+
+	// Rewrite the bundle with a changed object and the original metadata
+	_, files, err := readBundle(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := files[bundleMetadataName]
+	delete(files, bundleMetadataName)
+	files["objects/3000/monitor-1.json"] = []byte(`{"id": 1, "name": "b"}`)
+	files["objects/3000/monitor-2.json"] = []byte(`{"id": 2}`)
+	delete(files, "reports/patch-report.json")
+	if err := writeBundle(bundlePath, metadata, files); err != nil {
+		t.Fatal(err)
+	}
+
+	output := t.TempDir()
+	_, err = extractBundle(bundlePath, filepath.Join(output, "objects"), output)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	for _, want := range []string{
+		"checksum mismatch for objects/3000/monitor-1.json",
+		"unexpected file objects/3000/monitor-2.json",
+		"missing file reports/patch-report.json",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %s", err, want)
+		}
+	}
+
+	// Nothing is written when the bundle cannot be verified
+	if got := readFiles(t, output); len(got) > 0 {
+		t.Errorf("got files %v", got)
+	}
+}
+
+func TestBundleDuplicateReports(t *testing.T) {
+	directory := t.TempDir()
+	writeFiles(t, directory, map[string]string{
+		"objects/3000/monitor-1.json": `{"id": 1}`,
+		"patch/report.json":           `{}`,
+		"update/report.json":          `{}`,
+	})
+
+	reportPaths := []string{filepath.Join(directory, "patch", "report.json"), filepath.Join(directory, "update", "report.json")}
+	err := createBundle(filepath.Join(directory, "objects"), filepath.Join(directory, "bundle.tar.gz"), reportPaths, nil)
+	if err == nil || !strings.Contains(err.Error(), "another report is named report.json") {
+		t.Fatalf("got error %v", err)
+	}
+}
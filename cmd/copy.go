@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func newCopyCommand(config *config.Config) *cobra.Command {
+	var inputDirectory, remapFilePath string
+	var fromOrg, toOrg int
+	auditOpts := auditOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "copy",
+		Short: "Copy dumped objects from an org to another org",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if fromOrg == 0 || toOrg == 0 || fromOrg == toOrg {
+				cmd.Usage()
+				return fmt.Errorf("--from-org and --to-org must be set to different orgs")
+			}
+			if err := auditOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+
+			auditor, err := newAuditor(*config, auditOpts)
+			if err != nil {
+				return err
+			}
+
+			err = copyObjects(cmd.Context(), *config, inputDirectory, fromOrg, toOrg, remapFilePath, auditor)
+			if auditErr := auditor.Close(cmd.Context()); auditErr != nil {
+				err = errors.Join(err, auditErr)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().IntVar(&fromOrg, "from-org", 0, "ID of the org the objects were dumped from")
+	cmd.Flags().IntVar(&toOrg, "to-org", 0, "ID of the org to copy the objects to")
+	cmd.Flags().StringVar(&remapFilePath, "remap-file", "id-remap.json", "Path to the ID remap file recording copied objects")
+	addAuditFlags(cmd, &auditOpts)
+
+	return cmd
+}
+
+type copyOutput struct {
+	failedRefs  []error
+	createdRefs []migrate.ObjectRef
+	updatedRefs []migrate.ObjectRef
+}
+
+func copyObjects(ctx context.Context, cfg config.Config, inputDirectory string, fromOrg, toOrg int, remapFilePath string, auditor *auditor) error {
+	manifest, err := migrate.LoadManifest(inputDirectory)
+	if err != nil {
+		return err
+	}
+
+	remap, err := loadIDRemap(remapFilePath)
+	if err != nil {
+		return err
+	}
+
+	// Set proper creds
+	credCtx, err := client.DatadogCredentials(ctx, cfg, toOrg)
+	if err != nil {
+		return err
+	}
+
+	outputDir := filepath.Join(inputDirectory, strconv.Itoa(toOrg))
+	if err := os.MkdirAll(outputDir, 0o770); err != nil {
+		return fmt.Errorf("failed to create output folder %s: %w", outputDir, err)
+	}
+
+	output := copyOutput{}
+	files := map[migrate.ObjectRef]string{}
+	failures, err := migrate.NewStore(filepath.Join(inputDirectory, strconv.Itoa(fromOrg))).Walk(func(path string, ref migrate.ObjectRef) {
+		files[ref] = path
+	})
+	output.failedRefs = append(output.failedRefs, failures...)
+	if err != nil {
+		return err
+	}
+
+	copier := objectCopier{
+		updater: migrate.NewUpdater(client.Datadog(), migrate.AllMonitorFields()),
+		fromOrg: fromOrg,
+		toOrg:   toOrg,
+	}
+
+	refs := copyOrder(files)
+	copies := map[migrate.ObjectRef]copyResult{}
+	for i, ref := range refs {
+		if i%10 == 0 {
+			log.Println("Progressing, copying", ref.Type, "object", i, "out of", len(refs))
+		}
+
+		res, err := copier.copy(credCtx, ref, files[ref], remap)
+		if err != nil {
+			output.failedRefs = append(output.failedRefs, err)
+			continue
+		}
+		remap.set(ref, res.ref)
+		copies[ref] = res
+
+		action := updatedOutcome
+		if res.created {
+			action = createdOutcome
+			output.createdRefs = append(output.createdRefs, ref)
+
+			// Save the new ID right away, so an interrupted copy does not create the object again
+			if err := remap.save(remapFilePath); err != nil {
+				output.failedRefs = append(output.failedRefs, err)
+			}
+		} else {
+			output.updatedRefs = append(output.updatedRefs, ref)
+		}
+
+		if err := auditor.auditChange(ctx, action, res.ref, nil, res.content, manifest.Get(res.ref)); err != nil {
+			output.failedRefs = append(output.failedRefs, err)
+		}
+	}
+
+	// Dashboards may link to dashboards copied after them, update them once all IDs are known
+	for _, ref := range refs {
+		res, found := copies[ref]
+		if ref.Type != migrate.DashboardType || !found || len(res.unmapped) == 0 {
+			continue
+		}
+
+		content, unmapped, err := copier.rewrite(ref, files[ref], remap)
+		if err != nil {
+			output.failedRefs = append(output.failedRefs, err)
+			continue
+		}
+		if len(unmapped) == len(res.unmapped) {
+			// No new reference could be resolved
+			continue
+		}
+
+		if _, err := copier.updater.Update(credCtx, res.ref, content); err != nil {
+			output.failedRefs = append(output.failedRefs, err)
+			continue
+		}
+
+		before := &migrate.ObjectState{UpdatedHash: migrate.ContentHash(res.content)}
+		if err := auditor.auditChange(ctx, updatedOutcome, res.ref, nil, content, before); err != nil {
+			output.failedRefs = append(output.failedRefs, err)
+		}
+		res.content, res.unmapped = content, unmapped
+		copies[ref] = res
+	}
+
+	// Keep a local copy of the objects in the target org
+	for ref, res := range copies {
+		newRef := res.ref
+		format := migrate.FileFormat(files[ref])
+		path := filepath.Join(inputDirectory, migrate.ObjectFilePath(newRef.OrgID, newRef.Type, newRef.ID, format))
+
+		objBytes, err := migrate.NormalizeObject(format, newRef.Type, res.content)
+		if err == nil {
+			err = os.WriteFile(path, objBytes, 0o660)
+		}
+		if err != nil {
+			output.failedRefs = append(output.failedRefs, fmt.Errorf("failed to write copied object at %s, err: %w", path, err))
+			continue
+		}
+		manifest.Synced(newRef, objBytes)
+	}
+
+	if err := remap.save(remapFilePath); err != nil {
+		output.failedRefs = append(output.failedRefs, err)
+	}
+	if err := manifest.Save(); err != nil {
+		output.failedRefs = append(output.failedRefs, err)
+	}
+
+	fmt.Printf("\nFinished copying from org %d to org %d\n", fromOrg, toOrg)
+	fmt.Printf("Created objects: %d\n", len(output.createdRefs))
+	fmt.Printf("Updated objects: %d\n", len(output.updatedRefs))
+	printUnmappedReferences(refs, copies, fromOrg)
+	fmt.Printf("Copy failures: %d\n", len(output.failedRefs))
+	for _, err := range output.failedRefs {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	if len(output.failedRefs) > 0 {
+		return fmt.Errorf("failed to copy some objects")
+	}
+	return nil
+}
+
+// copyOrder sorts objects so that referenced objects are copied first:
+// plain monitors, then composite monitors, then dashboards.
+func copyOrder(files map[migrate.ObjectRef]string) []migrate.ObjectRef {
+	rank := func(ref migrate.ObjectRef) int {
+		switch ref.Type {
+		case migrate.MonitorType:
+			if isCompositeMonitorFile(files[ref]) {
+				return 1
+			}
+			return 0
+		default:
+			return 2
+		}
+	}
+
+	refs := make([]migrate.ObjectRef, 0, len(files))
+	ranks := make(map[migrate.ObjectRef]int, len(files))
+	for ref := range files {
+		refs = append(refs, ref)
+		ranks[ref] = rank(ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if ranks[refs[i]] != ranks[refs[j]] {
+			return ranks[refs[i]] < ranks[refs[j]]
+		}
+		return refs[i].Less(refs[j])
+	})
+
+	return refs
+}
+
+func isCompositeMonitorFile(path string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	doc, err := migrate.ParseDocument(content)
+	return err == nil && doc["type"] == "composite"
+}
+
+type objectCopier struct {
+	updater *migrate.Updater
+	fromOrg int
+	toOrg   int
+}
+
+// copyResult is a copied object: the reference and content of the copy, and the references of the object
+// that point to objects with no copy in the target org.
+type copyResult struct {
+	ref      migrate.ObjectRef
+	content  []byte
+	created  bool
+	unmapped []migrate.ObjectRef
+}
+
+// rewrite returns the content of the object to send to the target org, and the references with no copy.
+// References are remapped, the ID is the one of the existing copy if any, and restricted roles are dropped
+// as role IDs are specific to an org.
+func (c objectCopier) rewrite(ref migrate.ObjectRef, path string, remap idRemap) ([]byte, []migrate.ObjectRef, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file at %s, err: %w", path, err)
+	}
+
+	doc, err := migrate.ParseDocument(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	unmapped := []migrate.ObjectRef{}
+	seen := map[migrate.ObjectRef]struct{}{}
+	obj, ok := migrate.VisitReferences(ref.Type, doc, func(objType, id string) string {
+		from := migrate.ObjectRef{OrgID: c.fromOrg, Type: objType, ID: id}
+		if to, found := remap.get(from, c.toOrg); found {
+			return to.ID
+		}
+		if _, found := seen[from]; !found {
+			seen[from] = struct{}{}
+			unmapped = append(unmapped, from)
+		}
+		return id
+	}).(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid %s %s: not a JSON object", ref.Type, ref.ID)
+	}
+	delete(obj, "restricted_roles")
+
+	if to, found := remap.get(ref, c.toOrg); found {
+		if ref.Type == migrate.MonitorType {
+			obj["id"] = json.Number(to.ID)
+		} else {
+			obj["id"] = to.ID
+		}
+	}
+
+	sort.Slice(unmapped, func(i, j int) bool {
+		return unmapped[i].Less(unmapped[j])
+	})
+
+	objBytes, err := json.Marshal(obj)
+	return objBytes, unmapped, err
+}
+
+// copy creates the object in the target org, or updates its existing copy.
+func (c objectCopier) copy(ctx context.Context, ref migrate.ObjectRef, path string, remap idRemap) (copyResult, error) {
+	content, unmapped, err := c.rewrite(ref, path, remap)
+	if err != nil {
+		return copyResult{}, err
+	}
+
+	if to, found := remap.get(ref, c.toOrg); found {
+		notFound, err := c.updater.Update(ctx, to, content)
+		if err == nil {
+			return copyResult{ref: to, content: content, unmapped: unmapped}, nil
+		}
+		if !notFound {
+			return copyResult{}, err
+		}
+		// The copy was deleted, create it again
+	}
+
+	newRef, created, err := c.updater.Create(ctx, migrate.ObjectRef{OrgID: c.toOrg, Type: ref.Type, ID: ref.ID}, content)
+	if err != nil {
+		return copyResult{}, err
+	}
+
+	createdBytes, err := json.Marshal(created)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("failed to marshal copied %s %s, err: %w", ref.Type, newRef.ID, err)
+	}
+
+	return copyResult{ref: newRef, content: createdBytes, created: true, unmapped: unmapped}, nil
+}
+
+// printUnmappedReferences lists the references of copies that still point to objects of the source org,
+// because the referenced objects were not copied, such as SLOs.
+func printUnmappedReferences(refs []migrate.ObjectRef, copies map[migrate.ObjectRef]copyResult, fromOrg int) {
+	count := 0
+	for _, res := range copies {
+		count += len(res.unmapped)
+	}
+	if count == 0 {
+		return
+	}
+
+	fmt.Printf("References to objects of org %d with no copy: %d\n", fromOrg, count)
+	for _, ref := range refs {
+		for _, dep := range copies[ref].unmapped {
+			fmt.Printf("  %s %s -> %s %s\n", ref.Type, ref.ID, dep.Type, dep.ID)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+type muteOptions struct {
+	during time.Duration
+	settle time.Duration
+}
+
+func newUnmuteCommand(config *config.Config) *cobra.Command {
+	var inputDirectory string
+	auditOpts := auditOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "unmute",
+		Short: "Cancel downtimes created by update --mute-during",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := auditOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+
+			auditor, err := newAuditor(*config, auditOpts)
+			if err != nil {
+				return err
+			}
+
+			err = unmute(cmd.Context(), *config, inputDirectory, auditor)
+			if auditErr := auditor.Close(cmd.Context()); auditErr != nil {
+				err = errors.Join(err, auditErr)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	addAuditFlags(cmd, &auditOpts)
+
+	return cmd
+}
+
+func unmute(ctx context.Context, cfg config.Config, inputDirectory string, auditor *auditor) error {
+	manifest, err := migrate.LoadManifest(inputDirectory)
+	if err != nil {
+		return err
+	}
+
+	records := manifest.Downtimes
+	cancelled, remaining, failures := migrate.NewUpdater(client.Datadog(), migrate.AllMonitorFields()).CancelDowntimes(ctx, cfg, records)
+	for _, rec := range cancelled {
+		if err := auditor.auditDowntime(ctx, unmutedAction, rec); err != nil {
+			failures = append(failures, err)
+		}
+	}
+	manifest.Downtimes = remaining
+	if err := manifest.Save(); err != nil {
+		failures = append(failures, err)
+	}
+
+	fmt.Printf("\nFinished unmuting\n")
+	fmt.Printf("Cancelled or expired downtimes: %d\n", len(records)-len(remaining))
+	fmt.Printf("Unmute failures: %d\n", len(failures))
+	for _, err := range failures {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to cancel some downtimes")
+	}
+	return nil
+}
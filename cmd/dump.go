@@ -3,57 +3,85 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/spf13/cobra"
 
 	"github.com/DataDog/migrate-tool/pkg/client"
 	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
 )
 
 func newDumpCommand(config *config.Config) *cobra.Command {
-	var dashboardFilePath, monitorFilePath, outputDirectory string
-	var updateExisting bool
+	var dashboardFilePath, monitorFilePath, outputDirectory, format string
+	var updateExisting, withDependencies, autoCommit bool
+	reportOpts := reportOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "dump [input files]",
 		Short: "Dump all specified datadog objects in input files",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			atLeastOne := false
+			if dashboardFilePath == "" && monitorFilePath == "" {
+				cmd.Usage()
+				return fmt.Errorf("At least one input file necessary")
+			}
+			if err := migrate.ValidateFormat(format); err != nil {
+				cmd.Usage()
+				return err
+			}
+			if err := reportOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
 
-			if dashboardFilePath != "" {
-				atLeastOne = true
-				if err := dump(cmd.Context(), *config, dashboardFilePath, outputDirectory, updateExisting, dashboardDumper{}); err != nil {
-					return err
+			report := newRunReport("dump")
+			err := func() error {
+				if dashboardFilePath != "" {
+					if err := dump(cmd.Context(), *config, dashboardFilePath, outputDirectory, format, updateExisting, migrate.DashboardType, report); err != nil {
+						return err
+					}
 				}
-			}
 
-			if monitorFilePath != "" {
-				atLeastOne = true
-				if err := dump(cmd.Context(), *config, monitorFilePath, outputDirectory, updateExisting, monitorDumper{}); err != nil {
-					return err
+				if monitorFilePath != "" {
+					if err := dump(cmd.Context(), *config, monitorFilePath, outputDirectory, format, updateExisting, migrate.MonitorType, report); err != nil {
+						return err
+					}
 				}
-			}
 
-			if !atLeastOne {
-				cmd.Usage()
-				return fmt.Errorf("At least one input file necessary")
+				if withDependencies {
+					return dumpDependencies(cmd.Context(), *config, outputDirectory, format, report)
+				}
+
+				return nil
+			}()
+
+			if autoCommit {
+				message := fmt.Sprintf("Dump %d objects\n\n%s", report.outcomes()[dumpedOutcome], report.summary())
+				if commitErr := gitCommit(outputDirectory, message); commitErr != nil {
+					err = errors.Join(err, commitErr)
+				}
 			}
 
-			return nil
+			if reportErr := report.write(reportOpts); reportErr != nil {
+				return errors.Join(err, reportErr)
+			}
+			return err
 		},
 	}
 
 	cmd.Flags().StringVarP(&dashboardFilePath, "dashboards", "d", "", "Path to the dashboard source file")
 	cmd.Flags().StringVarP(&monitorFilePath, "monitors", "m", "", "Path to the monitor source file")
 	cmd.Flags().StringVarP(&outputDirectory, "output", "o", "objects", "Output folder")
+	cmd.Flags().StringVar(&format, "format", migrate.JSONFormat, "Format of the object files: json or yaml")
 	cmd.Flags().BoolVarP(&updateExisting, "update-existing", "u", false, "Update existing objects from Datadog API")
+	cmd.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Also dump objects referenced by dumped objects, transitively")
+	cmd.Flags().BoolVar(&autoCommit, "auto-commit", false, "Commit the output folder with git after dumping")
+	addReportFlags(cmd, &reportOpts)
 
 	return cmd
 }
@@ -64,37 +92,32 @@ type serializedRef struct {
 	DashboardID string `json:"DASHBOARD_ID,omitempty"`
 }
 
-func objectRefFromInputRef(serializedRef serializedRef) (objectRef, error) {
-	objectRef := objectRef{OrgID: serializedRef.OrgID}
+func objectRefFromInputRef(serializedRef serializedRef) (migrate.ObjectRef, error) {
+	ref := migrate.ObjectRef{OrgID: serializedRef.OrgID}
 
 	switch {
 	case serializedRef.MonitorID != 0:
-		objectRef.Type = monitorObjType
-		objectRef.ID = strconv.Itoa(serializedRef.MonitorID)
+		ref.Type = migrate.MonitorType
+		ref.ID = strconv.Itoa(serializedRef.MonitorID)
 	case serializedRef.DashboardID != "":
-		objectRef.Type = dashboardObjType
-		objectRef.ID = serializedRef.DashboardID
+		ref.Type = migrate.DashboardType
+		ref.ID = serializedRef.DashboardID
 	default:
-		return objectRef, fmt.Errorf("invalid input ref: %+v", serializedRef)
+		return ref, fmt.Errorf("invalid input ref: %+v", serializedRef)
 	}
 
-	return objectRef, nil
+	return ref, nil
 }
 
 type serializedRefs []serializedRef
 
-type objectDumper interface {
-	objType() string
-	dump(context.Context, config.Config, *datadog.APIClient, serializedRef) (any, error)
-}
-
 type dumpOutput struct {
 	failedRefs   []error
-	existingRefs serializedRefs
-	dumpedRefs   serializedRefs
+	existingRefs []migrate.ObjectRef
+	dumpedRefs   []migrate.ObjectRef
 }
 
-func dump(ctx context.Context, cfg config.Config, inputFilePath string, baseOutputDir string, updateExisting bool, dumper objectDumper) error {
+func dump(ctx context.Context, cfg config.Config, inputFilePath string, baseOutputDir, format string, updateExisting bool, objType string, report *runReport) error {
 	content, err := os.ReadFile(inputFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file %s: %w", inputFilePath, err)
@@ -116,58 +139,39 @@ func dump(ctx context.Context, cfg config.Config, inputFilePath string, baseOutp
 		}
 	}
 
+	store := migrate.NewStore(baseOutputDir)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		return err
+	}
+
 	// Second pass to dump objects
 	output := dumpOutput{}
-	datadogClient := client.Datadog()
-	for i, sRef := range sRefs {
-		objectRef, err := objectRefFromInputRef(sRef)
-		if err != nil {
-			output.failedRefs = append(output.failedRefs, fmt.Errorf("failed to parse input ref: %+v: %w", sRef, err))
-			continue
-		}
-
-		if i%20 == 0 {
-			log.Println("Progressing, dumping", objectRef.Type, "object", i, "out of", len(sRefs))
-		}
-
-		localPath := filepath.Join(baseOutputDir, objectFilePath(sRef.OrgID, objectRef.Type, objectRef.ID))
-		if !updateExisting {
-			_, err := os.Stat(localPath)
-			if err == nil {
-				output.existingRefs = append(output.existingRefs, sRef)
-				continue
-			}
-		}
-
-		// Set proper creds
-		credCtx, err := client.DatadogCredentials(ctx, cfg, sRef.OrgID)
-		if err != nil {
-			output.failedRefs = append(output.failedRefs, fmt.Errorf("%w object type: %s, id: %s", err, objectRef.Type, objectRef.ID))
-			continue
-		}
-
-		obj, err := dumper.dump(credCtx, cfg, datadogClient, sRef)
+	refs := []migrate.ObjectRef{}
+	for _, sRef := range sRefs {
+		ref, err := objectRefFromInputRef(sRef)
 		if err != nil {
-			output.failedRefs = append(output.failedRefs, fmt.Errorf("failed to process object from org: %d, type: %s, id: %s: %w", sRef.OrgID, objectRef.Type, objectRef.ID, err))
+			err = fmt.Errorf("failed to parse input ref: %+v: %w", sRef, err)
+			output.failedRefs = append(output.failedRefs, err)
+			report.add(nil, "", failedOutcome, err, time.Now())
 			continue
 		}
+		refs = append(refs, ref)
+	}
 
-		objBytes, err := json.MarshalIndent(obj, "", "\t")
-		if err != nil {
-			output.failedRefs = append(output.failedRefs, fmt.Errorf("failed to marshal object from org: %d, type: %s, id: %s: %w", sRef.OrgID, objectRef.Type, objectRef.ID, err))
-			continue
-		}
+	start := time.Now()
+	store.DumpAll(ctx, cfg, client.Datadog(), manifest, refs, format, updateExisting, func(res migrate.DumpResult) {
+		output.add(res, report, start)
+		start = time.Now()
+	})
 
-		err = os.WriteFile(localPath, objBytes, 0o660)
-		if err != nil {
-			output.failedRefs = append(output.failedRefs, fmt.Errorf("failed to write object from org: %d, type: %s, id: %s: %w", sRef.OrgID, objectRef.Type, objectRef.ID, err))
-			continue
-		}
-		output.dumpedRefs = append(output.dumpedRefs, sRef)
+	if err := manifest.Save(); err != nil {
+		output.failedRefs = append(output.failedRefs, err)
+		report.addFailures([]error{err})
 	}
 
 	// Print results to stdout
-	fmt.Printf("\nFinished dumping %s\n", dumper.objType())
+	fmt.Printf("\nFinished dumping %s\n", objType)
 	fmt.Printf("Existing refs: %d\n", len(output.existingRefs))
 	fmt.Printf("Dumped refs: %d\n", len(output.dumpedRefs))
 	fmt.Printf("Failed refs: %d\n", len(output.failedRefs))
@@ -181,38 +185,56 @@ func dump(ctx context.Context, cfg config.Config, inputFilePath string, baseOutp
 	return nil
 }
 
-// Dashboards
-type dashboardDumper struct{}
-
-func (dashboardDumper) objType() string {
-	return dashboardObjType
+// add records the outcome of a store dump: no content means the existing file was kept.
+func (output *dumpOutput) add(res migrate.DumpResult, report *runReport, start time.Time) {
+	ref := res.Ref
+	switch {
+	case res.Err != nil:
+		output.failedRefs = append(output.failedRefs, res.Err)
+		report.add(&ref, res.Path, failedOutcome, res.Err, start)
+	case res.Content == nil:
+		output.existingRefs = append(output.existingRefs, ref)
+		report.add(&ref, res.Path, existingOutcome, nil, start)
+	default:
+		output.dumpedRefs = append(output.dumpedRefs, ref)
+		report.add(&ref, res.Path, dumpedOutcome, nil, start)
+	}
 }
 
-func (dashboardDumper) dump(ctx context.Context, config config.Config, client *datadog.APIClient, ref serializedRef) (any, error) {
-	dashAPI := datadogV1.NewDashboardsApi(client)
-
-	dashboard, _, err := dashAPI.GetDashboard(ctx, ref.DashboardID)
+// dumpDependencies dumps the objects referenced by objects in the output folder, until all of them are dumped.
+func dumpDependencies(ctx context.Context, cfg config.Config, baseOutputDir, format string, report *runReport) error {
+	store := migrate.NewStore(baseOutputDir)
+	manifest, err := store.LoadManifest()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return dashboard, nil
-}
-
-// Monitors
-type monitorDumper struct{}
-
-func (monitorDumper) objType() string {
-	return monitorObjType
-}
+	output := dumpOutput{}
+	start := time.Now()
+	failures, err := store.DumpDependencies(ctx, cfg, client.Datadog(), manifest, format, func(res migrate.DumpResult) {
+		output.add(res, report, start)
+		start = time.Now()
+	})
+	output.failedRefs = append(output.failedRefs, failures...)
+	report.addFailures(failures)
+	if err != nil {
+		return err
+	}
 
-func (monitorDumper) dump(ctx context.Context, config config.Config, client *datadog.APIClient, ref serializedRef) (any, error) {
-	monitorAPI := datadogV1.NewMonitorsApi(client)
+	if err := manifest.Save(); err != nil {
+		output.failedRefs = append(output.failedRefs, err)
+		report.addFailures([]error{err})
+	}
 
-	monitor, _, err := monitorAPI.GetMonitor(ctx, int64(ref.MonitorID))
-	if err != nil {
-		return nil, err
+	fmt.Printf("\nFinished dumping dependencies\n")
+	fmt.Printf("Dumped refs: %d\n", len(output.dumpedRefs))
+	fmt.Printf("Failed refs: %d\n", len(output.failedRefs))
+	for _, err := range output.failedRefs {
+		fmt.Println(err)
 	}
 
-	return monitor, nil
+	if len(output.failedRefs) > 0 {
+		return fmt.Errorf("failed to dump some dependencies")
+	}
+	return nil
 }
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func newExportCommand(config *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export objects in input directory to other tools",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(newExportTerraformCommand(config))
+
+	return cmd
+}
+
+func newExportTerraformCommand(_ *config.Config) *cobra.Command {
+	var inputDirectory, outputDirectory string
+
+	cmd := &cobra.Command{
+		Use:   "terraform",
+		Short: "Export objects in input directory as one Terraform module per org",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportTerraform(inputDirectory, outputDirectory)
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().StringVarP(&outputDirectory, "output", "o", "terraform", "Output folder")
+
+	return cmd
+}
+
+const terraformVersions = `terraform {
+  required_version = ">= 1.5.0"
+
+  required_providers {
+    datadog = {
+      source = "DataDog/datadog"
+    }
+  }
+}
+`
+
+type exportOutput struct {
+	failedPaths   []error
+	exportedRefs  []migrate.ObjectRef
+	unmappedCount int
+}
+
+func exportTerraform(inputDirectory, outputDirectory string) error {
+	docs := map[int]map[migrate.ObjectRef]map[string]any{}
+	output := exportOutput{}
+
+	failures, err := migrate.NewStore(inputDirectory).Walk(func(path string, ref migrate.ObjectRef) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to read file at %s, err: %w", path, err))
+			return
+		}
+
+		doc, err := migrate.ParseDocument(content)
+		if err != nil {
+			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to unmarshal object at %s, err: %w", path, err))
+			return
+		}
+
+		if docs[ref.OrgID] == nil {
+			docs[ref.OrgID] = map[migrate.ObjectRef]map[string]any{}
+		}
+		docs[ref.OrgID][ref] = doc
+	})
+	output.failedPaths = append(failures, output.failedPaths...)
+	if err != nil {
+		return err
+	}
+
+	for orgID, orgDocs := range docs {
+		if err := exportTerraformModule(outputDirectory, orgID, orgDocs, &output); err != nil {
+			output.failedPaths = append(output.failedPaths, err)
+		}
+	}
+
+	fmt.Printf("\nFinished exporting %s to %s\n", inputDirectory, outputDirectory)
+	fmt.Printf("Exported objects: %d\n", len(output.exportedRefs))
+	fmt.Printf("Unmapped monitor options: %d\n", output.unmappedCount)
+	fmt.Printf("Export failures: %d\n", len(output.failedPaths))
+	for _, err := range output.failedPaths {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	if len(output.failedPaths) > 0 {
+		return fmt.Errorf("failed to export some objects")
+	}
+	return nil
+}
+
+// exportTerraformModule writes the module of an org: resources in main.tf and import blocks in imports.tf,
+// so that `terraform apply` adopts the existing objects instead of recreating them.
+func exportTerraformModule(outputDirectory string, orgID int, docs map[migrate.ObjectRef]map[string]any, output *exportOutput) error {
+	refs := make([]migrate.ObjectRef, 0, len(docs))
+	for ref := range docs {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Less(refs[j])
+	})
+
+	resources := &hclWriter{}
+	imports := &hclWriter{}
+	for _, ref := range refs {
+		var address string
+		var err error
+
+		switch ref.Type {
+		case migrate.MonitorType:
+			address, err = writeMonitorResource(resources, ref, docs[ref], output)
+		case migrate.DashboardType:
+			address, err = writeDashboardResource(resources, ref, docs[ref])
+		}
+		if err != nil {
+			output.failedPaths = append(output.failedPaths, err)
+			continue
+		}
+
+		imports.block("import", func() {
+			imports.expr("to", address)
+			imports.attr("id", ref.ID)
+		})
+		imports.line("")
+		output.exportedRefs = append(output.exportedRefs, ref)
+	}
+
+	moduleDir := filepath.Join(outputDirectory, strconv.Itoa(orgID))
+	if err := os.MkdirAll(moduleDir, 0o770); err != nil {
+		return fmt.Errorf("failed to create output folder %s: %w", moduleDir, err)
+	}
+
+	files := map[string][]byte{
+		"versions.tf": []byte(terraformVersions),
+		"main.tf":     []byte(resources.String()),
+		"imports.tf":  []byte(imports.String()),
+	}
+	for name, content := range files {
+		path := filepath.Join(moduleDir, name)
+		if err := os.WriteFile(path, content, 0o660); err != nil {
+			return fmt.Errorf("failed to write %s, err: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// monitorOptionAttributes are the monitor options written as attributes of the same name in datadog_monitor.
+var monitorOptionAttributes = map[string]struct{}{
+	"enable_logs_sample":       {},
+	"enable_samples":           {},
+	"escalation_message":       {},
+	"evaluation_delay":         {},
+	"group_retention_duration": {},
+	"groupby_simple_monitor":   {},
+	"include_tags":             {},
+	"locked":                   {},
+	"min_failure_duration":     {},
+	"new_group_delay":          {},
+	"new_host_delay":           {},
+	"no_data_timeframe":        {},
+	"notification_preset_name": {},
+	"notify_audit":             {},
+	"notify_by":                {},
+	"notify_no_data":           {},
+	"on_missing_data":          {},
+	"renotify_interval":        {},
+	"renotify_occurrences":     {},
+	"renotify_statuses":        {},
+	"require_full_window":      {},
+	"timeout_h":                {},
+}
+
+// monitorOptionBlocks are the monitor options written as nested blocks in datadog_monitor.
+var monitorOptionBlocks = map[string]string{
+	"thresholds":        "monitor_thresholds",
+	"threshold_windows": "monitor_threshold_windows",
+}
+
+// writeMonitorResource writes a datadog_monitor resource and returns its address.
+// Options without a Terraform equivalent are written as comments, to be reviewed manually.
+func writeMonitorResource(w *hclWriter, ref migrate.ObjectRef, doc map[string]any, output *exportOutput) (string, error) {
+	for _, field := range []string{migrate.MonitorNameField, migrate.MonitorTypeField, migrate.MonitorQueryField} {
+		if _, ok := doc[field].(string); !ok {
+			return "", fmt.Errorf("failed to export monitor %s, err: missing %s", ref, field)
+		}
+	}
+
+	options, _ := doc[migrate.MonitorOptionsField].(map[string]any)
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	name := "monitor_" + hclIdentifier(ref.ID)
+	w.block(fmt.Sprintf("resource \"datadog_monitor\" %q", name), func() {
+		w.attr("name", doc[migrate.MonitorNameField])
+		w.attr("type", doc[migrate.MonitorTypeField])
+		w.attr("query", doc[migrate.MonitorQueryField])
+		w.attr("message", doc[migrate.MonitorMessageField])
+		w.attr("tags", doc[migrate.MonitorTagsField])
+		if priority, ok := doc[migrate.MonitorPriorityField].(json.Number); ok {
+			w.attr("priority", priority.String())
+		}
+		w.attr("restricted_roles", doc[migrate.MonitorRestrictedRolesField])
+
+		for _, key := range keys {
+			value := options[key]
+			if value == nil {
+				continue
+			}
+
+			if _, found := monitorOptionAttributes[key]; found {
+				w.attr(key, value)
+				continue
+			}
+
+			values, isMap := value.(map[string]any)
+			if blockName, found := monitorOptionBlocks[key]; found && isMap {
+				w.line("")
+				w.block(blockName, func() {
+					writeStringAttributes(w, values)
+				})
+				continue
+			}
+
+			content, _ := json.Marshal(value)
+			w.comment("Unmapped option, set it manually: %s = %s", key, content)
+			output.unmappedCount++
+		}
+	})
+	w.line("")
+
+	return "datadog_monitor." + name, nil
+}
+
+// writeStringAttributes writes threshold values, which are strings in datadog_monitor.
+func writeStringAttributes(w *hclWriter, values map[string]any) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		switch value := values[key].(type) {
+		case json.Number:
+			w.attr(key, value.String())
+		default:
+			w.attr(key, value)
+		}
+	}
+}
+
+// writeDashboardResource writes a datadog_dashboard_json resource and returns its address.
+func writeDashboardResource(w *hclWriter, ref migrate.ObjectRef, doc map[string]any) (string, error) {
+	content, err := migrate.MarshalDocument(migrate.JSONFormat, migrate.DashboardType, migrate.WithoutFields(doc, migrate.DashboardReadOnlyFields))
+	if err != nil {
+		return "", fmt.Errorf("failed to export dashboard %s, err: %w", ref, err)
+	}
+
+	name := "dashboard_" + hclIdentifier(ref.ID)
+	w.block(fmt.Sprintf("resource \"datadog_dashboard_json\" %q", name), func() {
+		w.attr("dashboard", string(content))
+	})
+	w.line("")
+
+	return "datadog_dashboard_json." + name, nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runGit runs a git command in dir and returns its standard output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// gitChangedFiles returns the files of dir that were changed or added since the git ref,
+// including uncommitted and untracked files. Paths are prefixed by dir.
+func gitChangedFiles(dir, since string) (map[string]struct{}, error) {
+	changed, err := runGit(dir, "diff", "--name-only", "--relative", "--diff-filter=AMR", since, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := runGit(dir, "ls-files", "--others", "--exclude-standard", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]struct{}{}
+	for _, name := range strings.Split(changed+untracked, "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			files[filepath.Join(dir, name)] = struct{}{}
+		}
+	}
+
+	return files, nil
+}
+
+// gitCommit commits all changes in dir, and only in dir. It does nothing if there is no change.
+func gitCommit(dir, message string) error {
+	if _, err := runGit(dir, "add", "--all", "--", "."); err != nil {
+		return err
+	}
+
+	status, err := runGit(dir, "status", "--porcelain", "--", ".")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(status) == "" {
+		return nil
+	}
+
+	_, err = runGit(dir, "commit", "--quiet", "--message", message, "--", ".")
+	return err
+}
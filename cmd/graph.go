@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const (
+	textGraphFormat = "text"
+	dotGraphFormat  = "dot"
+	jsonGraphFormat = "json"
+)
+
+func newGraphCommand(_ *config.Config) *cobra.Command {
+	var inputDirectory, format, outputFilePath string
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Print the dependency graph of objects in input directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			graph, failures, err := migrate.NewStore(inputDirectory).DependencyGraph()
+			if err != nil {
+				return err
+			}
+			for _, err := range failures {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+
+			out := cmd.OutOrStdout()
+			if outputFilePath != "" {
+				file, err := os.Create(outputFilePath)
+				if err != nil {
+					return fmt.Errorf("failed to create graph file %s: %w", outputFilePath, err)
+				}
+				defer file.Close()
+				out = file
+			}
+
+			switch format {
+			case textGraphFormat:
+				return writeGraphText(out, graph)
+			case dotGraphFormat:
+				return writeGraphDOT(out, graph)
+			case jsonGraphFormat:
+				return writeGraphJSON(out, graph)
+			default:
+				cmd.Usage()
+				return fmt.Errorf("unknown graph format: %s", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().StringVarP(&format, "format", "f", textGraphFormat, "Output format: text, dot or json")
+	cmd.Flags().StringVarP(&outputFilePath, "output", "o", "", "Output file (default stdout)")
+
+	return cmd
+}
+
+func writeGraphText(w io.Writer, graph *migrate.DependencyGraph) error {
+	sb := strings.Builder{}
+	for _, ref := range graph.Nodes() {
+		deps := graph.Edges[ref]
+		if len(deps) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s\n", ref)
+		for _, dep := range deps {
+			if graph.IsMissing(dep) {
+				fmt.Fprintf(&sb, "  -> %s (missing)\n", dep)
+			} else {
+				fmt.Fprintf(&sb, "  -> %s\n", dep)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeGraphDOT(w io.Writer, graph *migrate.DependencyGraph) error {
+	sb := strings.Builder{}
+	sb.WriteString("digraph dependencies {\n")
+	for _, ref := range graph.Nodes() {
+		if graph.IsMissing(ref) {
+			fmt.Fprintf(&sb, "\t%q [style=dashed];\n", ref.String())
+		} else {
+			fmt.Fprintf(&sb, "\t%q;\n", ref.String())
+		}
+	}
+	for _, ref := range graph.Nodes() {
+		for _, dep := range graph.Edges[ref] {
+			fmt.Fprintf(&sb, "\t%q -> %q;\n", ref.String(), dep.String())
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type serializedGraphNode struct {
+	Ref          migrate.ObjectRef   `json:"ref"`
+	Missing      bool                `json:"missing,omitempty"`
+	Dependencies []migrate.ObjectRef `json:"dependencies,omitempty"`
+}
+
+func writeGraphJSON(w io.Writer, graph *migrate.DependencyGraph) error {
+	nodes := []serializedGraphNode{}
+	for _, ref := range graph.Nodes() {
+		nodes = append(nodes, serializedGraphNode{
+			Ref:          ref,
+			Missing:      graph.IsMissing(ref),
+			Dependencies: graph.Edges[ref],
+		})
+	}
+
+	content, err := json.MarshalIndent(nodes, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal graph: %w", err)
+	}
+
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
@@ -0,0 +1,542 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hclWriter writes Terraform configuration, it only supports the constructs used by the export.
+type hclWriter struct {
+	buf    strings.Builder
+	indent int
+}
+
+func (w *hclWriter) line(format string, args ...any) {
+	if format != "" {
+		w.buf.WriteString(strings.Repeat("  ", w.indent))
+	}
+	fmt.Fprintf(&w.buf, format, args...)
+	w.buf.WriteString("\n")
+}
+
+func (w *hclWriter) comment(format string, args ...any) {
+	w.line("# "+format, args...)
+}
+
+func (w *hclWriter) block(header string, body func()) {
+	w.line("%s {", header)
+	w.indent++
+	body()
+	w.indent--
+	w.line("}")
+}
+
+// attr writes an attribute. Null values are skipped.
+func (w *hclWriter) attr(name string, value any) {
+	if value == nil {
+		return
+	}
+
+	if s, ok := value.(string); ok && isHeredocString(s) {
+		delimiter := heredocDelimiter(s)
+		w.line("%s = <<%s", name, delimiter)
+		w.buf.WriteString(escapeHCLTemplate(s))
+		w.buf.WriteString(delimiter + "\n")
+		return
+	}
+
+	w.line("%s = %s", name, hclValue(value))
+}
+
+// expr writes an attribute set to a Terraform expression, such as a resource address.
+func (w *hclWriter) expr(name, expression string) {
+	w.line("%s = %s", name, expression)
+}
+
+func (w *hclWriter) String() string {
+	return w.buf.String()
+}
+
+func hclValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return hclString(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case nil:
+		return "null"
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, hclValue(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, 0, len(v))
+		for _, key := range keys {
+			items = append(items, hclString(key)+" = "+hclValue(v[key]))
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	default:
+		return hclString(fmt.Sprint(v))
+	}
+}
+
+// hclString quotes a string, escaping template sequences so that it is taken literally.
+func hclString(s string) string {
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return escapeHCLTemplate(b.String())
+}
+
+func escapeHCLTemplate(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// isHeredocString reports whether a string is better written as a heredoc.
+// Heredocs always end with a new line, other strings are quoted.
+func isHeredocString(s string) bool {
+	return strings.Count(s, "\n") > 1 && strings.HasSuffix(s, "\n") && !strings.ContainsAny(s, "\r")
+}
+
+func heredocDelimiter(s string) string {
+	delimiter := "EOT"
+	for strings.Contains("\n"+s, "\n"+delimiter+"\n") {
+		delimiter += "_"
+	}
+	return delimiter
+}
+
+// hclIdentifier turns an object ID into a valid Terraform identifier.
+func hclIdentifier(s string) string {
+	b := strings.Builder{}
+	for _, r := range s {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// hclBlock is a resource block found in a Terraform file.
+type hclBlock struct {
+	resourceType string
+	name         string
+	// Span of the block body, between the braces
+	bodyStart, bodyEnd int
+}
+
+func (block hclBlock) address() string {
+	return block.resourceType + "." + block.name
+}
+
+// hclLiteral is a string literal assigned to an attribute: a quoted string or a heredoc.
+type hclLiteral struct {
+	// Span of the literal: the quoted string with its quotes, or the heredoc body
+	start, end int
+	heredoc    bool
+	// Indentation removed from the lines of a <<- heredoc
+	indent string
+	value  string
+	// Literals with interpolations or directives are never patched
+	dynamic bool
+}
+
+var hclResourceHeader = regexp.MustCompile(`^resource\s+"([^"]*)"\s+"([^"]*)"\s*\{`)
+
+var hclAttributeHeader = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*)[ \t]*=[ \t]*`)
+
+// hclResourceBlocks returns the top-level resource blocks of a Terraform file.
+// It only scans the structure of the file: comments, strings and heredocs are skipped.
+func hclResourceBlocks(src string) ([]hclBlock, error) {
+	blocks := []hclBlock{}
+	depth := 0
+	var current *hclBlock
+
+	for i := 0; i < len(src); {
+		next, skipped, err := hclSkip(src, i)
+		if err != nil {
+			return nil, err
+		}
+		if skipped {
+			i = next
+			continue
+		}
+
+		switch c := src[i]; {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 && current != nil {
+				current.bodyEnd = i
+				blocks = append(blocks, *current)
+				current = nil
+			}
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced braces at offset %d", i)
+			}
+		case depth == 0 && (i == 0 || src[i-1] == '\n'):
+			if match := hclResourceHeader.FindStringSubmatch(src[i:]); match != nil {
+				current = &hclBlock{resourceType: match[1], name: match[2], bodyStart: i + len(match[0])}
+				depth++
+				i += len(match[0])
+				continue
+			}
+		}
+		i++
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces at end of file")
+	}
+	return blocks, nil
+}
+
+// hclAttributeLiterals returns the string literals assigned to the attributes of a block body.
+// Nested blocks and attributes set to other expressions are ignored.
+func hclAttributeLiterals(src string, block hclBlock) (map[string]hclLiteral, error) {
+	literals := map[string]hclLiteral{}
+	depth := 0
+
+	for i := block.bodyStart; i < block.bodyEnd; {
+		if c := src[i]; depth == 0 && (c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') && hclLineStart(src, i) {
+			if match := hclAttributeHeader.FindStringSubmatch(src[i:block.bodyEnd]); match != nil {
+				valueStart := i + len(match[0])
+				literal, ok, err := hclParseLiteral(src, valueStart)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value of %s in %s, err: %w", match[1], block.address(), err)
+				}
+				if ok {
+					literals[match[1]] = literal
+				}
+				i = valueStart
+				continue
+			}
+		}
+
+		next, skipped, err := hclSkip(src, i)
+		if err != nil {
+			return nil, err
+		}
+		if skipped {
+			i = next
+			continue
+		}
+
+		switch src[i] {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		}
+		i++
+	}
+
+	return literals, nil
+}
+
+// hclLineStart reports whether only blanks precede the offset on its line.
+func hclLineStart(src string, i int) bool {
+	lineStart := strings.LastIndexByte(src[:i], '\n') + 1
+	return strings.TrimLeft(src[lineStart:i], " \t") == ""
+}
+
+// hclSkip skips the comment, string or heredoc starting at offset i, if any.
+func hclSkip(src string, i int) (int, bool, error) {
+	switch {
+	case src[i] == '#' || strings.HasPrefix(src[i:], "//"):
+		end := strings.IndexByte(src[i:], '\n')
+		if end < 0 {
+			return len(src), true, nil
+		}
+		return i + end, true, nil
+
+	case strings.HasPrefix(src[i:], "/*"):
+		end := strings.Index(src[i+2:], "*/")
+		if end < 0 {
+			return 0, false, fmt.Errorf("unterminated comment at offset %d", i)
+		}
+		return i + 2 + end + 2, true, nil
+
+	case src[i] == '"':
+		end, _, err := hclScanQuoted(src, i)
+		return end, true, err
+
+	case strings.HasPrefix(src[i:], "<<"):
+		literal, ok, err := hclParseHeredoc(src, i)
+		if err != nil || !ok {
+			return 0, false, err
+		}
+		if end := strings.IndexByte(src[literal.end:], '\n'); end >= 0 {
+			return literal.end + end + 1, true, nil
+		}
+		return len(src), true, nil
+	}
+
+	return 0, false, nil
+}
+
+// hclScanQuoted returns the end of the quoted string starting at offset i,
+// and whether it contains interpolations or directives.
+func hclScanQuoted(src string, i int) (int, bool, error) {
+	dynamic := false
+	for j := i + 1; j < len(src); j++ {
+		switch c := src[j]; c {
+		case '\\':
+			j++
+		case '"':
+			return j + 1, dynamic, nil
+		case '\n':
+			return 0, false, fmt.Errorf("unterminated string at offset %d", i)
+		case '$', '%':
+			if strings.HasPrefix(src[j:], string([]byte{c, c, '{'})) {
+				j += 2
+				continue
+			}
+			if j+1 < len(src) && src[j+1] == '{' {
+				dynamic = true
+				end, err := hclScanTemplate(src, j+2)
+				if err != nil {
+					return 0, false, err
+				}
+				j = end - 1
+			}
+		}
+	}
+	return 0, false, fmt.Errorf("unterminated string at offset %d", i)
+}
+
+// hclScanTemplate returns the end of the interpolation or directive whose content starts at offset i.
+func hclScanTemplate(src string, i int) (int, error) {
+	depth := 1
+	for j := i; j < len(src); j++ {
+		switch src[j] {
+		case '"':
+			end, _, err := hclScanQuoted(src, j)
+			if err != nil {
+				return 0, err
+			}
+			j = end - 1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j + 1, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated template at offset %d", i)
+}
+
+// hclParseLiteral parses the string literal starting at offset i, if any.
+func hclParseLiteral(src string, i int) (hclLiteral, bool, error) {
+	switch {
+	case strings.HasPrefix(src[i:], "<<"):
+		return hclParseHeredoc(src, i)
+
+	case strings.HasPrefix(src[i:], `"`):
+		end, dynamic, err := hclScanQuoted(src, i)
+		if err != nil {
+			return hclLiteral{}, false, err
+		}
+		literal := hclLiteral{start: i, end: end, dynamic: dynamic}
+		if !dynamic {
+			if literal.value, err = hclUnquote(src[i+1 : end-1]); err != nil {
+				return hclLiteral{}, false, err
+			}
+		}
+		return literal, true, nil
+	}
+
+	return hclLiteral{}, false, nil
+}
+
+var hclHeredocHeader = regexp.MustCompile(`^<<(-?)([A-Za-z_][A-Za-z0-9_-]*)[ \t]*\r?\n`)
+
+// hclParseHeredoc parses the heredoc starting at offset i.
+func hclParseHeredoc(src string, i int) (hclLiteral, bool, error) {
+	match := hclHeredocHeader.FindStringSubmatch(src[i:])
+	if match == nil {
+		return hclLiteral{}, false, nil
+	}
+	flush, delimiter := match[1] == "-", match[2]
+
+	literal := hclLiteral{start: i + len(match[0]), heredoc: true}
+	for lineStart := literal.start; ; {
+		lineEnd := strings.IndexByte(src[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(src)
+		} else {
+			lineEnd += lineStart
+		}
+
+		if strings.TrimSpace(src[lineStart:lineEnd]) == delimiter {
+			literal.end = lineStart
+			break
+		}
+		if lineEnd == len(src) {
+			return hclLiteral{}, false, fmt.Errorf("unterminated heredoc %s at offset %d", delimiter, i)
+		}
+		lineStart = lineEnd + 1
+	}
+
+	body := src[literal.start:literal.end]
+	if flush {
+		literal.indent = hclHeredocIndent(body)
+		lines := strings.SplitAfter(body, "\n")
+		for l, line := range lines {
+			lines[l] = strings.TrimPrefix(line, literal.indent)
+		}
+		body = strings.Join(lines, "")
+	}
+
+	literal.dynamic = hclIsDynamicTemplate(body)
+	if !literal.dynamic {
+		literal.value = strings.NewReplacer("$${", "${", "%%{", "%{").Replace(body)
+	}
+	return literal, true, nil
+}
+
+// hclHeredocIndent returns the indentation shared by the non-blank lines of a heredoc body.
+func hclHeredocIndent(body string) string {
+	indent := ""
+	first := true
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first || len(lineIndent) < len(indent) {
+			indent = lineIndent
+			first = false
+		}
+	}
+	return indent
+}
+
+func hclIsDynamicTemplate(s string) bool {
+	for j := 0; j+1 < len(s); j++ {
+		if (s[j] == '$' || s[j] == '%') && s[j+1] == '{' {
+			if j > 0 && s[j-1] == s[j] {
+				continue
+			}
+			return true
+		}
+		if (s[j] == '$' || s[j] == '%') && s[j+1] == s[j] {
+			j++
+		}
+	}
+	return false
+}
+
+// hclUnquote decodes the content of a quoted string without interpolations.
+func hclUnquote(s string) (string, error) {
+	b := strings.Builder{}
+	for j := 0; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case c == '\\' && j+1 < len(s):
+			j++
+			switch s[j] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(s[j])
+			case 'u', 'U':
+				size := 4
+				if s[j] == 'U' {
+					size = 8
+				}
+				if j+size >= len(s) {
+					return "", fmt.Errorf("invalid escape sequence in %q", s)
+				}
+				code, err := strconv.ParseUint(s[j+1:j+1+size], 16, 32)
+				if err != nil {
+					return "", fmt.Errorf("invalid escape sequence in %q", s)
+				}
+				b.WriteRune(rune(code))
+				j += size
+			default:
+				return "", fmt.Errorf("invalid escape sequence in %q", s)
+			}
+		case (c == '$' || c == '%') && strings.HasPrefix(s[j:], string([]byte{c, c, '{'})):
+			b.WriteString(string([]byte{c, '{'}))
+			j += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// encode returns the text replacing the literal for a new value, in the same style.
+func (literal hclLiteral) encode(value string) string {
+	if !literal.heredoc {
+		return hclString(value)
+	}
+
+	// The new line before the delimiter is part of the value: it is only added, with the line ending of the
+	// original body, when the new value lacks it
+	if value != "" && !strings.HasSuffix(value, "\n") {
+		if strings.HasSuffix(literal.value, "\r\n") {
+			value += "\r"
+		}
+		value += "\n"
+	}
+	body := escapeHCLTemplate(value)
+	if literal.indent == "" {
+		return body
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	for l, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[l] = literal.indent + line
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHCLResourceBlocks(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "resources and other blocks",
+			src: `terraform {
+  required_providers {
+    datadog = { source = "DataDog/datadog" }
+  }
+}
+
+resource "datadog_monitor" "a" {
+  name = "a"
+  monitor_thresholds {
+    critical = 1
+  }
+}
+
+resource "datadog_dashboard_json" "b" {
+  dashboard = "{}"
+}
+`,
+			want: []string{"datadog_monitor.a", "datadog_dashboard_json.b"},
+		},
+		{
+			name: "braces in comments, strings and heredocs",
+			src: `# resource "datadog_monitor" "commented" {
+// }
+/* resource "datadog_monitor" "block_comment" { */
+resource "datadog_monitor" "a" {
+  name    = "{{host.name}} \"}\" ${var.a} %{if true}}%{endif}"
+  message = <<EOT
+}
+resource "datadog_monitor" "heredoc" {
+EOT
+}
+`,
+			want: []string{"datadog_monitor.a"},
+		},
+		{
+			name: "nested resource headers are ignored",
+			src: `module "m" {
+resource "datadog_monitor" "nested" {
+}
+}
+`,
+			want: []string{},
+		},
+		{name: "unbalanced braces", src: "}\n", wantErr: true},
+		{name: "unclosed block", src: `resource "datadog_monitor" "a" {` + "\n", wantErr: true},
+		{name: "unterminated comment", src: "/* resource\n", wantErr: true},
+		{name: "unterminated string", src: `resource "datadog_monitor" "a" {` + "\n  name = \"a\n}\n", wantErr: true},
+		{name: "unterminated heredoc", src: `resource "datadog_monitor" "a" {` + "\n  message = <<EOT\na\n}\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := hclResourceBlocks(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := []string{}
+			for _, block := range blocks {
+				got = append(got, block.address())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCLAttributeLiterals(t *testing.T) {
+	src := `resource "datadog_monitor" "a" {
+  # name = "commented"
+  name    = "CPU \"high\" on {{host.name}}\t$${literal}"
+  query   = "avg(last_5m):avg:system.cpu.user{env:${var.env}} > 90"
+  type    = "metric alert" // comment
+  tags    = ["team:a"]
+  options = jsonencode({ message = "not an attribute" })
+  message = <<EOT
+Notify @team
+  indented %%{literal}
+EOT
+  escalation_message = <<-EOT
+    Still alerting
+      after 1h
+    EOT
+  monitor_thresholds {
+    critical = "90"
+  }
+  new_host_delay = <<EOT
+%{if var.delay}300%{endif}
+EOT
+}
+`
+	tests := []struct {
+		attribute string
+		want      string
+		dynamic   bool
+		indent    string
+		heredoc   bool
+		found     bool
+	}{
+		{attribute: "name", want: "CPU \"high\" on {{host.name}}\t${literal}", found: true},
+		{attribute: "query", dynamic: true, found: true},
+		{attribute: "type", want: "metric alert", found: true},
+		{attribute: "message", want: "Notify @team\n  indented %{literal}\n", heredoc: true, found: true},
+		{attribute: "escalation_message", want: "Still alerting\n  after 1h\n", heredoc: true, indent: "    ", found: true},
+		{attribute: "new_host_delay", dynamic: true, heredoc: true, found: true},
+		{attribute: "tags"},
+		{attribute: "options"},
+		{attribute: "critical"},
+	}
+
+	blocks, err := hclResourceBlocks(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("got %d blocks", len(blocks))
+	}
+	literals, err := hclAttributeLiterals(src, blocks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.attribute, func(t *testing.T) {
+			literal, found := literals[tt.attribute]
+			if found != tt.found {
+				t.Fatalf("got found %v", found)
+			}
+			if !found {
+				return
+			}
+			if literal.value != tt.want || literal.dynamic != tt.dynamic || literal.heredoc != tt.heredoc || literal.indent != tt.indent {
+				t.Errorf("got %+v", literal)
+			}
+		})
+	}
+}
+
+func TestHCLParseHeredoc(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		found   bool
+		wantErr bool
+	}{
+		{name: "heredoc", src: "<<EOT\na\nb\nEOT\n", want: "a\nb\n", found: true},
+		{name: "delimiter in the body", src: "<<EOT\nEOT_\n EOT \n", want: "EOT_\n", found: true},
+		{name: "empty", src: "<<EOT\nEOT", want: "", found: true},
+		{name: "windows line endings", src: "<<EOT\r\na\r\nEOT\r\n", want: "a\r\n", found: true},
+		{name: "flush", src: "<<-EOT\n  a\n\n    b\n  EOT\n", want: "a\n\n  b\n", found: true},
+		{name: "not a heredoc", src: "<<EOT a\nEOT\n"},
+		{name: "unterminated", src: "<<EOT\na\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literal, found, err := hclParseHeredoc(tt.src, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if found != tt.found {
+				t.Fatalf("got found %v", found)
+			}
+			if found && literal.value != tt.want {
+				t.Errorf("got %q, want %q", literal.value, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCLSkip(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    int
+		skipped bool
+		wantErr bool
+	}{
+		{name: "hash comment", src: "# a {\nb", want: 5, skipped: true},
+		{name: "slash comment", src: "// a {\nb", want: 6, skipped: true},
+		{name: "comment at end of file", src: "# a", want: 3, skipped: true},
+		{name: "block comment", src: "/* a\n{ */b", want: 9, skipped: true},
+		{name: "string", src: `"a\"}"b`, want: 6, skipped: true},
+		{name: "string with template", src: `"${lookup({"a" = "}"}, "a")}"b`, want: 29, skipped: true},
+		{name: "heredoc", src: "<<EOT\n}\nEOT\nb", want: 12, skipped: true},
+		{name: "not skipped", src: "{"},
+		{name: "division", src: "a / b"},
+		{name: "unterminated block comment", src: "/* a", wantErr: true},
+		{name: "unterminated template", src: `"${a"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, skipped, err := hclSkip(tt.src, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if skipped != tt.skipped || skipped && got != tt.want {
+				t.Errorf("got %d, %v, want %d, %v", got, skipped, tt.want, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestHCLUnquote(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: `plain`, want: "plain"},
+		{input: `a\"b\\c`, want: `a"b\c`},
+		{input: `\n\r\t`, want: "\n\r\t"},
+		{input: `é\U0001F600`, want: "é😀"},
+		{input: `$${a} %%{b} $a %a`, want: "${a} %{b} $a %a"},
+		{input: `\x`, wantErr: true},
+		{input: `\u00`, wantErr: true},
+		{input: `\uzzzz`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := hclUnquote(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCLLiteralEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal hclLiteral
+		value   string
+		want    string
+	}{
+		{name: "quoted", value: "a \"b\"\n${c}", want: `"a \"b\"\n$${c}"`},
+		{name: "heredoc", literal: hclLiteral{heredoc: true}, value: "a\n%{b}", want: "a\n%%{b}\n"},
+		{name: "flush heredoc", literal: hclLiteral{heredoc: true, indent: "  "}, value: "a\n\nb\n", want: "  a\n\n  b\n"},
+		{name: "heredoc with trailing new line", literal: hclLiteral{heredoc: true, value: "a\n"}, value: "b\n", want: "b\n"},
+		{name: "heredoc with trailing blank line", literal: hclLiteral{heredoc: true, value: "a\n\n"}, value: "b\n\n", want: "b\n\n"},
+		{name: "heredoc with CRLF line endings", literal: hclLiteral{heredoc: true, value: "a\r\n"}, value: "b", want: "b\r\n"},
+		{name: "empty heredoc", literal: hclLiteral{heredoc: true}, value: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.literal.encode(tt.value); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHCLHeredocRoundTrip(t *testing.T) {
+	tests := []string{
+		"message = <<EOT\nRunbook\nEOT\n",
+		"message = <<EOT\nRunbook\n\nEOT\n",
+		"message = <<EOT\nRunbook $${old} %%{old}\nEOT\n",
+		"message = <<-EOT\n    Runbook\n\n      indented\n    EOT\n",
+		"message = <<EOT\r\nRunbook\r\nEOT\r\n",
+		"message = <<EOT\nEOT\n",
+	}
+
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			// Encoding the value of a heredoc gives back its body, so that patching it repeatedly is stable
+			for i := 0; i < 2; i++ {
+				literal, found, err := hclParseHeredoc(src, strings.Index(src, "<<"))
+				if err != nil || !found {
+					t.Fatalf("got found %v, error %v", found, err)
+				}
+
+				body := literal.encode(literal.value)
+				if want := src[literal.start:literal.end]; body != want {
+					t.Fatalf("got %q, want %q", body, want)
+				}
+				src = src[:literal.start] + body + src[literal.end:]
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+type journalEntry struct {
+	Time     time.Time          `json:"time"`
+	Wave     int                `json:"wave"`
+	Ref      migrate.ObjectRef  `json:"ref"`
+	Path     string             `json:"path"`
+	Outcome  string             `json:"outcome"`
+	NewRef   *migrate.ObjectRef `json:"new_ref,omitempty"`
+	Mismatch bool               `json:"mismatch,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+func newJournalEntry(res migrate.UpdateResult) journalEntry {
+	entry := journalEntry{
+		Time:     time.Now().UTC(),
+		Wave:     res.Wave,
+		Ref:      res.Ref,
+		Path:     res.Path,
+		Outcome:  res.Outcome(),
+		NewRef:   res.NewRef,
+		Mismatch: res.Mismatch,
+	}
+	if res.Err != nil {
+		entry.Error = res.Err.Error()
+	}
+
+	return entry
+}
+
+// journal appends one JSON line per processed object.
+// A journal without file discards all entries.
+type journal struct {
+	file *os.File
+}
+
+func openJournal(path string) (*journal, error) {
+	if path == "" {
+		return &journal{}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+
+	return &journal{file: file}, nil
+}
+
+func (j *journal) record(entry journalEntry) error {
+	if j.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry for %s %s: %w", entry.Ref.Type, entry.Ref.ID, err)
+	}
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry for %s %s: %w", entry.Ref.Type, entry.Ref.ID, err)
+	}
+
+	return nil
+}
+
+func (j *journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const (
+	skipAlertingPolicy  = migrate.SkipAlerting
+	deferAlertingPolicy = migrate.DeferAlerting
+	forceAlertingPolicy = migrate.ForceAlerting
+)
+
+type alertingOptions struct {
+	policy        string
+	deferInterval time.Duration
+	deferTimeout  time.Duration
+}
+
+func (opts alertingOptions) validate() error {
+	switch opts.policy {
+	case skipAlertingPolicy, forceAlertingPolicy:
+		return nil
+	case deferAlertingPolicy:
+		if opts.deferInterval <= 0 {
+			return fmt.Errorf("invalid defer interval %s, it must be positive", opts.deferInterval)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown alerting policy: %s", opts.policy)
+	}
+}
+
+// monitorFieldOptions selects the monitor fields sent on update, and validated over the remote monitors.
+type monitorFieldOptions struct {
+	fields  []string
+	skipped []string
+}
+
+func addMonitorFieldFlags(cmd *cobra.Command, opts *monitorFieldOptions) {
+	cmd.Flags().StringSliceVar(&opts.fields, "monitor-fields", migrate.MutableMonitorFields, "Monitor fields sent on update")
+	cmd.Flags().StringSliceVar(&opts.skipped, "skip-monitor-fields", nil, "Monitor fields never sent on update")
+}
+
+func (opts monitorFieldOptions) fieldSet() (migrate.MonitorFieldSet, error) {
+	return migrate.NewMonitorFieldSet(opts.fields, opts.skipped)
+}
@@ -2,141 +2,159 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"strings"
+	"io"
+	"time"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/spf13/cobra"
 
 	"github.com/DataDog/migrate-tool/pkg/config"
-	"github.com/DataDog/migrate-tool/pkg/patcher/ksm"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+
+	// Built-in patchers register themselves
+	_ "github.com/DataDog/migrate-tool/pkg/patcher/external"
+	_ "github.com/DataDog/migrate-tool/pkg/patcher/jsonpatch"
+	_ "github.com/DataDog/migrate-tool/pkg/patcher/ksm"
+	_ "github.com/DataDog/migrate-tool/pkg/patcher/rules"
+	_ "github.com/DataDog/migrate-tool/pkg/patcher/script"
 )
 
-type patcher interface {
-	PatchMonitor(context.Context, config.Config, *datadogV1.Monitor) (bool, error)
-	PatchDashboard(context.Context, config.Config, *datadogV1.Dashboard) (bool, error)
-}
-
 func newPatchCommand(config *config.Config) *cobra.Command {
-	var inputDirectory, patcherID string
+	var inputDirectory, terraformDirectory, bundlePath, patcherID, pipelinePath string
+	var autoCommit, list, stopOnError bool
+	reportOpts := reportOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "patch [input files]",
 		Short: "Patch all specified datadog objects in input files using selected patcher",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var patcher patcher
+			if list {
+				return listPatchers()
+			}
 
-			switch strings.ToLower(patcherID) {
-			case "ksm-to-core":
-				patcher = ksm.Patcher{}
-			default:
+			patcher, info, err := newPatcher(*config, patcherID, pipelinePath, stopOnError)
+			if err != nil {
 				cmd.Usage()
-				return fmt.Errorf("missing or unknown patcher %s", patcherID)
+				return err
+			}
+			if err := reportOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+
+			if err := useBundle(bundlePath, inputDirectory); err != nil {
+				return err
 			}
 
-			return patch(cmd.Context(), *config, inputDirectory, patcher)
+			report := newRunReport("patch")
+			report.Patcher, report.PatcherVersion = info.Name, info.Version
+			// With --terraform only, objects are not patched
+			if terraformDirectory == "" || cmd.Flags().Changed("input") {
+				err = patch(cmd.Context(), *config, inputDirectory, info.Name, patcher, report)
+			}
+			if terraformDirectory != "" {
+				err = errors.Join(err, patchTerraform(cmd.Context(), *config, terraformDirectory, patcher, report))
+			}
+			if closer, ok := patcher.(io.Closer); ok {
+				err = errors.Join(err, closer.Close())
+			}
+
+			if autoCommit {
+				message := fmt.Sprintf("Patch %d objects with %s\n\n%s", report.outcomes()[patchedOutcome], info.Name, report.summary())
+				if commitErr := gitCommit(inputDirectory, message); commitErr != nil {
+					err = errors.Join(err, commitErr)
+				}
+			}
+
+			if reportErr := report.write(reportOpts); reportErr != nil {
+				return errors.Join(err, reportErr)
+			}
+			return err
 		},
 	}
 
-	cmd.Flags().StringVarP(&patcherID, "patcher", "p", "", "Name of the patcher to use")
+	cmd.Flags().StringVarP(&patcherID, "patcher", "p", "", "Name of the patcher to use, or comma separated names of patchers to chain")
+	cmd.Flags().StringVar(&pipelinePath, "pipeline", "", "Pipeline file listing the patchers to chain")
+	cmd.Flags().BoolVar(&stopOnError, "stop-on-error", false, "Stop the chain of patchers on an object at the first patcher failing on it")
+	cmd.Flags().BoolVar(&list, "list", false, "List the available patchers")
 	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().StringVar(&bundlePath, "bundle", "", "Verify and extract this bundle into the input folder before patching")
+	cmd.Flags().StringVar(&terraformDirectory, "terraform", "", "Also patch the Datadog resources of the Terraform files in this folder")
+	cmd.Flags().BoolVar(&autoCommit, "auto-commit", false, "Commit the input folder with git after patching")
+	addReportFlags(cmd, &reportOpts)
 
 	return cmd
 }
 
-type patchOutput struct {
-	failedPaths  []error
-	patchedPaths []string
-}
-
-func patch(ctx context.Context, cfg config.Config, inputDirectory string, patcher patcher) error {
-	output := patchOutput{}
-	err := filepath.WalkDir(inputDirectory, func(path string, d fs.DirEntry, err error) error {
-		// If d is nil, it means we were not able to go into the root directory.
-		if d == nil {
-			return err
-		}
-
-		// Skip non-regular files.
-		if !d.Type().IsRegular() {
-			return nil
-		}
-
-		// If we fail on a file, we just record the error and continue.
+// newPatcher builds the patcher selected with --patcher, or a chain for several patchers or a pipeline file.
+func newPatcher(cfg config.Config, spec, pipelinePath string, stopOnError bool) (migrate.Patcher, patcher.Info, error) {
+	var specs []string
+	switch {
+	case spec != "" && pipelinePath != "":
+		return nil, patcher.Info{}, fmt.Errorf("--patcher and --pipeline are mutually exclusive")
+	case pipelinePath != "":
+		pipeline, err := patcher.LoadPipeline(pipelinePath)
 		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to walk file at %s, err: %w", path, err))
-			return nil
+			return nil, patcher.Info{}, err
 		}
-
-		// Check file ext and parse file name
-		objType, _, ext, err := parseObjectFileName(d.Name())
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to parse file name at %s, err: %w", path, err))
-			return nil
-		}
-		if ext != jsonExt {
-			return nil
+		specs, stopOnError = pipeline.Patchers, stopOnError || pipeline.StopOnError
+	default:
+		if specs = patcher.SplitSpecs(spec); len(specs) <= 1 {
+			return patcher.FromConfig(cfg, spec)
 		}
+	}
 
-		// We can now process the file.
-		content, err := os.ReadFile(path)
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to read file at %s, err: %w", path, err))
-			return nil
-		}
+	return patcher.NewChain(cfg, specs, stopOnError)
+}
 
-		// Apply the patch
-		var object any
-		var patched bool
-		switch objType {
-		case dashboardObjType:
-			dashboard := &datadogV1.Dashboard{}
-			object = dashboard
-			patched, err = callPatcher(ctx, cfg, content, dashboard, patcher.PatchDashboard)
-
-		case monitorObjType:
-			monitor := &datadogV1.Monitor{}
-			object = monitor
-			patched, err = callPatcher(ctx, cfg, content, monitor, patcher.PatchMonitor)
-		}
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to patch object at %s, err: %w", path, err))
-			return nil
-		}
+type patchOutput struct {
+	failedPaths  []error
+	patchedPaths []string
+}
 
-		// Write the patched object back to FS
-		if patched {
-			newContent, err := json.MarshalIndent(object, "", "\t")
-			if err != nil {
-				output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to marshal patched object at %s, err: %w", path, err))
-				return nil
-			}
-			err = os.WriteFile(path, newContent, 0o660)
-			if err != nil {
-				output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to write patched object at %s, err: %w", path, err))
-				return nil
-			}
+func patch(ctx context.Context, cfg config.Config, inputDirectory, patcherName string, patcher migrate.Patcher, report *runReport) error {
+	store := migrate.NewStore(inputDirectory)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		return err
+	}
 
-			touchedPath := strings.Replace(path, jsonExt, touchedExt, 1)
-			err = os.WriteFile(touchedPath, []byte{}, 0o660)
-			if err != nil {
-				// We still report err at `path` and not `touchedPath`
-				output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to write touched file at %s, err: %w", path, err))
-				return nil
-			}
+	output := patchOutput{}
+	start := time.Now()
+	failures, err := store.PatchAll(ctx, cfg, manifest, patcher, patcherName, func(res migrate.PatchResult) {
+		ref := res.Ref
+		switch {
+		case res.Err != nil:
+			output.failedPaths = append(output.failedPaths, res.Err)
+			report.add(&ref, res.Path, failedOutcome, res.Err, start)
+		case res.Patched:
+			output.patchedPaths = append(output.patchedPaths, res.Path)
+			report.add(&ref, res.Path, patchedOutcome, nil, start)
+		default:
+			report.add(&ref, res.Path, unchangedOutcome, nil, start)
+		}
 
-			output.patchedPaths = append(output.patchedPaths, path)
+		// Chained patchers skipped on the object
+		for _, skipped := range res.Skipped {
+			err := fmt.Errorf("failed to patch object at %s, err: %w", res.Path, skipped)
+			output.failedPaths = append(output.failedPaths, err)
+			report.addFailures([]error{err})
 		}
-		return nil
+		start = time.Now()
 	})
+	output.failedPaths = append(failures, output.failedPaths...)
+	report.addFailures(failures)
 	if err != nil {
 		return err
 	}
 
+	if err := manifest.Save(); err != nil {
+		output.failedPaths = append(output.failedPaths, err)
+		report.addFailures([]error{err})
+	}
+
 	fmt.Printf("\nFinished patching %s\n", inputDirectory)
 	fmt.Printf("Patched files: %d\n", len(output.patchedPaths))
 	fmt.Printf("Patched failures: %d\n", len(output.failedPaths))
@@ -150,18 +168,3 @@ func patch(ctx context.Context, cfg config.Config, inputDirectory string, patche
 	}
 	return nil
 }
-
-type patchFunc[T any] func(context.Context, config.Config, *T) (bool, error)
-
-func callPatcher[T any](ctx context.Context, cfg config.Config, content []byte, obj *T, patchFunc patchFunc[T]) (bool, error) {
-	if err := json.Unmarshal(content, obj); err != nil {
-		return false, fmt.Errorf("failed to unmarshal JSON, err: %w", err)
-	}
-
-	patched, err := patchFunc(ctx, cfg, obj)
-	if err != nil {
-		return false, fmt.Errorf("failed to patch object, err: %w", err)
-	}
-
-	return patched, nil
-}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+)
+
+func newPatchersCommand(_ *config.Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "patchers",
+		Short: "List the available patchers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listPatchers()
+		},
+	}
+
+	return cmd
+}
+
+func listPatchers() error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tOBJECT TYPES\tDESCRIPTION")
+	for _, info := range patcher.List() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Usage(), info.Version, strings.Join(info.ObjectTypes, ","), info.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+type remapKey struct {
+	from  migrate.ObjectRef
+	toOrg int
+}
+
+// idRemap maps the reference of an object to the reference of the object replacing it in a given org.
+// The target org is the same as the source one for recreated objects, and differs for copied objects.
+type idRemap map[remapKey]migrate.ObjectRef
+
+type serializedRemapEntry struct {
+	From migrate.ObjectRef `json:"FROM"`
+	To   migrate.ObjectRef `json:"TO"`
+}
+
+func loadIDRemap(path string) (idRemap, error) {
+	remap := idRemap{}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return remap, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remap file %s: %w", path, err)
+	}
+
+	entries := []serializedRemapEntry{}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal remap file %s: %w", path, err)
+	}
+
+	for _, entry := range entries {
+		remap.set(entry.From, entry.To)
+	}
+
+	return remap, nil
+}
+
+func (remap idRemap) set(from, to migrate.ObjectRef) {
+	remap[remapKey{from: from, toOrg: to.OrgID}] = to
+}
+
+func (remap idRemap) get(from migrate.ObjectRef, toOrg int) (migrate.ObjectRef, bool) {
+	to, found := remap[remapKey{from: from, toOrg: toOrg}]
+	return to, found
+}
+
+func (remap idRemap) save(path string) error {
+	entries := make([]serializedRemapEntry, 0, len(remap))
+	for key, to := range remap {
+		entries = append(entries, serializedRemapEntry{From: key.from, To: to})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].From != entries[j].From {
+			return entries[i].From.Less(entries[j].From)
+		}
+		return entries[i].To.Less(entries[j].To)
+	})
+
+	content, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal remap file %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, content, 0o660); err != nil {
+		return fmt.Errorf("failed to write remap file %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const (
+	failedOutcome    = migrate.FailedOutcome
+	updatedOutcome   = migrate.UpdatedOutcome
+	recreatedOutcome = migrate.RecreatedOutcome
+	createdOutcome   = "created"
+	dumpedOutcome    = "dumped"
+	existingOutcome  = "existing"
+	patchedOutcome   = "patched"
+	unchangedOutcome = "unchanged"
+	skippedOutcome   = migrate.SkippedOutcome
+	alertingOutcome  = migrate.AlertingOutcome
+	terraformOutcome = "skipped-terraform"
+)
+
+const (
+	jsonReportFormat     = "json"
+	junitReportFormat    = "junit"
+	markdownReportFormat = "markdown"
+)
+
+type reportOptions struct {
+	path   string
+	format string
+}
+
+func addReportFlags(cmd *cobra.Command, opts *reportOptions) {
+	cmd.Flags().StringVar(&opts.path, "report", "", "Path to the run report")
+	cmd.Flags().StringVar(&opts.format, "report-format", jsonReportFormat, "Format of the run report: json, junit or markdown")
+}
+
+func (opts reportOptions) validate() error {
+	switch opts.format {
+	case jsonReportFormat, junitReportFormat, markdownReportFormat:
+		return nil
+	default:
+		return fmt.Errorf("unknown report format: %s", opts.format)
+	}
+}
+
+type reportEntry struct {
+	Ref      *migrate.ObjectRef `json:"ref,omitempty"`
+	Path     string             `json:"path,omitempty"`
+	Action   string             `json:"action"`
+	Outcome  string             `json:"outcome"`
+	Error    string             `json:"error,omitempty"`
+	Duration time.Duration      `json:"duration_ns"`
+}
+
+func (entry reportEntry) name() string {
+	if entry.Ref != nil {
+		return entry.Ref.String()
+	}
+	return entry.Path
+}
+
+// runReport collects the outcome of every object processed by a command.
+type runReport struct {
+	Command        string        `json:"command"`
+	Patcher        string        `json:"patcher,omitempty"`
+	PatcherVersion string        `json:"patcher_version,omitempty"`
+	StartedAt      time.Time     `json:"started_at"`
+	Duration       time.Duration `json:"duration_ns"`
+	Entries        []reportEntry `json:"entries"`
+}
+
+func newRunReport(command string) *runReport {
+	return &runReport{
+		Command:   command,
+		StartedAt: time.Now().UTC(),
+		Entries:   []reportEntry{},
+	}
+}
+
+func (report *runReport) add(ref *migrate.ObjectRef, path, outcome string, err error, start time.Time) {
+	entry := reportEntry{
+		Ref:      ref,
+		Path:     path,
+		Action:   report.Command,
+		Outcome:  outcome,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		entry.Outcome = failedOutcome
+		entry.Error = err.Error()
+	}
+
+	report.Entries = append(report.Entries, entry)
+}
+
+// addFailures records errors not attached to a specific object.
+func (report *runReport) addFailures(errs []error) {
+	for _, err := range errs {
+		report.Entries = append(report.Entries, reportEntry{
+			Action:  report.Command,
+			Outcome: failedOutcome,
+			Error:   err.Error(),
+		})
+	}
+}
+
+func (report *runReport) outcomes() map[string]int {
+	counts := map[string]int{}
+	for _, entry := range report.Entries {
+		counts[entry.Outcome]++
+	}
+	return counts
+}
+
+// summary lists the objects by outcome, one per line, for commit messages.
+func (report *runReport) summary() string {
+	lines := []string{}
+	for _, entry := range report.Entries {
+		if entry.Outcome == unchangedOutcome || entry.Outcome == existingOutcome {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s", entry.Outcome, entry.name()))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// write renders the report in the selected format. Without path, it does nothing.
+func (report *runReport) write(opts reportOptions) error {
+	if opts.path == "" {
+		return nil
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	var content []byte
+	var err error
+	switch opts.format {
+	case jsonReportFormat:
+		content, err = json.MarshalIndent(report, "", "\t")
+	case junitReportFormat:
+		content, err = report.junit()
+	case markdownReportFormat:
+		content = report.markdown()
+	default:
+		err = fmt.Errorf("unknown report format: %s", opts.format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to render report %s: %w", opts.path, err)
+	}
+
+	if err := os.WriteFile(opts.path, content, 0o660); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", opts.path, err)
+	}
+
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	Output    string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+func (report *runReport) junit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      report.Command,
+		Tests:     len(report.Entries),
+		Time:      report.Duration.Seconds(),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+	}
+
+	for _, entry := range report.Entries {
+		testCase := junitTestCase{
+			Name:   entry.name(),
+			Time:   entry.Duration.Seconds(),
+			Output: entry.Outcome,
+		}
+		if entry.Ref != nil {
+			testCase.ClassName = report.Command + "." + entry.Ref.Type
+		} else {
+			testCase.ClassName = report.Command
+		}
+
+		switch entry.Outcome {
+		case failedOutcome:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: entry.Error}
+		case skippedOutcome, alertingOutcome, terraformOutcome:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: entry.Error}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), content...), nil
+}
+
+func (report *runReport) markdown() []byte {
+	sb := strings.Builder{}
+
+	fmt.Fprintf(&sb, "## migrate %s\n\n", report.Command)
+	fmt.Fprintf(&sb, "Started at %s, took %s.\n\n", report.StartedAt.Format(time.RFC3339), report.Duration.Round(time.Millisecond))
+	switch {
+	case report.PatcherVersion != "":
+		fmt.Fprintf(&sb, "Patcher `%s` version %s.\n\n", report.Patcher, report.PatcherVersion)
+	case report.Patcher != "":
+		// Chains of patchers have no version of their own
+		fmt.Fprintf(&sb, "Patchers `%s`.\n\n", report.Patcher)
+	}
+
+	counts := report.outcomes()
+	outcomes := make([]string, 0, len(counts))
+	for outcome := range counts {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+
+	sb.WriteString("| Outcome | Objects |\n|---|---|\n")
+	for _, outcome := range outcomes {
+		fmt.Fprintf(&sb, "| %s | %d |\n", outcome, counts[outcome])
+	}
+
+	if len(report.Entries) > 0 {
+		sb.WriteString("\n| Object | Action | Outcome | Duration | Error |\n|---|---|---|---|---|\n")
+		for _, entry := range report.Entries {
+			fmt.Fprintf(&sb, "| `%s` | %s | %s | %s | %s |\n",
+				entry.name(),
+				entry.Action,
+				entry.Outcome,
+				entry.Duration.Round(time.Millisecond),
+				markdownEscaper.Replace(entry.Error),
+			)
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+var markdownEscaper = strings.NewReplacer("|", "\\|", "\n", " ")
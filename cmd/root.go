@@ -38,7 +38,15 @@ func New(use, short string) *cobra.Command {
 	// Child commands
 	command.AddCommand(newDumpCommand(config))
 	command.AddCommand(newPatchCommand(config))
+	command.AddCommand(newPatchersCommand(config))
 	command.AddCommand(newUpdateCommand(config))
+	command.AddCommand(newStatusCommand(config))
+	command.AddCommand(newCopyCommand(config))
+	command.AddCommand(newGraphCommand(config))
+	command.AddCommand(newUnmuteCommand(config))
+	command.AddCommand(newValidateCommand(config))
+	command.AddCommand(newExportCommand(config))
+	command.AddCommand(newBundleCommand(config))
 
 	return command
 }
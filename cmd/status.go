@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func newStatusCommand(_ *config.Config) *cobra.Command {
+	var inputDirectory string
+	var verbose bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Summarise the state of objects in input directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return status(inputDirectory, verbose)
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "List the status of each object")
+
+	return cmd
+}
+
+var statusOrder = []string{migrate.DumpedStatus, migrate.PatchedStatus, migrate.UpdatedStatus, migrate.VerifiedStatus, migrate.UntrackedStatus}
+
+func status(inputDirectory string, verbose bool) error {
+	manifest, err := migrate.LoadManifest(inputDirectory)
+	if err != nil {
+		return err
+	}
+
+	refsByStatus := map[string][]migrate.ObjectRef{}
+	seen := map[string]struct{}{}
+	failures, err := migrate.NewStore(inputDirectory).Walk(func(path string, ref migrate.ObjectRef) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("failed to read file at %s, err: %s\n", path, err)
+			return
+		}
+
+		status := manifest.Get(ref).Status(migrate.ContentHash(content))
+		refsByStatus[status] = append(refsByStatus[status], ref)
+		seen[ref.String()] = struct{}{}
+	})
+	if err != nil {
+		return err
+	}
+
+	missing := []string{}
+	for key := range manifest.Objects {
+		if _, found := seen[key]; !found {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+
+	fmt.Printf("Objects in %s\n", inputDirectory)
+	for _, status := range statusOrder {
+		refs := refsByStatus[status]
+		fmt.Printf("%-10s %d\n", status+":", len(refs))
+
+		if verbose {
+			sort.Slice(refs, func(i, j int) bool {
+				return refs[i].Less(refs[j])
+			})
+			for _, ref := range refs {
+				state := manifest.Get(ref)
+				if state != nil && state.Patcher != "" {
+					fmt.Printf("  %s (patched by %s)\n", ref, describePatchers(state.Patcher, state.PatcherVersion, state.Patchers))
+				} else {
+					fmt.Printf("  %s\n", ref)
+				}
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		fmt.Printf("Missing files for %d objects in state manifest\n", len(missing))
+		for _, key := range missing {
+			fmt.Println(" ", key)
+		}
+	}
+
+	for _, err := range failures {
+		fmt.Println(err)
+	}
+
+	return nil
+}
+
+// describePatchers describes the patchers that modified an object, in order, or the patcher run on it.
+func describePatchers(patcherName, patcherVersion string, patchers []migrate.PatcherRef) string {
+	if len(patchers) == 0 {
+		return strings.TrimSpace(patcherName + " " + patcherVersion)
+	}
+
+	res := make([]string, 0, len(patchers))
+	for _, patcher := range patchers {
+		res = append(res, strings.TrimSpace(patcher.Name+" "+patcher.Version))
+	}
+	return strings.Join(res, ", ")
+}
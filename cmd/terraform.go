@@ -0,0 +1,537 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const tfExt = ".tf"
+
+// terraformMonitorResource is patched attribute by attribute.
+const terraformMonitorResource = "datadog_monitor"
+
+// terraformPatchedAttributes are the datadog_monitor attributes given to the patcher and written back.
+var terraformPatchedAttributes = []string{migrate.MonitorQueryField, migrate.MonitorNameField, migrate.MonitorMessageField}
+
+// terraformJSONResources are patched through their JSON payload.
+var terraformJSONResources = map[string]struct{ objType, attribute string }{
+	"datadog_dashboard_json": {migrate.DashboardType, "dashboard"},
+	"datadog_monitor_json":   {migrate.MonitorType, "monitor"},
+}
+
+// terraformObjectTypes maps the Terraform resources managing Datadog objects to object types.
+var terraformObjectTypes = map[string]string{
+	"datadog_dashboard":      migrate.DashboardType,
+	"datadog_dashboard_json": migrate.DashboardType,
+	"datadog_monitor":        migrate.MonitorType,
+	"datadog_monitor_json":   migrate.MonitorType,
+}
+
+type terraformPatchOutput struct {
+	failedPaths      []error
+	patchedResources []string
+	warnings         []string
+}
+
+// patchTerraform applies the patcher to the Datadog resources of the Terraform files in the directory.
+// Only the patched string literals are rewritten, the rest of the files is left untouched.
+func patchTerraform(ctx context.Context, cfg config.Config, terraformDirectory string, patcher migrate.Patcher, report *runReport) error {
+	output := terraformPatchOutput{}
+
+	err := filepath.WalkDir(terraformDirectory, func(path string, d fs.DirEntry, err error) error {
+		if d == nil {
+			return err
+		}
+		if err != nil {
+			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to walk file at %s, err: %w", path, err))
+			return nil
+		}
+
+		// Skip hidden folders, such as .terraform with downloaded modules
+		if d.IsDir() && path != terraformDirectory && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || filepath.Ext(path) != tfExt {
+			return nil
+		}
+
+		start := time.Now()
+		patched, warnings, err := patchTerraformFile(ctx, cfg, path, patcher)
+		for _, address := range patched {
+			output.patchedResources = append(output.patchedResources, path+":"+address)
+			report.add(nil, path+":"+address, patchedOutcome, nil, start)
+		}
+		output.warnings = append(output.warnings, warnings...)
+		if err != nil {
+			output.failedPaths = append(output.failedPaths, err)
+			report.add(nil, path, failedOutcome, err, start)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nFinished patching %s\n", terraformDirectory)
+	fmt.Printf("Patched resources: %d\n", len(output.patchedResources))
+	for _, resource := range output.patchedResources {
+		fmt.Println(" ", resource)
+	}
+	if len(output.warnings) > 0 {
+		fmt.Printf("Not patched: %d\n", len(output.warnings))
+		for _, warning := range output.warnings {
+			fmt.Println(" ", warning)
+		}
+	}
+	fmt.Printf("Patched failures: %d\n", len(output.failedPaths))
+	for _, err := range output.failedPaths {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	if len(output.failedPaths) > 0 {
+		return fmt.Errorf("failed to patch some Terraform files")
+	}
+	return nil
+}
+
+// textEdit replaces the text between start and end.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+func applyEdits(src string, edits []textEdit) string {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, edit := range edits {
+		src = src[:edit.start] + edit.text + src[edit.end:]
+	}
+	return src
+}
+
+// patchTerraformFile patches the Terraform file at path.
+// It returns the addresses of the patched resources and the attributes that could not be patched.
+func patchTerraformFile(ctx context.Context, cfg config.Config, path string, patcher migrate.Patcher) ([]string, []string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file at %s, err: %w", path, err)
+	}
+	src := string(content)
+
+	blocks, err := hclResourceBlocks(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Terraform file at %s, err: %w", path, err)
+	}
+
+	var patched, warnings []string
+	var edits []textEdit
+	for _, block := range blocks {
+		var blockEdits []textEdit
+		var blockWarnings []string
+		var err error
+
+		// Chained patchers skipped on the resource are reported as warnings
+		trace := &migrate.PatchTrace{}
+		blockCtx := migrate.WithPatchTrace(ctx, trace)
+		if block.resourceType == terraformMonitorResource {
+			blockEdits, blockWarnings, err = patchTerraformMonitor(blockCtx, cfg, src, block, patcher)
+		} else if resource, found := terraformJSONResources[block.resourceType]; found {
+			blockEdits, blockWarnings, err = patchTerraformJSON(blockCtx, cfg, src, block, resource.objType, resource.attribute, patcher)
+		} else {
+			continue
+		}
+		for _, skipped := range trace.Skipped {
+			blockWarnings = append(blockWarnings, skipped.Error())
+		}
+
+		for _, warning := range blockWarnings {
+			warnings = append(warnings, fmt.Sprintf("%s:%s: %s", path, block.address(), warning))
+		}
+		if err != nil {
+			return nil, warnings, fmt.Errorf("failed to patch %s at %s, err: %w", block.address(), path, err)
+		}
+		if len(blockEdits) > 0 {
+			patched = append(patched, block.address())
+			edits = append(edits, blockEdits...)
+		}
+	}
+
+	if len(edits) == 0 {
+		return nil, warnings, nil
+	}
+
+	if err := os.WriteFile(path, []byte(applyEdits(src, edits)), 0o660); err != nil {
+		return nil, warnings, fmt.Errorf("failed to write patched file at %s, err: %w", path, err)
+	}
+	return patched, warnings, nil
+}
+
+func patchTerraformMonitor(ctx context.Context, cfg config.Config, src string, block hclBlock, patcher migrate.Patcher) ([]textEdit, []string, error) {
+	literals, err := hclAttributeLiterals(src, block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	doc := map[string]any{}
+	for _, attribute := range append(terraformPatchedAttributes, migrate.MonitorTypeField) {
+		literal, found := literals[attribute]
+		switch {
+		case !found:
+		case literal.dynamic:
+			warnings = append(warnings, attribute+" uses interpolations")
+		default:
+			doc[attribute] = literal.value
+		}
+	}
+	if _, found := doc[migrate.MonitorQueryField]; !found {
+		return nil, warnings, nil
+	}
+
+	patched, err := patcher.PatchRaw(ctx, cfg, migrate.MonitorType, doc)
+	if err != nil || !patched {
+		return nil, warnings, err
+	}
+
+	var edits []textEdit
+	for _, attribute := range terraformPatchedAttributes {
+		literal, found := literals[attribute]
+		value, isString := doc[attribute].(string)
+		if !found || literal.dynamic || !isString || value == literal.value {
+			continue
+		}
+		edits = append(edits, textEdit{start: literal.start, end: literal.end, text: literal.encode(value)})
+	}
+	return edits, warnings, nil
+}
+
+func patchTerraformJSON(ctx context.Context, cfg config.Config, src string, block hclBlock, objType, attribute string, patcher migrate.Patcher) ([]textEdit, []string, error) {
+	literals, err := hclAttributeLiterals(src, block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	literal, found := literals[attribute]
+	switch {
+	case !found:
+		return nil, []string{attribute + " is not a string literal"}, nil
+	case literal.dynamic:
+		return nil, []string{attribute + " uses interpolations"}, nil
+	}
+
+	patchedJSON, patched, err := patchJSONText(ctx, cfg, objType, literal.value, patcher)
+	if err != nil || !patched {
+		return nil, nil, err
+	}
+	return []textEdit{{start: literal.start, end: literal.end, text: literal.encode(patchedJSON)}}, nil, nil
+}
+
+// patchJSONText applies the patcher to a JSON object and returns the patched text.
+// When the patcher only changed strings, only these strings are replaced in the text.
+func patchJSONText(ctx context.Context, cfg config.Config, objType, text string, patcher migrate.Patcher) (string, bool, error) {
+	doc, err := migrate.DecodeJSON([]byte(text))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to unmarshal JSON, err: %w", err)
+	}
+	before, _ := migrate.DecodeJSON([]byte(text))
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return "", false, fmt.Errorf("invalid %s: not a JSON object", objType)
+	}
+	patched, err := patcher.PatchRaw(ctx, cfg, objType, obj)
+	if err != nil || !patched {
+		return "", false, err
+	}
+
+	changes := map[string]string{}
+	if collectStringChanges(before, obj, "", changes) {
+		if edits, ok := jsonStringEdits(text, changes); ok {
+			return applyEdits(text, edits), true, nil
+		}
+	}
+
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(obj); err != nil {
+		return "", false, fmt.Errorf("failed to marshal patched JSON, err: %w", err)
+	}
+	return buf.String(), true, nil
+}
+
+// collectStringChanges records the strings changed between before and after, by JSON pointer.
+// It reports false if anything else than strings changed.
+func collectStringChanges(before, after any, path string, changes map[string]string) bool {
+	switch b := before.(type) {
+	case map[string]any:
+		a, ok := after.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range b {
+			afterValue, found := a[key]
+			if !found || !collectStringChanges(value, afterValue, path+"/"+jsonPointerEscape(key), changes) {
+				return false
+			}
+		}
+		return true
+
+	case []any:
+		a, ok := after.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range b {
+			if !collectStringChanges(b[i], a[i], path+"/"+strconv.Itoa(i), changes) {
+				return false
+			}
+		}
+		return true
+
+	case string:
+		a, ok := after.(string)
+		if !ok {
+			return false
+		}
+		if a != b {
+			changes[path] = a
+		}
+		return true
+
+	default:
+		return reflect.DeepEqual(before, after)
+	}
+}
+
+func jsonPointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+type jsonFrame struct {
+	object    bool
+	key       string
+	index     int
+	expectKey bool
+}
+
+// jsonStringEdits locates the changed strings in the JSON text and returns the edits replacing them.
+func jsonStringEdits(text string, changes map[string]string) ([]textEdit, bool) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	edits := []textEdit{}
+	stack := []jsonFrame{}
+	path := func() string {
+		b := strings.Builder{}
+		for _, frame := range stack {
+			b.WriteString("/")
+			if frame.object {
+				b.WriteString(jsonPointerEscape(frame.key))
+			} else {
+				b.WriteString(strconv.Itoa(frame.index))
+			}
+		}
+		return b.String()
+	}
+	advance := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := &stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch value := token.(type) {
+		case json.Delim:
+			switch value {
+			case '{', '[':
+				stack = append(stack, jsonFrame{object: value == '{', expectKey: value == '{'})
+			default:
+				stack = stack[:len(stack)-1]
+				advance()
+			}
+
+		case string:
+			if len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey {
+				stack[len(stack)-1].key = value
+				stack[len(stack)-1].expectKey = false
+				continue
+			}
+
+			if newValue, found := changes[path()]; found {
+				start := int(offset) + strings.IndexByte(text[offset:], '"')
+				edits = append(edits, textEdit{start: start, end: int(decoder.InputOffset()), text: jsonQuote(newValue)})
+			}
+			advance()
+
+		default:
+			advance()
+		}
+	}
+
+	return edits, len(edits) == len(changes)
+}
+
+func jsonQuote(s string) string {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// terraformOwnerOptions configures how update recognises objects managed by Terraform.
+type terraformOwnerOptions struct {
+	include    bool
+	tags       []string
+	statePaths []string
+	// Also match "Managed by Terraform" in descriptions and messages, which is only a convention
+	text bool
+}
+
+// defaultTerraformOwnerTags are the tags commonly set on objects managed by Terraform.
+var defaultTerraformOwnerTags = []string{"terraform:true", "managed-by:terraform", "managed_by:terraform"}
+
+// terraformOwners finds the objects managed by Terraform.
+type terraformOwners struct {
+	tags map[string]struct{}
+	text bool
+	// Objects listed in Terraform state files, by type and ID
+	stateRefs map[migrate.ObjectRef]string
+}
+
+func newTerraformOwners(opts terraformOwnerOptions) (*terraformOwners, error) {
+	owners := &terraformOwners{
+		tags:      map[string]struct{}{},
+		text:      opts.text,
+		stateRefs: map[migrate.ObjectRef]string{},
+	}
+	for _, tag := range opts.tags {
+		owners.tags[strings.ToLower(strings.TrimSpace(tag))] = struct{}{}
+	}
+
+	for _, path := range opts.statePaths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Terraform state at %s, err: %w", path, err)
+		}
+
+		state := struct {
+			Resources []struct {
+				Mode      string `json:"mode"`
+				Type      string `json:"type"`
+				Instances []struct {
+					Attributes struct {
+						ID string `json:"id"`
+					} `json:"attributes"`
+				} `json:"instances"`
+			} `json:"resources"`
+		}{}
+		if err := json.Unmarshal(content, &state); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Terraform state at %s, err: %w", path, err)
+		}
+
+		for _, resource := range state.Resources {
+			objType, found := terraformObjectTypes[resource.Type]
+			if !found || resource.Mode != "managed" {
+				continue
+			}
+			for _, instance := range resource.Instances {
+				owners.stateRefs[migrate.ObjectRef{Type: objType, ID: instance.Attributes.ID}] = path
+			}
+		}
+	}
+
+	return owners, nil
+}
+
+// owner returns why the object is considered managed by Terraform, or an empty string.
+func (owners *terraformOwners) owner(ref migrate.ObjectRef, content []byte) (string, error) {
+	if path, found := owners.stateRefs[migrate.ObjectRef{Type: ref.Type, ID: ref.ID}]; found {
+		return "listed in " + path, nil
+	}
+
+	doc, err := migrate.ParseDocument(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	tags, _ := doc[migrate.MonitorTagsField].([]any)
+	for _, tag := range tags {
+		if s, ok := tag.(string); ok {
+			if _, found := owners.tags[strings.ToLower(s)]; found {
+				return "tagged " + s, nil
+			}
+		}
+	}
+
+	if !owners.text {
+		return "", nil
+	}
+	for _, field := range []string{"description", migrate.MonitorMessageField} {
+		if s, ok := doc[field].(string); ok && strings.Contains(strings.ToLower(s), "managed by terraform") {
+			return field + " mentions Terraform", nil
+		}
+	}
+
+	return "", nil
+}
+
+// terraformOwnedObjects returns the objects managed by Terraform, with the reason.
+// Files that cannot be checked are removed from the files to update and returned as errors.
+func terraformOwnedObjects(files map[migrate.ObjectRef]string, opts terraformOwnerOptions) (map[migrate.ObjectRef]string, []error, error) {
+	owners, err := newTerraformOwners(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owned := map[migrate.ObjectRef]string{}
+	var failures []error
+	for ref, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to read file at %s, err: %w", path, err))
+			delete(files, ref)
+			continue
+		}
+
+		reason, err := owners.owner(ref, content)
+		if err != nil {
+			failures = append(failures, err)
+			delete(files, ref)
+			continue
+		}
+		if reason != "" {
+			owned[ref] = reason
+		}
+	}
+
+	return owned, failures, nil
+}
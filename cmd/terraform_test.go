@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+func TestJSONStringEdits(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		changes map[string]string
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:    "nested string",
+			text:    `{"widgets": [{"definition": {"q": "a"}}, {"definition": {"q": "a"}}]}`,
+			changes: map[string]string{"/widgets/1/definition/q": "b"},
+			want:    `{"widgets": [{"definition": {"q": "a"}}, {"definition": {"q": "b"}}]}`,
+			wantOK:  true,
+		},
+		{
+			name:    "keys equal to values and escaped keys",
+			text:    `{"q": "q", "a/b": {"~": "q"}}`,
+			changes: map[string]string{"/q": "x", "/a~1b/~0": "y"},
+			want:    `{"q": "x", "a/b": {"~": "y"}}`,
+			wantOK:  true,
+		},
+		{
+			name:    "escaped quotes and HTML characters",
+			text:    "{\n  \"a\": \"say \\\"hi\\\" \\u003c\",\n  \"b\": 1\n}",
+			changes: map[string]string{"/a": `say "bye" <&>`},
+			want:    "{\n  \"a\": \"say \\\"bye\\\" <&>\",\n  \"b\": 1\n}",
+			wantOK:  true,
+		},
+		{
+			name:    "strings after numbers, booleans and nulls",
+			text:    `[1, true, null, "a", {"b": [2.5, "c"]}]`,
+			changes: map[string]string{"/3": "x", "/4/b/1": "y"},
+			want:    `[1, true, null, "x", {"b": [2.5, "y"]}]`,
+			wantOK:  true,
+		},
+		{
+			name:    "missing string",
+			text:    `{"a": "b"}`,
+			changes: map[string]string{"/c": "d"},
+			want:    `{"a": "b"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits, ok := jsonStringEdits(tt.text, tt.changes)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v", ok)
+			}
+			if got := applyEdits(tt.text, edits); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// stringReplacer replaces a substring in all the strings of a document.
+type stringReplacer struct {
+	old, new string
+}
+
+func (r stringReplacer) PatchRaw(_ context.Context, _ config.Config, _ string, doc map[string]any) (bool, error) {
+	var replace func(value any) (any, bool)
+	replace = func(value any) (any, bool) {
+		switch v := value.(type) {
+		case string:
+			return strings.ReplaceAll(v, r.old, r.new), strings.Contains(v, r.old)
+		case []any:
+			patched := false
+			for i := range v {
+				var changed bool
+				v[i], changed = replace(v[i])
+				patched = patched || changed
+			}
+			return v, patched
+		case map[string]any:
+			patched := false
+			for key := range v {
+				var changed bool
+				v[key], changed = replace(v[key])
+				patched = patched || changed
+			}
+			return v, patched
+		}
+		return value, false
+	}
+	_, patched := replace(doc)
+	return patched, nil
+}
+
+func TestPatchTerraformFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		want         string
+		wantPatched  []string
+		wantWarnings []string
+	}{
+		{
+			name: "monitor attributes",
+			src: `resource "datadog_monitor" "a" {
+  name    = "old \"name\"" # old
+  type    = "metric alert"
+  query   = "avg:old{*} > 1"
+  message = <<-EOT
+    Runbook for old
+    EOT
+}
+`,
+			want: `resource "datadog_monitor" "a" {
+  name    = "new \"name\"" # old
+  type    = "metric alert"
+  query   = "avg:new{*} > 1"
+  message = <<-EOT
+    Runbook for new
+    EOT
+}
+`,
+			wantPatched: []string{"datadog_monitor.a"},
+		},
+		{
+			name: "monitor with interpolations",
+			src: `resource "datadog_monitor" "a" {
+  name  = "old ${var.env}"
+  query = "avg:old{*} > 1"
+}
+`,
+			want: `resource "datadog_monitor" "a" {
+  name  = "old ${var.env}"
+  query = "avg:new{*} > 1"
+}
+`,
+			wantPatched:  []string{"datadog_monitor.a"},
+			wantWarnings: []string{"datadog_monitor.a: name uses interpolations"},
+		},
+		{
+			name: "raw JSON dashboard",
+			src: `resource "datadog_dashboard_json" "a" {
+  dashboard = <<EOT
+{
+  "title": "old",
+  "widgets": [{"definition": {"type": "note", "content": "$${old}"}}]
+}
+EOT
+}
+`,
+			want: `resource "datadog_dashboard_json" "a" {
+  dashboard = <<EOT
+{
+  "title": "new",
+  "widgets": [{"definition": {"type": "note", "content": "$${new}"}}]
+}
+EOT
+}
+`,
+			wantPatched: []string{"datadog_dashboard_json.a"},
+		},
+		{
+			name: "jsonencode dashboard",
+			src: `resource "datadog_dashboard_json" "a" {
+  dashboard = jsonencode({
+    title = "old"
+  })
+}
+`,
+			want: `resource "datadog_dashboard_json" "a" {
+  dashboard = jsonencode({
+    title = "old"
+  })
+}
+`,
+			wantWarnings: []string{"datadog_dashboard_json.a: dashboard is not a string literal"},
+		},
+		{
+			name: "other resources",
+			src: `resource "datadog_synthetics_test" "a" {
+  name = "old"
+}
+`,
+			want: `resource "datadog_synthetics_test" "a" {
+  name = "old"
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "main.tf")
+			if err := os.WriteFile(path, []byte(tt.src), 0o660); err != nil {
+				t.Fatal(err)
+			}
+
+			patched, warnings, err := patchTerraformFile(context.Background(), config.Config{}, path, stringReplacer{old: "old", new: "new"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", content, tt.want)
+			}
+			if len(patched) > 0 || len(tt.wantPatched) > 0 {
+				if !reflect.DeepEqual(patched, tt.wantPatched) {
+					t.Errorf("got patched %q, want %q", patched, tt.wantPatched)
+				}
+			}
+			for i := range warnings {
+				warnings[i] = strings.TrimPrefix(warnings[i], path+":")
+			}
+			if len(warnings) > 0 || len(tt.wantWarnings) > 0 {
+				if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+					t.Errorf("got warnings %q, want %q", warnings, tt.wantWarnings)
+				}
+			}
+		})
+	}
+}
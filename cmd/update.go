@@ -1,164 +1,335 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
-	"log"
-	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/spf13/cobra"
 
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/DataDog/migrate-tool/pkg/client"
 	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
 )
 
 func newUpdateCommand(config *config.Config) *cobra.Command {
-	var inputDirectory string
-	var updateAll bool
+	var inputDirectory, bundlePath string
+	fieldOpts := monitorFieldOptions{}
+	opts := updateOptions{}
+	reportOpts := reportOptions{}
+	auditOpts := auditOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "update [input files]",
-		Short: "Update all (touched) files in input directory",
+		Short: "Update all patched files in input directory",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return update(cmd.Context(), *config, inputDirectory, updateAll)
+			opts.waves.input = bufio.NewReader(cmd.InOrStdin())
+			opts.waves.output = cmd.OutOrStdout()
+
+			fields, err := fieldOpts.fieldSet()
+			if err != nil {
+				cmd.Usage()
+				return err
+			}
+			opts.monitorFields = fields
+
+			if err := opts.alerting.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+			if err := reportOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+			if err := auditOpts.validate(); err != nil {
+				cmd.Usage()
+				return err
+			}
+
+			if err := useBundle(bundlePath, inputDirectory); err != nil {
+				return err
+			}
+
+			auditor, err := newAuditor(*config, auditOpts)
+			if err != nil {
+				return err
+			}
+
+			report := newRunReport("update")
+			err = update(cmd.Context(), *config, inputDirectory, opts, report, auditor)
+			if auditErr := auditor.Close(cmd.Context()); auditErr != nil {
+				err = errors.Join(err, auditErr)
+			}
+			if reportErr := report.write(reportOpts); reportErr != nil {
+				return errors.Join(err, reportErr)
+			}
+			return err
 		},
 	}
 
 	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
-	cmd.Flags().BoolVarP(&updateAll, "update-all", "u", false, "Update all files, not just touched ones")
+	cmd.Flags().StringVar(&bundlePath, "bundle", "", "Verify and extract this bundle into the input folder before updating")
+	cmd.Flags().BoolVarP(&opts.updateAll, "update-all", "u", false, "Update all files, not just patched ones")
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only update files changed or added since this git ref")
+	addMonitorFieldFlags(cmd, &fieldOpts)
+	cmd.Flags().BoolVar(&opts.createMissing, "create-missing", false, "Recreate objects that no longer exist in Datadog")
+	cmd.Flags().StringVar(&opts.remapFilePath, "remap-file", "id-remap.json", "Path to the ID remap file written when objects are recreated")
+	cmd.Flags().BoolVar(&opts.validate, "validate", true, "Validate all monitors with the Datadog API before the first update")
+	cmd.Flags().BoolVar(&opts.verify, "verify", false, "Fetch objects after update and check they match local files")
+	cmd.Flags().StringVar(&opts.journalFilePath, "journal", "", "Path to a JSONL journal recording the outcome of each object")
+	cmd.Flags().StringVar(&opts.waves.size, "wave-size", "", "Number (e.g. 50) or percentage (e.g. 10%) of objects updated per wave")
+	cmd.Flags().BoolVar(&opts.waves.byOrg, "wave-by-org", false, "Never mix objects from different orgs in a wave")
+	cmd.Flags().DurationVar(&opts.waves.pause, "wave-pause", 0, "Time to wait between waves")
+	cmd.Flags().BoolVar(&opts.waves.confirm, "wave-confirm", false, "Ask for confirmation between waves")
+	cmd.Flags().Float64Var(&opts.waves.maxFailureRate, "max-failure-rate", 1, "Halt when the failure rate of a wave exceeds this ratio (0-1)")
+	cmd.Flags().Float64Var(&opts.waves.maxMismatchRate, "max-mismatch-rate", 1, "Halt when the verification mismatch rate of a wave exceeds this ratio (0-1)")
+	cmd.Flags().DurationVar(&opts.mute.during, "mute-during", 0, "Mute each monitor with a downtime of this duration before updating it")
+	cmd.Flags().DurationVar(&opts.mute.settle, "mute-settle", 0, "Cancel the downtimes of each wave once this settle period has passed after it, instead of letting them expire")
+	cmd.Flags().StringVar(&opts.alerting.policy, "alerting-policy", forceAlertingPolicy, "What to do with alerting monitors: skip, defer (retry until OK) or force")
+	cmd.Flags().DurationVar(&opts.alerting.deferInterval, "defer-interval", time.Minute, "Time between retries of deferred alerting monitors")
+	cmd.Flags().DurationVar(&opts.alerting.deferTimeout, "defer-timeout", 30*time.Minute, "Time after which deferred alerting monitors are skipped")
+	cmd.Flags().BoolVar(&opts.terraform.include, "include-terraform-owned", false, "Also update objects managed by Terraform")
+	cmd.Flags().StringSliceVar(&opts.terraform.tags, "terraform-owner-tags", defaultTerraformOwnerTags, "Tags marking objects managed by Terraform")
+	cmd.Flags().StringSliceVar(&opts.terraform.statePaths, "terraform-state", nil, "Terraform state files listing managed objects")
+	cmd.Flags().BoolVar(&opts.terraform.text, "terraform-owner-text", false, "Also consider objects whose message or description mentions \"Managed by Terraform\" managed by Terraform")
+	addReportFlags(cmd, &reportOpts)
+	addAuditFlags(cmd, &auditOpts)
 
 	return cmd
 }
 
+type updateOptions struct {
+	updateAll       bool
+	monitorFields   migrate.MonitorFieldSet
+	createMissing   bool
+	remapFilePath   string
+	verify          bool
+	journalFilePath string
+	waves           waveOptions
+	mute            muteOptions
+	alerting        alertingOptions
+	validate        bool
+	since           string
+	terraform       terraformOwnerOptions
+}
+
 type updateOutput struct {
-	failedPaths  []error
-	updatedPaths []string
+	failedPaths   []error
+	updatedPaths  []string
+	recreatedRefs []migrate.ObjectRef
+	mismatchPaths []string
+	skippedRefs   []migrate.ObjectRef
+	alertingRefs  []migrate.ObjectRef
+	terraformRefs map[migrate.ObjectRef]string
+	haltErr       error
 }
 
-func update(ctx context.Context, cfg config.Config, inputDirectory string, updateAll bool) error {
-	output := updateOutput{}
+// runOptions returns the options of the library run, without the hooks of the command.
+func (opts updateOptions) runOptions() migrate.RunOptions {
+	return migrate.RunOptions{
+		All:            opts.updateAll || opts.since != "",
+		Validate:       opts.validate,
+		CreateMissing:  opts.createMissing,
+		Verify:         opts.verify,
+		AlertingPolicy: opts.alerting.policy,
+		DeferInterval:  opts.alerting.deferInterval,
+		DeferTimeout:   opts.alerting.deferTimeout,
+		MuteDuring:     opts.mute.during,
+		MuteSettle:     opts.mute.settle,
+		Waves: func(refs []migrate.ObjectRef) ([][]migrate.ObjectRef, error) {
+			return planWaves(refs, opts.waves)
+		},
+		BeforeWave: opts.waves.waitNextWave,
+		AfterWave:  opts.waves.check,
+	}
+}
 
-	currentDir := ""
-	filesToUpdate := map[objectRef]string{}
-	err := filepath.WalkDir(inputDirectory, func(path string, d fs.DirEntry, err error) error {
-		// If d is nil, it means we were not able to go into the root directory.
-		if d == nil {
-			return err
+// filterObjects removes from the files to update the files not changed since the git ref, and the objects
+// managed by Terraform.
+func filterObjects(inputDirectory string, files map[migrate.ObjectRef]string, opts updateOptions, report *runReport, output *updateOutput) ([]error, error) {
+	if opts.since != "" {
+		changed, err := gitChangedFiles(inputDirectory, opts.since)
+		if err != nil {
+			return nil, err
 		}
-
-		if d.IsDir() {
-			currentDir = d.Name()
-			return nil
+		for ref, path := range files {
+			if _, found := changed[filepath.Clean(path)]; !found {
+				delete(files, ref)
+			}
 		}
+	}
 
-		// Skip non-regular files.
-		if !d.Type().IsRegular() {
-			return nil
-		}
+	if opts.terraform.include {
+		return nil, nil
+	}
 
-		// If we fail on a file, we just record the error and continue.
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to walk file at %s, err: %w", path, err))
-			return nil
-		}
+	owned, failures, err := terraformOwnedObjects(files, opts.terraform)
+	if err != nil {
+		return failures, err
+	}
+	output.terraformRefs = owned
+	for ref := range owned {
+		ref := ref
+		report.add(&ref, files[ref], terraformOutcome, nil, time.Now())
+		delete(files, ref)
+	}
+	return failures, nil
+}
 
-		if updateAll || filepath.Ext(d.Name()) == touchedExt {
-			objectRef, err := objectRefFromFile(currentDir, d.Name())
-			if err != nil {
-				output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to parse file name %s/%s, err: %w", currentDir, d.Name(), err))
-				return nil
-			}
+// add records the outcome of an updated object.
+func (output *updateOutput) add(res migrate.UpdateResult) {
+	switch res.Outcome() {
+	case failedOutcome:
+		output.failedPaths = append(output.failedPaths, res.Err)
+	case skippedOutcome:
+		output.skippedRefs = append(output.skippedRefs, res.Ref)
+	case alertingOutcome:
+		output.alertingRefs = append(output.alertingRefs, res.Ref)
+	case recreatedOutcome:
+		output.recreatedRefs = append(output.recreatedRefs, res.Ref)
+	default:
+		output.updatedPaths = append(output.updatedPaths, res.Path)
+	}
+	if res.Mismatch {
+		output.mismatchPaths = append(output.mismatchPaths, res.Path)
+	}
+}
 
-			if _, found := filesToUpdate[objectRef]; !found {
-				jsonPath := strings.Replace(path, touchedExt, jsonExt, 1)
-				filesToUpdate[objectRef] = jsonPath
-			}
+// audit records a change made in Datadog by an update, with the state of the object before it.
+func (a *auditor) audit(ctx context.Context, res migrate.UpdateResult, before *migrate.ObjectState) error {
+	action := updatedOutcome
+	if res.NewRef != nil {
+		action = recreatedOutcome
+	}
+
+	return a.auditChange(ctx, action, res.Ref, res.NewRef, res.Content, before)
+}
+
+func update(ctx context.Context, cfg config.Config, inputDirectory string, opts updateOptions, report *runReport, auditor *auditor) error {
+	output := updateOutput{}
+
+	store := migrate.NewStore(inputDirectory)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	remap := idRemap{}
+	if opts.createMissing {
+		if remap, err = loadIDRemap(opts.remapFilePath); err != nil {
+			return err
 		}
+	}
 
-		return nil
-	})
+	journal, err := openJournal(opts.journalFilePath)
 	if err != nil {
 		return err
 	}
+	defer journal.Close()
 
-	datadogClient := client.Datadog()
-	dashAPI := datadogV1.NewDashboardsApi(datadogClient)
-	monitorsAPI := datadogV1.NewMonitorsApi(datadogClient)
+	runOpts := opts.runOptions()
+	runOpts.Filter = func(files map[migrate.ObjectRef]string) ([]error, error) {
+		return filterObjects(inputDirectory, files, opts, report, &output)
+	}
+	runOpts.OnResult = func(res migrate.UpdateResult, before *migrate.ObjectState) error {
+		var errs []error
 
-	i := 0
-	for ref, path := range filesToUpdate {
-		if i%10 == 0 {
-			log.Println("Progressing, updating", ref.Type, "object", i, "out of", len(filesToUpdate))
+		// Save the new ID right away, even if the file of the recreated object could not be moved
+		if res.NewRef != nil {
+			remap.set(res.Ref, *res.NewRef)
+			errs = append(errs, remap.save(opts.remapFilePath))
 		}
-		i++
 
-		// Set proper creds
-		credCtx, err := client.DatadogCredentials(ctx, cfg, ref.OrgID)
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("%w object type: %s, id: %s", err, ref.Type, ref.ID))
-			continue
+		// Audit every change made in Datadog, even when a later step such as verification failed
+		if res.Downtime != nil {
+			errs = append(errs, auditor.auditDowntime(ctx, mutedAction, *res.Downtime))
 		}
-
-		content, err := os.ReadFile(path)
-		if err != nil {
-			output.failedPaths = append(output.failedPaths, fmt.Errorf("failed to read file at %s, err: %w", path, err))
-			continue
+		if res.Mutated {
+			errs = append(errs, auditor.audit(ctx, res, before))
 		}
 
-		var processErr error
-		switch ref.Type {
-		case dashboardObjType:
-			dashboard := &datadogV1.Dashboard{}
-			err := json.Unmarshal(content, dashboard)
+		output.add(res)
+		report.add(&res.Ref, res.Path, res.Outcome(), res.Err, time.Now().Add(-res.Duration))
+		errs = append(errs, journal.record(newJournalEntry(res)))
+		return errors.Join(errs...)
+	}
 
-			_, _, err = dashAPI.UpdateDashboard(credCtx, ref.ID, *dashboard)
-			if err != nil {
-				processErr = fmt.Errorf("failed to update dashboard %s, err: %w", ref.ID, err)
-			}
+	runOpts.OnUnmute = func(rec migrate.DowntimeRecord) error {
+		return auditor.auditDowntime(ctx, unmutedAction, rec)
+	}
 
-		case monitorObjType:
-			monitor := &datadogV1.Monitor{}
-			err := json.Unmarshal(content, monitor)
+	updater := migrate.NewUpdater(client.Datadog(), opts.monitorFields)
+	result, err := updater.Run(ctx, cfg, store, manifest, runOpts)
+	output.failedPaths = append(output.failedPaths, result.Failures...)
+	report.addFailures(result.Failures)
 
-			intID, err := strconv.Atoi(ref.ID)
-			if err != nil {
-				processErr = fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
-			}
+	validationErr := &migrate.ValidationError{}
+	if errors.As(err, &validationErr) {
+		for ref, err := range validationErr.Invalid {
+			ref := ref
+			report.add(&ref, result.Files[ref], failedOutcome, err, time.Now())
+		}
+		printValidationFailures(validationErr.Invalid)
+		return err
+	}
+	if err != nil {
+		return err
+	}
 
-			_, _, err = monitorsAPI.UpdateMonitor(credCtx, int64(intID), datadogV1.MonitorUpdateRequest{
-				Query:   &monitor.Query,
-				Name:    monitor.Name,
-				Message: monitor.Message,
-			})
-			if err != nil {
-				processErr = fmt.Errorf("failed to update monitor %s, err: %w", ref.ID, err)
-			}
+	output.haltErr = result.Halt
 
-		default:
-			processErr = fmt.Errorf("invalid object type: %s", ref.Type)
+	fmt.Printf("\nFinished updating\n")
+	fmt.Printf("Updated objects: %d\n", len(output.updatedPaths))
+	if opts.createMissing {
+		fmt.Printf("Recreated objects: %d\n", len(output.recreatedRefs))
+		for _, ref := range output.recreatedRefs {
+			newRef, _ := remap.get(ref, ref.OrgID)
+			fmt.Printf("  %s %s (org %d) -> %s\n", ref.Type, ref.ID, ref.OrgID, newRef.ID)
 		}
-
-		if processErr == nil {
-			output.updatedPaths = append(output.updatedPaths, path)
-		} else {
-			output.failedPaths = append(output.failedPaths, processErr)
+	}
+	if len(output.alertingRefs) > 0 {
+		fmt.Printf("Skipped alerting monitors: %d\n", len(output.alertingRefs))
+		for _, ref := range output.alertingRefs {
+			fmt.Println(" ", ref)
 		}
 	}
+	if len(output.terraformRefs) > 0 {
+		refs := make([]migrate.ObjectRef, 0, len(output.terraformRefs))
+		for ref := range output.terraformRefs {
+			refs = append(refs, ref)
+		}
+		sort.Slice(refs, func(i, j int) bool {
+			return refs[i].Less(refs[j])
+		})
 
-	fmt.Printf("\nFinished updating\n")
-	fmt.Printf("Updated objects: %d\n", len(output.updatedPaths))
+		fmt.Printf("Skipped Terraform-owned objects: %d\n", len(refs))
+		for _, ref := range refs {
+			fmt.Printf("  %s (%s)\n", ref, output.terraformRefs[ref])
+		}
+	}
+	if opts.verify {
+		fmt.Printf("Verification mismatches: %d\n", len(output.mismatchPaths))
+		for _, path := range output.mismatchPaths {
+			fmt.Println(" ", path)
+		}
+	}
 	fmt.Printf("Update failures: %d\n", len(output.failedPaths))
 	for _, err := range output.failedPaths {
 		fmt.Println(err)
 	}
+	if output.haltErr != nil {
+		fmt.Printf("Skipped objects: %d\n", len(output.skippedRefs))
+		fmt.Println(output.haltErr)
+	}
 	fmt.Println()
 
+	if output.haltErr != nil {
+		return output.haltErr
+	}
 	if len(output.failedPaths) > 0 {
 		return fmt.Errorf("failed to patch some objects")
 	}
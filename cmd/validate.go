@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func newValidateCommand(config *config.Config) *cobra.Command {
+	var inputDirectory string
+	var validateAll bool
+	fieldOpts := monitorFieldOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate all patched monitors in input directory with the Datadog API",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fields, err := fieldOpts.fieldSet()
+			if err != nil {
+				cmd.Usage()
+				return err
+			}
+
+			return validate(cmd.Context(), *config, inputDirectory, validateAll, fields)
+		},
+	}
+
+	cmd.Flags().StringVarP(&inputDirectory, "input", "i", "objects", "Input folder")
+	cmd.Flags().BoolVarP(&validateAll, "validate-all", "u", false, "Validate all monitors, not just patched ones")
+	addMonitorFieldFlags(cmd, &fieldOpts)
+
+	return cmd
+}
+
+func validate(ctx context.Context, cfg config.Config, inputDirectory string, validateAll bool, monitorFields migrate.MonitorFieldSet) error {
+	store := migrate.NewStore(inputDirectory)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		return err
+	}
+
+	files, failures, err := store.Select(manifest, validateAll)
+	if err != nil {
+		return err
+	}
+
+	invalid := migrate.NewUpdater(client.Datadog(), monitorFields).ValidateFiles(ctx, cfg, files)
+
+	monitors := 0
+	for ref := range files {
+		if ref.Type == migrate.MonitorType {
+			monitors++
+		}
+	}
+
+	fmt.Printf("\nFinished validating\n")
+	fmt.Printf("Valid monitors: %d\n", monitors-len(invalid))
+	printValidationFailures(invalid)
+	for _, err := range failures {
+		fmt.Println(err)
+	}
+	fmt.Println()
+
+	if len(invalid) > 0 || len(failures) > 0 {
+		return fmt.Errorf("failed to validate some monitors")
+	}
+	return nil
+}
+
+func printValidationFailures(invalid map[migrate.ObjectRef]error) {
+	refs := make([]migrate.ObjectRef, 0, len(invalid))
+	for ref := range invalid {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Less(refs[j])
+	})
+
+	fmt.Printf("Validation failures: %d\n", len(refs))
+	for _, ref := range refs {
+		fmt.Println(invalid[ref])
+	}
+}
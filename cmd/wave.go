@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+type waveOptions struct {
+	size            string
+	byOrg           bool
+	pause           time.Duration
+	confirm         bool
+	maxFailureRate  float64
+	maxMismatchRate float64
+
+	input  *bufio.Reader
+	output io.Writer
+}
+
+// planWaves splits the references in ordered waves.
+// Without a wave size, all references are part of a single wave.
+func planWaves(refs []migrate.ObjectRef, opts waveOptions) ([][]migrate.ObjectRef, error) {
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Less(refs[j])
+	})
+
+	groups := [][]migrate.ObjectRef{refs}
+	if opts.byOrg {
+		groups = nil
+		for i, ref := range refs {
+			if i == 0 || ref.OrgID != refs[i-1].OrgID {
+				groups = append(groups, nil)
+			}
+			groups[len(groups)-1] = append(groups[len(groups)-1], ref)
+		}
+	}
+
+	waves := [][]migrate.ObjectRef{}
+	for _, group := range groups {
+		size, err := parseWaveSize(opts.size, len(group))
+		if err != nil {
+			return nil, err
+		}
+
+		for start := 0; start < len(group); start += size {
+			end := min(start+size, len(group))
+			waves = append(waves, group[start:end])
+		}
+	}
+
+	return waves, nil
+}
+
+// parseWaveSize converts a count (`50`) or a percentage (`10%`) to a number of objects.
+func parseWaveSize(size string, total int) (int, error) {
+	if size == "" || total == 0 {
+		return max(total, 1), nil
+	}
+
+	if percent, found := strings.CutSuffix(size, "%"); found {
+		value, err := strconv.ParseFloat(percent, 64)
+		if err != nil || value <= 0 || value > 100 {
+			return 0, fmt.Errorf("invalid wave size: %s", size)
+		}
+		return max(int(math.Ceil(float64(total)*value/100)), 1), nil
+	}
+
+	value, err := strconv.Atoi(size)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid wave size: %s", size)
+	}
+	return value, nil
+}
+
+// waitNextWave pauses and/or asks for confirmation before starting a wave.
+func (opts waveOptions) waitNextWave(ctx context.Context, waveIndex, waveCount int) error {
+	if opts.pause > 0 {
+		fmt.Fprintf(opts.output, "Waiting %s before wave %d out of %d\n", opts.pause, waveIndex+1, waveCount)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(opts.pause):
+		}
+	}
+
+	if opts.confirm {
+		fmt.Fprintf(opts.output, "Continue with wave %d out of %d? [y/N] ", waveIndex+1, waveCount)
+
+		answer, err := opts.input.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			return fmt.Errorf("stopped before wave %d out of %d", waveIndex+1, waveCount)
+		}
+	}
+
+	return nil
+}
+
+// check returns an error when the wave exceeds one of the configured thresholds.
+func (opts waveOptions) check(stats migrate.WaveStats) error {
+	if stats.Total == 0 {
+		return nil
+	}
+
+	if rate := float64(stats.Failed) / float64(stats.Total); rate > opts.maxFailureRate {
+		return fmt.Errorf("failure rate %.2f exceeds %.2f", rate, opts.maxFailureRate)
+	}
+
+	if rate := float64(stats.Mismatched) / float64(stats.Total); rate > opts.maxMismatchRate {
+		return fmt.Errorf("verification mismatch rate %.2f exceeds %.2f", rate, opts.maxMismatchRate)
+	}
+
+	return nil
+}
@@ -5,6 +5,8 @@ go 1.21
 require (
 	github.com/DataDog/datadog-api-client-go/v2 v2.21.0
 	github.com/spf13/cobra v1.8.0
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -15,6 +17,7 @@ require (
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/oauth2 v0.10.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
@@ -1,5 +1,7 @@
 package config
 
+import "encoding/json"
+
 type DatadogCredential struct {
 	APIKey string `json:"apiKey"`
 	AppKey string `json:"appKey"`
@@ -7,4 +9,6 @@ type DatadogCredential struct {
 
 type Config struct {
 	Credentials map[string]DatadogCredential `json:"credentials"`
+	// Patchers holds the options of patchers, by patcher name
+	Patchers map[string]json.RawMessage `json:"patchers,omitempty"`
 }
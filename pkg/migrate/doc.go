@@ -0,0 +1,23 @@
+// Package migrate is the dump/patch/update engine behind the migrate-tool commands.
+//
+// Objects are stored in a Store, one file per object, and tracked by the state manifest at its root:
+//
+//	store := migrate.NewStore("objects")
+//	manifest, err := store.LoadManifest()
+//
+//	// Dump, then dump the objects they reference
+//	store.DumpAll(ctx, cfg, client.Datadog(), manifest, refs, migrate.JSONFormat, false, func(res migrate.DumpResult) {})
+//	failures, err := store.DumpDependencies(ctx, cfg, client.Datadog(), manifest, migrate.JSONFormat, func(res migrate.DumpResult) {})
+//
+//	// Patch
+//	patcher := migrate.NewTypedPatcher(ksm.Patcher{})
+//	failures, err = store.PatchAll(ctx, cfg, manifest, patcher, "ksm-to-core", func(res migrate.PatchResult) {})
+//
+//	// Update the pending objects, with the credentials of the org of each object
+//	updater := migrate.NewUpdater(client.Datadog(), migrate.AllMonitorFields())
+//	result, err := updater.Run(ctx, cfg, store, manifest, migrate.RunOptions{Validate: true})
+//
+// Run saves the manifest, the other steps leave it to the caller:
+//
+//	err = manifest.Save()
+package migrate
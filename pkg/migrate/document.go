@@ -0,0 +1,182 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Objects are handled as raw JSON documents, so that fields and widget types unknown to the
+// pinned Datadog client round-trip untouched. Typed views are only built for typed patchers.
+
+// VolatileFields are read-only fields that change without any configuration change.
+// They are stripped from object files, so that only real changes show up in diffs.
+var VolatileFields = map[string][]string{
+	DashboardType: {
+		"created_at",
+		"modified_at",
+	},
+	MonitorType: {
+		"created",
+		"deleted",
+		"matching_downtimes",
+		"modified",
+		"overall_state",
+		"overall_state_modified",
+		"state",
+	},
+}
+
+// DashboardReadOnlyFields are the fields set by Datadog, removed before creating the dashboard.
+var DashboardReadOnlyFields = []string{
+	"author_handle",
+	"author_name",
+	"created_at",
+	"id",
+	"modified_at",
+	"url",
+}
+
+// ParseDocument decodes JSON or YAML object content as a JSON object, keeping numbers as written.
+func ParseDocument(content []byte) (map[string]any, error) {
+	decode := DecodeJSON
+	if isYAMLContent(content) {
+		decode = unmarshalYAML
+	}
+
+	doc, err := decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("not a JSON object")
+	}
+	return obj, nil
+}
+
+// DecodeJSON decodes a JSON value keeping numbers as json.Number, so they round-trip unchanged.
+func DecodeJSON(content []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// WithoutFields returns a shallow copy of the document without the given fields.
+func WithoutFields(doc map[string]any, fields []string) map[string]any {
+	res := make(map[string]any, len(doc))
+	for key, value := range doc {
+		res[key] = value
+	}
+	for _, field := range fields {
+		delete(res, field)
+	}
+	return res
+}
+
+// MarshalObject serializes an object for storage in the given format: volatile fields are stripped,
+// keys are sorted and HTML characters (`<`, `>`, `&`) are not escaped.
+func MarshalObject(format, objType string, obj any) ([]byte, error) {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return NormalizeObject(format, objType, content)
+}
+
+// NormalizeObject applies the storage serialization to JSON or YAML content.
+func NormalizeObject(format, objType string, content []byte) ([]byte, error) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, err: %w", objType, err)
+	}
+
+	return MarshalDocument(format, objType, doc)
+}
+
+// MarshalDocument applies the storage serialization to a raw object document.
+func MarshalDocument(format, objType string, doc map[string]any) ([]byte, error) {
+	obj := WithoutFields(doc, VolatileFields[objType])
+	if format == YAMLFormat {
+		return marshalYAML(obj)
+	}
+
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(obj); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CopyValue copies raw document values, with their objects and arrays.
+func CopyValue(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		res := make(map[string]any, len(value))
+		for key, elem := range value {
+			res[key] = CopyValue(elem)
+		}
+		return res
+	case []any:
+		res := make([]any, len(value))
+		for i, elem := range value {
+			res[i] = CopyValue(elem)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// containsValue reports whether the local value is found in the remote one. Only the keys of local objects are
+// compared, recursively, so that defaults filled in by Datadog are ignored. Numbers are compared by value.
+func containsValue(remote, local any) bool {
+	switch localValue := local.(type) {
+	case map[string]any:
+		remoteValue, ok := remote.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, elem := range localValue {
+			if !containsValue(remoteValue[key], elem) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		remoteValue, ok := remote.([]any)
+		if !ok || len(remoteValue) != len(localValue) {
+			return false
+		}
+		for i, elem := range localValue {
+			if !containsValue(remoteValue[i], elem) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		remoteValue, ok := remote.(json.Number)
+		if !ok {
+			return false
+		}
+		if remoteValue == localValue {
+			return true
+		}
+		l, lErr := localValue.Float64()
+		r, rErr := remoteValue.Float64()
+		return lErr == nil && rErr == nil && l == r
+	default:
+		return remote == local
+	}
+}
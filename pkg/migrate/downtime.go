@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+// Mute creates a downtime scoped to the monitor, ending after the given duration.
+// It returns no record when the monitor does not exist, so that the update can report or recreate it.
+func (u *Updater) Mute(ctx context.Context, ref ObjectRef, during time.Duration) (*DowntimeRecord, error) {
+	rec := DowntimeRecord{OrgID: ref.OrgID, MonitorID: ref.ID}
+
+	monitorID, err := strconv.ParseInt(ref.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
+	}
+
+	now := time.Now()
+	rec.End = now.Add(during).UTC()
+	downtime, httpResp, err := u.downtimesAPI.CreateDowntime(ctx, datadogV1.Downtime{
+		MonitorId: *datadog.NewNullableInt64(&monitorID),
+		Scope:     []string{"*"},
+		Start:     datadog.PtrInt64(now.Unix()),
+		End:       *datadog.NewNullableInt64(datadog.PtrInt64(rec.End.Unix())),
+		Message:   *datadog.NewNullableString(datadog.PtrString("Muted by migrate-tool during monitor update")),
+	})
+	if IsNotFound(httpResp) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mute monitor %s, err: %w", ref.ID, err)
+	}
+	rec.DowntimeID = downtime.GetId()
+
+	return &rec, nil
+}
+
+// CancelDowntimes cancels the recorded downtimes that are still active, with the credentials of their org.
+// It returns the downtimes it cancelled, and the records that could not be cancelled.
+func (u *Updater) CancelDowntimes(ctx context.Context, cfg config.Config, records []DowntimeRecord) ([]DowntimeRecord, []DowntimeRecord, []error) {
+	var cancelled, remaining []DowntimeRecord
+	var failures []error
+
+	for _, rec := range records {
+		if time.Now().After(rec.End) {
+			continue
+		}
+
+		credCtx, err := client.DatadogCredentials(ctx, cfg, rec.OrgID)
+		if err != nil {
+			remaining = append(remaining, rec)
+			failures = append(failures, fmt.Errorf("%w downtime: %d", err, rec.DowntimeID))
+			continue
+		}
+
+		httpResp, err := u.downtimesAPI.CancelDowntime(credCtx, rec.DowntimeID)
+		switch {
+		case IsNotFound(httpResp):
+		case err != nil:
+			remaining = append(remaining, rec)
+			failures = append(failures, fmt.Errorf("failed to cancel downtime %d of monitor %s, err: %w", rec.DowntimeID, rec.MonitorID, err))
+		default:
+			cancelled = append(cancelled, rec)
+		}
+	}
+
+	return cancelled, remaining, failures
+}
+
+// settleAndUnmute waits for the settle period, then cancels the given downtimes created by the run.
+// onUnmute is called with every cancelled downtime.
+func (u *Updater) settleAndUnmute(ctx context.Context, cfg config.Config, manifest *Manifest, created []DowntimeRecord, settle time.Duration, onUnmute func(DowntimeRecord) error) []error {
+	log.Println("Waiting", settle, "before cancelling", len(created), "downtimes")
+	select {
+	case <-ctx.Done():
+		return []error{fmt.Errorf("downtimes not cancelled: %w", ctx.Err())}
+	case <-time.After(settle):
+	}
+
+	cancelled, remaining, failures := u.CancelDowntimes(ctx, cfg, created)
+	manifest.ReplaceDowntimes(created, remaining)
+	if onUnmute != nil {
+		for _, rec := range cancelled {
+			if err := onUnmute(rec); err != nil {
+				failures = append(failures, err)
+			}
+		}
+	}
+	return failures
+}
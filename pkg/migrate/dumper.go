@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+// Dumper fetches objects of one type from Datadog.
+type Dumper interface {
+	ObjectType() string
+	Dump(ctx context.Context, client *datadog.APIClient, ref ObjectRef) (any, error)
+}
+
+// Dumpers are the dumpers of all supported object types.
+var Dumpers = map[string]Dumper{
+	DashboardType: DashboardDumper{},
+	MonitorType:   MonitorDumper{},
+}
+
+// Dump fetches the object and writes it to the store in the given format.
+// Unless updateExisting is set, objects already in the store are kept: the path of their file is returned
+// without content.
+func (s Store) Dump(ctx context.Context, cfg config.Config, datadogClient *datadog.APIClient, dumper Dumper, ref ObjectRef, format string, updateExisting bool) (string, []byte, error) {
+	if !updateExisting {
+		if path, found := s.Find(ref); found {
+			return path, nil, nil
+		}
+	}
+
+	// Set proper creds
+	credCtx, err := client.DatadogCredentials(ctx, cfg, ref.OrgID)
+	if err != nil {
+		return s.Path(ref, format), nil, fmt.Errorf("%w object type: %s, id: %s", err, ref.Type, ref.ID)
+	}
+
+	obj, err := dumper.Dump(credCtx, datadogClient, ref)
+	if err != nil {
+		return s.Path(ref, format), nil, fmt.Errorf("failed to process object from org: %d, type: %s, id: %s: %w", ref.OrgID, ref.Type, ref.ID, err)
+	}
+
+	return s.Write(ref, format, obj)
+}
+
+// DumpResult is the outcome of the dump of one object. Objects already in the store and kept have no content.
+type DumpResult struct {
+	Ref     ObjectRef
+	Path    string
+	Content []byte
+	Err     error
+}
+
+// DumpAll dumps the objects with the dumper of their type, as Dump does, and records the fresh dumps in the manifest.
+// fn is called with the outcome of every object.
+func (s Store) DumpAll(ctx context.Context, cfg config.Config, datadogClient *datadog.APIClient, manifest *Manifest, refs []ObjectRef, format string, updateExisting bool, fn func(DumpResult)) {
+	for i, ref := range refs {
+		if i%20 == 0 {
+			log.Println("Progressing, dumping", ref.Type, "object", i, "out of", len(refs))
+		}
+
+		res := DumpResult{Ref: ref}
+		dumper, found := Dumpers[ref.Type]
+		if !found {
+			res.Err = fmt.Errorf("invalid object type: %s", ref.Type)
+			fn(res)
+			continue
+		}
+
+		res.Path, res.Content, res.Err = s.Dump(ctx, cfg, datadogClient, dumper, ref, format, updateExisting)
+		if res.Err == nil && res.Content != nil {
+			manifest.Dumped(ref, res.Content)
+		}
+		fn(res)
+	}
+}
+
+// DumpDependencies dumps the objects referenced by the objects in the store, transitively, until all of them
+// are dumped or were attempted. Objects already in the store are kept.
+// Files that cannot be read or parsed are returned as errors.
+func (s Store) DumpDependencies(ctx context.Context, cfg config.Config, datadogClient *datadog.APIClient, manifest *Manifest, format string, fn func(DumpResult)) ([]error, error) {
+	attempted := map[ObjectRef]struct{}{}
+	for {
+		// Files failing on a pass fail on the next ones, only the failures of the last pass are returned
+		graph, failures, err := s.DependencyGraph()
+		if err != nil {
+			return failures, err
+		}
+
+		missing := []ObjectRef{}
+		for _, ref := range graph.Missing() {
+			if _, found := attempted[ref]; !found {
+				attempted[ref] = struct{}{}
+				missing = append(missing, ref)
+			}
+		}
+		if len(missing) == 0 {
+			return failures, nil
+		}
+
+		log.Println("Dumping", len(missing), "dependencies")
+		s.DumpAll(ctx, cfg, datadogClient, manifest, missing, format, false, fn)
+	}
+}
+
+// Dashboards
+type DashboardDumper struct{}
+
+func (DashboardDumper) ObjectType() string {
+	return DashboardType
+}
+
+func (DashboardDumper) Dump(ctx context.Context, client *datadog.APIClient, ref ObjectRef) (any, error) {
+	dashAPI := datadogV1.NewDashboardsApi(client)
+
+	dashboard, _, err := dashAPI.GetDashboard(ctx, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return dashboard, nil
+}
+
+// Monitors
+type MonitorDumper struct{}
+
+func (MonitorDumper) ObjectType() string {
+	return MonitorType
+}
+
+func (MonitorDumper) Dump(ctx context.Context, client *datadog.APIClient, ref ObjectRef) (any, error) {
+	monitorAPI := datadogV1.NewMonitorsApi(client)
+
+	monitorID, err := strconv.ParseInt(ref.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid monitor ID: %s", ref.ID)
+	}
+
+	monitor, _, err := monitorAPI.GetMonitor(ctx, monitorID)
+	if err != nil {
+		return nil, err
+	}
+
+	return monitor, nil
+}
@@ -0,0 +1,235 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Object files are stored as JSON (default) or YAML, the format is given by the file extension.
+const (
+	JSONFormat = "json"
+	YAMLFormat = "yaml"
+)
+
+// ValidateFormat checks that the storage format is known.
+func ValidateFormat(format string) error {
+	switch format {
+	case JSONFormat, YAMLFormat:
+		return nil
+	default:
+		return fmt.Errorf("unknown format %s, must be json or yaml", format)
+	}
+}
+
+// FormatExt returns the extension of object files stored in the given format.
+func FormatExt(format string) string {
+	if format == YAMLFormat {
+		return yamlExt
+	}
+	return jsonExt
+}
+
+// FileFormat returns the storage format of the object file at path.
+func FileFormat(path string) string {
+	if filepath.Ext(path) == yamlExt {
+		return YAMLFormat
+	}
+	return JSONFormat
+}
+
+// ExistingObjectFile returns the path of the object file in any format, if it exists.
+func ExistingObjectFile(path string) (string, bool) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{filepath.Ext(path), jsonExt, yamlExt} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
+
+// RemoveOtherFormats removes the files of the same object stored in another format than the one at path.
+func RemoveOtherFormats(path string) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{jsonExt, yamlExt} {
+		if ext == filepath.Ext(path) {
+			continue
+		}
+		if err := os.Remove(base + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove object at %s, err: %w", base+ext, err)
+		}
+	}
+	return nil
+}
+
+// isYAMLContent reports whether the object content is YAML, JSON objects always start with `{`.
+func isYAMLContent(content []byte) bool {
+	trimmed := strings.TrimSpace(string(content))
+	return trimmed != "" && trimmed[0] != '{'
+}
+
+// marshalYAML encodes a raw document as YAML with sorted keys. Multi-line strings, such as
+// monitor messages, are rendered as block scalars.
+func marshalYAML(doc any) ([]byte, error) {
+	node, err := yamlNode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := strings.Builder{}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return []byte(buf.String()), nil
+}
+
+func yamlNode(value any) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range keys {
+			child, err := yamlNode(v[key])
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		return node, nil
+
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+
+	case string:
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+		switch {
+		case strings.HasPrefix(v, "\n"):
+			// The encoder drops the first line of block scalars starting with a blank line
+			node.Style = yaml.DoubleQuotedStyle
+		case strings.Contains(v, "\n"):
+			node.Style = yaml.LiteralStyle
+		}
+		return node, nil
+
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(v), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}, nil
+
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// unmarshalYAML decodes YAML content into a raw document, with the same types as DecodeJSON.
+func unmarshalYAML(content []byte) (any, error) {
+	node := &yaml.Node{}
+	if err := yaml.Unmarshal(content, node); err != nil {
+		return nil, err
+	}
+	return yamlValue(node)
+}
+
+func yamlValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlValue(node.Content[0])
+
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+
+	case yaml.MappingNode:
+		obj := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := yamlValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			obj[node.Content[i].Value] = value
+		}
+		return obj, nil
+
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			value, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+
+		case "!!bool":
+			var b bool
+			err := node.Decode(&b)
+			return b, err
+
+		case "!!int", "!!float":
+			// Keep numbers as written when they are valid JSON numbers
+			number := json.Number(node.Value)
+			if _, err := number.Float64(); err == nil && json.Valid([]byte(node.Value)) {
+				return number, nil
+			}
+
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return nil, err
+			}
+			number = json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+			if !json.Valid([]byte(number)) {
+				return nil, fmt.Errorf("line %d: %s is not a valid JSON number", node.Line, node.Value)
+			}
+			return number, nil
+
+		default:
+			return node.Value, nil
+		}
+
+	default:
+		return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+	}
+}
@@ -0,0 +1,166 @@
+package migrate
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "numbers keep their text",
+			input: `{"a":1.0,"b":0.00001,"c":1e3,"d":12345678901234567890,"e":-0.0,"f":-5,"g":1.5E-7}`,
+		},
+		{
+			name:  "strings looking like other types",
+			input: `{"a":"true","b":"123","c":"null","d":"","e":"yes","f":"~","g":"0x1F","h":"1e3","i":"- a","j":"a: b","k":"#c","l":"@team"}`,
+		},
+		{
+			name:  "multi-line strings",
+			input: `{"a":"line 1\nline 2\n","b":"no final new line\nend","c":"  leading spaces\nb\n","d":"trailing spaces  \nb\n","e":"\n\nblank lines\n\n","e2":"\nblank line\n","f":"tab\tand unicode é 😀\r\n"}`,
+		},
+		{
+			name:  "nested values",
+			input: `{"a":{"b":[{"c":null},true,false,[],{}]},"1":"numeric key","":"empty key"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := ParseDocument([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			content, err := MarshalDocument(YAMLFormat, MonitorType, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseDocument(content)
+			if err != nil {
+				t.Fatalf("failed to parse\n%s\nerr: %v", content, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s, from\n%s", gotJSON, tt.input, content)
+			}
+		})
+	}
+}
+
+func TestMarshalYAML(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{"name":"a","message":"Alert\n@team\n","tags":["env:prod"],"options":{"thresholds":{"critical":90.0}},"state":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := MarshalDocument(YAMLFormat, MonitorType, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `message: |
+  Alert
+  @team
+name: a
+options:
+  thresholds:
+    critical: 90.0
+tags:
+  - env:prod
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "plain scalars",
+			input: "a: 1\nb: 2.50\nc: true\nd: ~\ne: null\nf: yes\ng: text\n",
+			want:  `{"a":1,"b":2.50,"c":true,"d":null,"e":null,"f":"yes","g":"text"}`,
+		},
+		{
+			name:  "numbers that are not valid JSON",
+			input: "a: 0x1F\nb: +1\nc: 1_000\nd: .5\n",
+			want:  `{"a":31,"b":1,"c":1000,"d":0.5}`,
+		},
+		{
+			name:  "quoted and block scalars",
+			input: "a: \"1\"\nb: 'true'\nc: |\n  x\n  y\nd: >-\n  x\n  y\n",
+			want:  `{"a":"1","b":"true","c":"x\ny\n","d":"x y"}`,
+		},
+		{
+			name:  "anchors and aliases",
+			input: "a: &tags [env:prod]\nb: *tags\n",
+			want:  `{"a":["env:prod"],"b":["env:prod"]}`,
+		},
+		{
+			name:    "infinity",
+			input:   "a: .inf\n",
+			wantErr: true,
+		},
+		{
+			name:    "not an object",
+			input:   "- a\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid YAML",
+			input:   "a: [\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDocument([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			want, err := ParseDocument([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsYAMLContent(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: `{"a":1}`, want: false},
+		{input: "\n\t {\"a\":1}", want: false},
+		{input: "a: 1\n", want: true},
+		{input: "---\na: 1\n", want: true},
+		{input: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := isYAMLContent([]byte(tt.input)); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
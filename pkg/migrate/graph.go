@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// DependencyGraph links objects to the objects they reference.
+// Referenced objects that are not in the store are part of the graph, flagged as missing.
+type DependencyGraph struct {
+	Local map[ObjectRef]struct{}
+	Edges map[ObjectRef][]ObjectRef
+}
+
+// ObjectDependencies returns the objects referenced by an object, in the same org.
+// References to types the tool cannot dump, such as SLOs, are ignored.
+func ObjectDependencies(ref ObjectRef, content []byte) ([]ObjectRef, error) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	seen := map[ObjectRef]struct{}{}
+	deps := []ObjectRef{}
+	VisitReferences(ref.Type, doc, func(objType, id string) string {
+		if _, found := Dumpers[objType]; !found {
+			return id
+		}
+
+		dep := ObjectRef{OrgID: ref.OrgID, Type: objType, ID: id}
+		if _, found := seen[dep]; !found && dep != ref {
+			seen[dep] = struct{}{}
+			deps = append(deps, dep)
+		}
+		return id
+	})
+
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Less(deps[j])
+	})
+	return deps, nil
+}
+
+// DependencyGraph builds the dependency graph of the objects in the store.
+// Files that cannot be read or parsed are returned as errors.
+func (s Store) DependencyGraph() (*DependencyGraph, []error, error) {
+	graph := &DependencyGraph{
+		Local: map[ObjectRef]struct{}{},
+		Edges: map[ObjectRef][]ObjectRef{},
+	}
+
+	var readFailures []error
+	failures, err := s.Walk(func(path string, ref ObjectRef) {
+		graph.Local[ref] = struct{}{}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			readFailures = append(readFailures, fmt.Errorf("failed to read file at %s, err: %w", path, err))
+			return
+		}
+
+		deps, err := ObjectDependencies(ref, content)
+		if err != nil {
+			readFailures = append(readFailures, err)
+			return
+		}
+		graph.Edges[ref] = deps
+	})
+
+	return graph, append(failures, readFailures...), err
+}
+
+// Missing returns the referenced objects that are not in the store.
+func (graph *DependencyGraph) Missing() []ObjectRef {
+	seen := map[ObjectRef]struct{}{}
+	missing := []ObjectRef{}
+	for _, deps := range graph.Edges {
+		for _, dep := range deps {
+			if _, found := graph.Local[dep]; found {
+				continue
+			}
+			if _, found := seen[dep]; !found {
+				seen[dep] = struct{}{}
+				missing = append(missing, dep)
+			}
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Less(missing[j])
+	})
+	return missing
+}
+
+// Nodes returns the objects of the store and the missing ones, sorted.
+func (graph *DependencyGraph) Nodes() []ObjectRef {
+	nodes := make([]ObjectRef, 0, len(graph.Local))
+	for ref := range graph.Local {
+		nodes = append(nodes, ref)
+	}
+	nodes = append(nodes, graph.Missing()...)
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Less(nodes[j])
+	})
+	return nodes
+}
+
+func (graph *DependencyGraph) IsMissing(ref ObjectRef) bool {
+	_, found := graph.Local[ref]
+	return !found
+}
@@ -0,0 +1,272 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const StateFileName = ".migrate-state.json"
+
+const (
+	DumpedStatus    = "dumped"
+	PatchedStatus   = "patched"
+	UpdatedStatus   = "updated"
+	VerifiedStatus  = "verified"
+	UntrackedStatus = "untracked"
+)
+
+// ObjectState records the lifecycle of an object file.
+// Hashes are computed on the content of the local file. Patchers lists the patchers that modified
+// the object in order, including chained patchers and successive patch runs.
+type ObjectState struct {
+	OriginalHash   string       `json:"original_hash,omitempty"`
+	DumpedAt       *time.Time   `json:"dumped_at,omitempty"`
+	PatchedHash    string       `json:"patched_hash,omitempty"`
+	Patcher        string       `json:"patcher,omitempty"`
+	PatcherVersion string       `json:"patcher_version,omitempty"`
+	Patchers       []PatcherRef `json:"patchers,omitempty"`
+	PatchedAt      *time.Time   `json:"patched_at,omitempty"`
+	UpdatedHash    string       `json:"updated_hash,omitempty"`
+	UpdatedAt      *time.Time   `json:"updated_at,omitempty"`
+	VerifiedAt     *time.Time   `json:"verified_at,omitempty"`
+}
+
+// Status returns the lifecycle status of the object given the hash of its local file.
+func (state *ObjectState) Status(currentHash string) string {
+	switch {
+	case state == nil:
+		return UntrackedStatus
+	case state.UpdatedHash != "" && currentHash == state.UpdatedHash:
+		if state.VerifiedAt != nil && !state.VerifiedAt.Before(*state.UpdatedAt) {
+			return VerifiedStatus
+		}
+		return UpdatedStatus
+	case state.OriginalHash != "" && currentHash == state.OriginalHash:
+		return DumpedStatus
+	default:
+		return PatchedStatus
+	}
+}
+
+// LastPushedHash returns the hash of the content last known to be in Datadog.
+func (state *ObjectState) LastPushedHash() string {
+	switch {
+	case state == nil:
+		return ""
+	case state.UpdatedHash != "":
+		return state.UpdatedHash
+	default:
+		return state.OriginalHash
+	}
+}
+
+// DowntimeRecord tracks a downtime created around a monitor update, so it can be cleaned up.
+type DowntimeRecord struct {
+	OrgID      int       `json:"org_id"`
+	MonitorID  string    `json:"monitor_id"`
+	DowntimeID int64     `json:"downtime_id"`
+	End        time.Time `json:"end"`
+}
+
+// Manifest is stored at the root of the objects folder and tracks all objects by reference.
+type Manifest struct {
+	path      string
+	Objects   map[string]*ObjectState `json:"objects"`
+	Downtimes []DowntimeRecord        `json:"downtimes,omitempty"`
+}
+
+// ManifestPath returns the path of the state manifest of the objects folder.
+func ManifestPath(directory string) string {
+	return filepath.Join(directory, StateFileName)
+}
+
+// LoadManifest reads the state manifest of the objects folder, an empty manifest is returned if there is none.
+// Objects marked by the .touched files of older versions of the tool and missing from the manifest are recorded
+// as patched.
+func LoadManifest(directory string) (*Manifest, error) {
+	manifest := &Manifest{
+		path:    ManifestPath(directory),
+		Objects: map[string]*ObjectState{},
+	}
+
+	content, err := os.ReadFile(manifest.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read state manifest %s: %w", manifest.path, err)
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(content, manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal state manifest %s: %w", manifest.path, err)
+		}
+		if manifest.Objects == nil {
+			manifest.Objects = map[string]*ObjectState{}
+		}
+	}
+
+	if err := manifest.trackTouchedFiles(directory); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// trackTouchedFiles records the objects marked by legacy .touched files as patched, unless they are already
+// tracked, so that update still pushes them.
+func (manifest *Manifest) trackTouchedFiles(directory string) error {
+	markers, err := filepath.Glob(filepath.Join(directory, "*", "*"+touchedExt))
+	if err != nil {
+		return fmt.Errorf("failed to list touched files in %s: %w", directory, err)
+	}
+
+	for _, marker := range markers {
+		folder := filepath.Base(filepath.Dir(marker))
+		base := strings.TrimSuffix(filepath.Base(marker), touchedExt)
+
+		for _, ext := range []string{jsonExt, yamlExt} {
+			ref, err := ObjectRefFromFile(folder, base+ext)
+			if err != nil || manifest.Get(ref) != nil {
+				continue
+			}
+
+			path := filepath.Join(filepath.Dir(marker), base+ext)
+			content, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read file at %s, err: %w", path, err)
+			}
+
+			now := time.Now().UTC()
+			manifest.Objects[ref.String()] = &ObjectState{
+				PatchedHash: ContentHash(content),
+				PatchedAt:   &now,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (manifest *Manifest) Save() error {
+	content, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state manifest %s: %w", manifest.path, err)
+	}
+
+	if err := os.WriteFile(manifest.path, content, 0o660); err != nil {
+		return fmt.Errorf("failed to write state manifest %s: %w", manifest.path, err)
+	}
+
+	return nil
+}
+
+func (manifest *Manifest) Get(ref ObjectRef) *ObjectState {
+	return manifest.Objects[ref.String()]
+}
+
+func (manifest *Manifest) getOrCreate(ref ObjectRef) *ObjectState {
+	state, found := manifest.Objects[ref.String()]
+	if !found {
+		state = &ObjectState{}
+		manifest.Objects[ref.String()] = state
+	}
+	return state
+}
+
+// Dumped resets the state of the object to a fresh dump.
+func (manifest *Manifest) Dumped(ref ObjectRef, content []byte) {
+	now := time.Now().UTC()
+	manifest.Objects[ref.String()] = &ObjectState{
+		OriginalHash: ContentHash(content),
+		DumpedAt:     &now,
+	}
+}
+
+// Patched records the patcher that modified the object.
+// Objects dumped before the manifest existed get their original hash from the unpatched content.
+func (manifest *Manifest) Patched(ref ObjectRef, original, patched []byte, patcherName, patcherVersion string) {
+	patcher := PatcherRef{Name: patcherName, Version: patcherVersion}
+	manifest.PatchedBy(ref, original, patched, patcher, []PatcherRef{patcher})
+}
+
+// PatchedBy records the patcher run on the object, such as a chain, and the patchers that modified it in order.
+// When the object was last patched into the original content, the patchers are appended to the previous ones.
+func (manifest *Manifest) PatchedBy(ref ObjectRef, original, patched []byte, patcher PatcherRef, applied []PatcherRef) {
+	now := time.Now().UTC()
+	state := manifest.getOrCreate(ref)
+	if state.OriginalHash == "" {
+		state.OriginalHash = ContentHash(original)
+	}
+	if state.PatchedHash == "" || state.PatchedHash != ContentHash(original) {
+		state.Patchers = nil
+	}
+	state.PatchedHash = ContentHash(patched)
+	state.Patcher = patcher.Name
+	state.PatcherVersion = patcher.Version
+	state.Patchers = append(state.Patchers, applied...)
+	state.PatchedAt = &now
+}
+
+func (manifest *Manifest) Updated(ref ObjectRef, content []byte) {
+	now := time.Now().UTC()
+	state := manifest.getOrCreate(ref)
+	state.UpdatedHash = ContentHash(content)
+	state.UpdatedAt = &now
+}
+
+func (manifest *Manifest) Verified(ref ObjectRef) {
+	now := time.Now().UTC()
+	manifest.getOrCreate(ref).VerifiedAt = &now
+}
+
+// Recreated moves the state of an object to the reference of the object replacing it.
+func (manifest *Manifest) Recreated(oldRef, newRef ObjectRef, content []byte) {
+	delete(manifest.Objects, oldRef.String())
+	manifest.Synced(newRef, content)
+}
+
+// Synced records an object whose local content was just pushed to Datadog.
+func (manifest *Manifest) Synced(ref ObjectRef, content []byte) {
+	now := time.Now().UTC()
+	hash := ContentHash(content)
+	manifest.Objects[ref.String()] = &ObjectState{
+		OriginalHash: hash,
+		DumpedAt:     &now,
+		UpdatedHash:  hash,
+		UpdatedAt:    &now,
+	}
+}
+
+// ReplaceDowntimes removes the given downtimes from the manifest and adds back the remaining ones.
+func (manifest *Manifest) ReplaceDowntimes(removed, remaining []DowntimeRecord) {
+	removedIDs := make(map[int64]struct{}, len(removed))
+	for _, rec := range removed {
+		removedIDs[rec.DowntimeID] = struct{}{}
+	}
+
+	kept := remaining
+	for _, rec := range manifest.Downtimes {
+		if _, found := removedIDs[rec.DowntimeID]; !found {
+			kept = append(kept, rec)
+		}
+	}
+	manifest.Downtimes = kept
+}
+
+// Pending reports whether the local content was modified since the last update.
+// Objects missing from the manifest, such as files dumped before it existed and never patched, are not pending.
+func (manifest *Manifest) Pending(ref ObjectRef, content []byte) bool {
+	return manifest.Get(ref).Status(ContentHash(content)) == PatchedStatus
+}
+
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,324 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManifestStatus(t *testing.T) {
+	ref := ObjectRef{OrgID: 1, Type: MonitorType, ID: "1"}
+	dumped, patched, edited := []byte(`{"a":1}`), []byte(`{"a":2}`), []byte(`{"a":3}`)
+
+	tests := []struct {
+		name        string
+		record      func(manifest *Manifest)
+		content     []byte
+		wantStatus  string
+		wantPending bool
+	}{
+		{
+			name:       "untracked",
+			record:     func(*Manifest) {},
+			content:    dumped,
+			wantStatus: UntrackedStatus,
+		},
+		{
+			name: "dumped",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+			},
+			content:    dumped,
+			wantStatus: DumpedStatus,
+		},
+		{
+			name: "edited after dump",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+			},
+			content:     edited,
+			wantStatus:  PatchedStatus,
+			wantPending: true,
+		},
+		{
+			name: "patched",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, patched, "ksm", "v1")
+			},
+			content:     patched,
+			wantStatus:  PatchedStatus,
+			wantPending: true,
+		},
+		{
+			name: "patch reverted",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, patched, "ksm", "v1")
+			},
+			content:    dumped,
+			wantStatus: DumpedStatus,
+		},
+		{
+			name: "patched without dump record",
+			record: func(manifest *Manifest) {
+				manifest.Patched(ref, dumped, patched, "ksm", "v1")
+			},
+			content:    dumped,
+			wantStatus: DumpedStatus,
+		},
+		{
+			name: "updated",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, patched, "ksm", "v1")
+				manifest.Updated(ref, patched)
+			},
+			content:    patched,
+			wantStatus: UpdatedStatus,
+		},
+		{
+			name: "verified",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Updated(ref, patched)
+				manifest.Verified(ref)
+			},
+			content:    patched,
+			wantStatus: VerifiedStatus,
+		},
+		{
+			name: "updated after verification",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Updated(ref, patched)
+				manifest.Verified(ref)
+				later := manifest.Get(ref).VerifiedAt.Add(time.Second)
+				manifest.Updated(ref, edited)
+				manifest.Get(ref).UpdatedAt = &later
+			},
+			content:    edited,
+			wantStatus: UpdatedStatus,
+		},
+		{
+			name: "edited after update",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Updated(ref, patched)
+			},
+			content:     edited,
+			wantStatus:  PatchedStatus,
+			wantPending: true,
+		},
+		{
+			name: "synced",
+			record: func(manifest *Manifest) {
+				manifest.Synced(ref, patched)
+			},
+			content:    patched,
+			wantStatus: UpdatedStatus,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &Manifest{Objects: map[string]*ObjectState{}}
+			tt.record(manifest)
+
+			if got := manifest.Get(ref).Status(ContentHash(tt.content)); got != tt.wantStatus {
+				t.Errorf("got status %s, want %s", got, tt.wantStatus)
+			}
+			if got := manifest.Pending(ref, tt.content); got != tt.wantPending {
+				t.Errorf("got pending %v, want %v", got, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestManifestRecreated(t *testing.T) {
+	oldRef := ObjectRef{OrgID: 1, Type: MonitorType, ID: "1"}
+	newRef := ObjectRef{OrgID: 1, Type: MonitorType, ID: "2"}
+	content := []byte(`{"a":1}`)
+
+	manifest := &Manifest{Objects: map[string]*ObjectState{}}
+	manifest.Dumped(oldRef, content)
+	manifest.Recreated(oldRef, newRef, content)
+
+	if manifest.Get(oldRef) != nil {
+		t.Errorf("state of %s kept", oldRef)
+	}
+	if got := manifest.Get(newRef).Status(ContentHash(content)); got != UpdatedStatus {
+		t.Errorf("got status %s, want %s", got, UpdatedStatus)
+	}
+	if manifest.Get(newRef).LastPushedHash() != ContentHash(content) {
+		t.Errorf("got last pushed hash %s", manifest.Get(newRef).LastPushedHash())
+	}
+}
+
+func TestManifestSaveLoad(t *testing.T) {
+	directory := t.TempDir()
+	ref := ObjectRef{OrgID: 1, Type: DashboardType, ID: "abc-def-ghi"}
+
+	manifest, err := LoadManifest(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Objects) != 0 {
+		t.Fatalf("got %d objects in a new manifest", len(manifest.Objects))
+	}
+
+	manifest.Dumped(ref, []byte(`{"a":1}`))
+	manifest.ReplaceDowntimes(nil, []DowntimeRecord{{OrgID: 1, MonitorID: "1", DowntimeID: 10}})
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadManifest(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Get(ref).OriginalHash != manifest.Get(ref).OriginalHash {
+		t.Errorf("got state %+v", loaded.Get(ref))
+	}
+	if !reflect.DeepEqual(loaded.Downtimes, manifest.Downtimes) {
+		t.Errorf("got downtimes %+v", loaded.Downtimes)
+	}
+}
+
+func TestManifestPatchedBy(t *testing.T) {
+	ref := ObjectRef{OrgID: 1, Type: MonitorType, ID: "1"}
+	dumped, first, second, edited := []byte(`{"a":1}`), []byte(`{"a":2}`), []byte(`{"a":3}`), []byte(`{"a":4}`)
+	ksm := PatcherRef{Name: "ksm", Version: "v1"}
+	rules := PatcherRef{Name: "rules", Version: "v1"}
+	chain := PatcherRef{Name: "ksm,rules", Version: "v1"}
+
+	tests := []struct {
+		name        string
+		record      func(manifest *Manifest)
+		wantPatcher PatcherRef
+		want        []PatcherRef
+	}{
+		{
+			name: "chain",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.PatchedBy(ref, dumped, first, chain, []PatcherRef{ksm, rules})
+			},
+			wantPatcher: chain,
+			want:        []PatcherRef{ksm, rules},
+		},
+		{
+			name: "successive runs are appended",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, first, ksm.Name, ksm.Version)
+				manifest.Patched(ref, first, second, rules.Name, rules.Version)
+			},
+			wantPatcher: rules,
+			want:        []PatcherRef{ksm, rules},
+		},
+		{
+			name: "patchers are reset after a manual edit",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, first, ksm.Name, ksm.Version)
+				manifest.Patched(ref, edited, second, rules.Name, rules.Version)
+			},
+			wantPatcher: rules,
+			want:        []PatcherRef{rules},
+		},
+		{
+			name: "patchers are reset by a new dump",
+			record: func(manifest *Manifest) {
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, first, ksm.Name, ksm.Version)
+				manifest.Dumped(ref, dumped)
+				manifest.Patched(ref, dumped, second, rules.Name, rules.Version)
+			},
+			wantPatcher: rules,
+			want:        []PatcherRef{rules},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &Manifest{Objects: map[string]*ObjectState{}}
+			tt.record(manifest)
+
+			state := manifest.Get(ref)
+			if got := (PatcherRef{Name: state.Patcher, Version: state.PatcherVersion}); got != tt.wantPatcher {
+				t.Errorf("got patcher %+v, want %+v", got, tt.wantPatcher)
+			}
+			if !reflect.DeepEqual(state.Patchers, tt.want) {
+				t.Errorf("got patchers %+v, want %+v", state.Patchers, tt.want)
+			}
+			if state.OriginalHash != ContentHash(dumped) {
+				t.Errorf("got original hash %s", state.OriginalHash)
+			}
+		})
+	}
+}
+
+func TestLoadManifestTouchedFiles(t *testing.T) {
+	directory := t.TempDir()
+	orgDir := filepath.Join(directory, "3000")
+	if err := os.MkdirAll(orgDir, 0o770); err != nil {
+		t.Fatal(err)
+	}
+
+	// Folder patched before the manifest existed: only monitor 10 was touched
+	files := map[string]string{
+		"monitor-10.json":        `{"a":1}`,
+		"monitor-10.touched":     "",
+		"monitor-11.json":        `{"a":2}`,
+		"dashboard-abc.yaml":     "a: 3\n",
+		"dashboard-abc.touched":  "",
+		"dashboard-gone.touched": "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(orgDir, name), []byte(content), 0o660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := NewStore(directory)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected, failures, err := store.Select(manifest, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) > 0 {
+		t.Errorf("got failures %v", failures)
+	}
+	want := map[ObjectRef]string{
+		{OrgID: 3000, Type: MonitorType, ID: "10"}:    filepath.Join(orgDir, "monitor-10.json"),
+		{OrgID: 3000, Type: DashboardType, ID: "abc"}: filepath.Join(orgDir, "dashboard-abc.yaml"),
+	}
+	if !reflect.DeepEqual(selected, want) {
+		t.Errorf("got selected %v, want %v", selected, want)
+	}
+
+	// Once updated, the markers are ignored
+	for ref, path := range selected {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Updated(ref, content)
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, err = store.LoadManifest(); err != nil {
+		t.Fatal(err)
+	}
+	if selected, _, _ := store.Select(manifest, false); len(selected) > 0 {
+		t.Errorf("got selected %v after update", selected)
+	}
+}
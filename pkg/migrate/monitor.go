@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MonitorQueryField           = "query"
+	MonitorNameField            = "name"
+	MonitorMessageField         = "message"
+	MonitorTagsField            = "tags"
+	MonitorOptionsField         = "options"
+	MonitorPriorityField        = "priority"
+	MonitorRestrictedRolesField = "restricted_roles"
+	MonitorTypeField            = "type"
+)
+
+// MutableMonitorFields lists the monitor fields that can be sent in an update request.
+// Read-only fields (id, created, creator, state...) are never sent.
+var MutableMonitorFields = []string{
+	MonitorQueryField,
+	MonitorNameField,
+	MonitorMessageField,
+	MonitorTagsField,
+	MonitorOptionsField,
+	MonitorPriorityField,
+	MonitorRestrictedRolesField,
+	MonitorTypeField,
+}
+
+// MonitorReadOnlyFields are the fields set by Datadog, removed before creating the monitor.
+var MonitorReadOnlyFields = []string{
+	"created",
+	"creator",
+	"deleted",
+	"id",
+	"matching_downtimes",
+	"modified",
+	"overall_state",
+	"overall_state_modified",
+	"state",
+}
+
+// MonitorFieldSet is the set of monitor fields sent on update.
+type MonitorFieldSet map[string]struct{}
+
+// NewMonitorFieldSet returns the allowed fields minus the skipped ones.
+func NewMonitorFieldSet(allowed, skipped []string) (MonitorFieldSet, error) {
+	known := make(map[string]struct{}, len(MutableMonitorFields))
+	for _, field := range MutableMonitorFields {
+		known[field] = struct{}{}
+	}
+
+	fields := MonitorFieldSet{}
+	for _, field := range allowed {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, found := known[field]; !found {
+			return nil, fmt.Errorf("unknown or read-only monitor field: %s", field)
+		}
+		fields[field] = struct{}{}
+	}
+
+	for _, field := range skipped {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if _, found := known[field]; !found {
+			return nil, fmt.Errorf("unknown or read-only monitor field: %s", field)
+		}
+		delete(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no monitor field left to update")
+	}
+
+	return fields, nil
+}
+
+// AllMonitorFields returns the set of all mutable monitor fields.
+func AllMonitorFields() MonitorFieldSet {
+	fields, _ := NewMonitorFieldSet(MutableMonitorFields, nil)
+	return fields
+}
+
+func (fields MonitorFieldSet) Has(field string) bool {
+	_, found := fields[field]
+	return found
+}
+
+// UpdateBody selects the fields of the raw monitor document sent in an update request.
+func (fields MonitorFieldSet) UpdateBody(doc map[string]any) map[string]any {
+	body := make(map[string]any, len(fields))
+	for field := range fields {
+		if value, found := doc[field]; found {
+			body[field] = value
+		}
+	}
+
+	// An empty type is rejected by the API
+	if monitorType, found := body[MonitorTypeField]; found && (monitorType == nil || monitorType == "") {
+		delete(body, MonitorTypeField)
+	}
+
+	return body
+}
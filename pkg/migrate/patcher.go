@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+// Patcher modifies raw object documents in place and reports whether they were changed.
+type Patcher interface {
+	PatchRaw(ctx context.Context, cfg config.Config, objType string, doc map[string]any) (bool, error)
+}
+
+// TypedPatcher is implemented by patchers working on Datadog client types.
+type TypedPatcher interface {
+	PatchMonitor(context.Context, config.Config, *datadogV1.Monitor) (bool, error)
+	PatchDashboard(context.Context, config.Config, *datadogV1.Dashboard) (bool, error)
+}
+
+type objectRefKey struct{}
+
+// WithObjectRef returns a context carrying the reference of the object given to the patcher.
+func WithObjectRef(ctx context.Context, ref ObjectRef) context.Context {
+	return context.WithValue(ctx, objectRefKey{}, ref)
+}
+
+// ObjectRefFromContext returns the reference of the object being patched.
+// There is none for objects without a file, such as Terraform resources.
+func ObjectRefFromContext(ctx context.Context) (ObjectRef, bool) {
+	ref, ok := ctx.Value(objectRefKey{}).(ObjectRef)
+	return ref, ok
+}
+
+// PatcherRef identifies a patcher and its version.
+type PatcherRef struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// PatchTrace collects, for one object, the chained patchers that modified it and the errors of those skipped.
+type PatchTrace struct {
+	Applied []PatcherRef
+	Skipped []error
+}
+
+type patchTraceKey struct{}
+
+// WithPatchTrace returns a context in which patcher chains record what they did to the object in trace.
+func WithPatchTrace(ctx context.Context, trace *PatchTrace) context.Context {
+	return context.WithValue(ctx, patchTraceKey{}, trace)
+}
+
+// PatchTraceFromContext returns the trace of the object being patched, nil if none is collected.
+func PatchTraceFromContext(ctx context.Context) *PatchTrace {
+	trace, _ := ctx.Value(patchTraceKey{}).(*PatchTrace)
+	return trace
+}
+
+// PatcherVersion returns the version of the patcher, if it has one.
+func PatcherVersion(patcher any) string {
+	if versioned, ok := patcher.(interface{ Version() string }); ok {
+		return versioned.Version()
+	}
+	return ""
+}
+
+// NewTypedPatcher runs a patcher working on SDK types against the raw document.
+// Only the values changed by the patcher are written back, other fields are left as is.
+func NewTypedPatcher(patcher TypedPatcher) Patcher {
+	return typedPatcher{patcher: patcher}
+}
+
+type typedPatcher struct {
+	patcher TypedPatcher
+}
+
+func (p typedPatcher) Version() string {
+	return PatcherVersion(p.patcher)
+}
+
+func (p typedPatcher) PatchRaw(ctx context.Context, cfg config.Config, objType string, doc map[string]any) (bool, error) {
+	switch objType {
+	case DashboardType:
+		return patchTypedView(ctx, cfg, doc, &datadogV1.Dashboard{}, p.patcher.PatchDashboard)
+	case MonitorType:
+		return patchTypedView(ctx, cfg, doc, &datadogV1.Monitor{}, p.patcher.PatchMonitor)
+	default:
+		return false, fmt.Errorf("invalid object type: %s", objType)
+	}
+}
+
+type patchFunc[T any] func(context.Context, config.Config, *T) (bool, error)
+
+func patchTypedView[T any](ctx context.Context, cfg config.Config, doc map[string]any, obj *T, patchFunc patchFunc[T]) (bool, error) {
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal JSON, err: %w", err)
+	}
+	if err := json.Unmarshal(content, obj); err != nil {
+		return false, fmt.Errorf("failed to unmarshal JSON, err: %w", err)
+	}
+
+	before, err := typedViewDocument(obj)
+	if err != nil {
+		return false, err
+	}
+
+	patched, err := patchFunc(ctx, cfg, obj)
+	if err != nil {
+		return false, fmt.Errorf("failed to patch object, err: %w", err)
+	}
+	if !patched {
+		return false, nil
+	}
+
+	after, err := typedViewDocument(obj)
+	if err != nil {
+		return false, err
+	}
+
+	mergeChanges(doc, before, after)
+	return true, nil
+}
+
+func typedViewDocument(obj any) (any, error) {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON, err: %w", err)
+	}
+	return DecodeJSON(content)
+}
+
+// mergeChanges applies to dst the differences between before and after, and returns the merged value.
+// Objects and arrays are merged recursively, so that untouched values are kept from dst: array elements equal
+// to an element of before, even at another index, keep its raw element, and the other ones are merged with the
+// element of before at the same index, if any.
+func mergeChanges(dst, before, after any) any {
+	switch afterValue := after.(type) {
+	case map[string]any:
+		dstMap, dstOK := dst.(map[string]any)
+		beforeMap, beforeOK := before.(map[string]any)
+		if !dstOK || !beforeOK {
+			return after
+		}
+
+		for key, value := range afterValue {
+			if previous, found := beforeMap[key]; !found || !reflect.DeepEqual(previous, value) {
+				dstMap[key] = mergeChanges(dstMap[key], previous, value)
+			}
+		}
+		for key := range beforeMap {
+			if _, found := afterValue[key]; !found {
+				delete(dstMap, key)
+			}
+		}
+		return dstMap
+
+	case []any:
+		dstSlice, dstOK := dst.([]any)
+		beforeSlice, beforeOK := before.([]any)
+		if !dstOK || !beforeOK || len(dstSlice) != len(beforeSlice) {
+			return after
+		}
+
+		// Unchanged elements first, so that they are not merged into the elements inserted before them
+		used := make([]bool, len(beforeSlice))
+		merged := make([]any, len(afterValue))
+		changed := make([]bool, len(afterValue))
+		for i, value := range afterValue {
+			if j := unchangedIndex(beforeSlice, used, i, value); j >= 0 {
+				used[j] = true
+				merged[i] = dstSlice[j]
+			} else {
+				changed[i] = true
+			}
+		}
+		for i, value := range afterValue {
+			switch {
+			case !changed[i]:
+			case i < len(beforeSlice) && !used[i]:
+				used[i] = true
+				merged[i] = mergeChanges(dstSlice[i], beforeSlice[i], value)
+			default:
+				merged[i] = value
+			}
+		}
+		return merged
+
+	default:
+		return after
+	}
+}
+
+// unchangedIndex returns the index of an unused element of before equal to value, trying index i first, or -1.
+func unchangedIndex(before []any, used []bool, i int, value any) int {
+	if i < len(before) && !used[i] && reflect.DeepEqual(before[i], value) {
+		return i
+	}
+	for j, elem := range before {
+		if !used[j] && reflect.DeepEqual(elem, value) {
+			return j
+		}
+	}
+	return -1
+}
+
+// PatchFile applies the patcher to the object file at path.
+// It returns the original content and, if the object was patched, the new content written.
+func PatchFile(ctx context.Context, cfg config.Config, path string, ref ObjectRef, patcher Patcher) ([]byte, []byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file at %s, err: %w", path, err)
+	}
+
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return content, nil, fmt.Errorf("failed to unmarshal object at %s, err: %w", path, err)
+	}
+
+	// Apply the patch
+	patched, err := patcher.PatchRaw(WithObjectRef(ctx, ref), cfg, ref.Type, doc)
+	if err != nil {
+		return content, nil, fmt.Errorf("failed to patch object at %s, err: %w", path, err)
+	}
+	if !patched {
+		return content, nil, nil
+	}
+
+	// Write the patched object back to FS
+	newContent, err := MarshalDocument(FileFormat(path), ref.Type, doc)
+	if err != nil {
+		return content, nil, fmt.Errorf("failed to marshal patched object at %s, err: %w", path, err)
+	}
+	err = os.WriteFile(path, newContent, 0o660)
+	if err != nil {
+		return content, nil, fmt.Errorf("failed to write patched object at %s, err: %w", path, err)
+	}
+
+	return content, newContent, nil
+}
+
+// PatchResult is the outcome of the patch of one object file.
+type PatchResult struct {
+	Ref     ObjectRef
+	Path    string
+	Patched bool
+	// Errors of the chained patchers skipped on the object
+	Skipped []error
+	Err     error
+}
+
+// PatchAll applies the patcher to every object file of the store, and records the patched objects in the manifest
+// with the patchers that modified them, such as the patchers of a chain. name identifies the patcher run.
+// fn is called with the outcome of every object, files that cannot be walked are returned as errors.
+func (s Store) PatchAll(ctx context.Context, cfg config.Config, manifest *Manifest, patcher Patcher, name string, fn func(PatchResult)) ([]error, error) {
+	run := PatcherRef{Name: name, Version: PatcherVersion(patcher)}
+
+	return s.Walk(func(path string, ref ObjectRef) {
+		trace := &PatchTrace{}
+		content, newContent, err := PatchFile(WithPatchTrace(ctx, trace), cfg, path, ref, patcher)
+		if err == nil && newContent != nil {
+			applied := trace.Applied
+			if len(applied) == 0 {
+				applied = []PatcherRef{run}
+			}
+			manifest.PatchedBy(ref, content, newContent, run, applied)
+		}
+
+		fn(PatchResult{Ref: ref, Path: path, Patched: newContent != nil, Skipped: trace.Skipped, Err: err})
+	})
+}
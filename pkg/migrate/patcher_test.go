@@ -0,0 +1,151 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+func TestMergeChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		dst    string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "object member changed",
+			dst:    `{"a":1,"b":{"c":1,"unknown":true},"unknown":true}`,
+			before: `{"a":1,"b":{"c":1}}`,
+			after:  `{"a":2,"b":{"c":2}}`,
+			want:   `{"a":2,"b":{"c":2,"unknown":true},"unknown":true}`,
+		},
+		{
+			name:   "object member removed",
+			dst:    `{"a":1,"b":2,"unknown":true}`,
+			before: `{"a":1,"b":2}`,
+			after:  `{"a":1}`,
+			want:   `{"a":1,"unknown":true}`,
+		},
+		{
+			name:   "same length array",
+			dst:    `[{"q":"a","unknown":1},{"q":"b","unknown":2}]`,
+			before: `[{"q":"a"},{"q":"b"}]`,
+			after:  `[{"q":"a"},{"q":"c"}]`,
+			want:   `[{"q":"a","unknown":1},{"q":"c","unknown":2}]`,
+		},
+		{
+			name:   "element appended",
+			dst:    `[{"q":"a","unknown":1},{"q":"b","unknown":2}]`,
+			before: `[{"q":"a"},{"q":"b"}]`,
+			after:  `[{"q":"x"},{"q":"b"},{"q":"c"}]`,
+			want:   `[{"q":"x","unknown":1},{"q":"b","unknown":2},{"q":"c"}]`,
+		},
+		{
+			name:   "element removed in the middle",
+			dst:    `[{"q":"a","unknown":1},{"q":"b","unknown":2},{"q":"c","unknown":3}]`,
+			before: `[{"q":"a"},{"q":"b"},{"q":"c"}]`,
+			after:  `[{"q":"a"},{"q":"c"}]`,
+			want:   `[{"q":"a","unknown":1},{"q":"c","unknown":3}]`,
+		},
+		{
+			name:   "element inserted at the start",
+			dst:    `[{"q":"a","unknown":1},{"q":"b","unknown":2}]`,
+			before: `[{"q":"a"},{"q":"b"}]`,
+			after:  `[{"q":"new"},{"q":"a"},{"q":"b"}]`,
+			want:   `[{"q":"new"},{"q":"a","unknown":1},{"q":"b","unknown":2}]`,
+		},
+		{
+			name:   "elements swapped",
+			dst:    `[{"q":"a","unknown":1},{"q":"b","unknown":2}]`,
+			before: `[{"q":"a"},{"q":"b"}]`,
+			after:  `[{"q":"b"},{"q":"a"}]`,
+			want:   `[{"q":"b","unknown":2},{"q":"a","unknown":1}]`,
+		},
+		{
+			name:   "array emptied",
+			dst:    `[{"q":"a","unknown":1}]`,
+			before: `[{"q":"a"}]`,
+			after:  `[]`,
+			want:   `[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeChanges(mustDecode(t, tt.dst), mustDecode(t, tt.before), mustDecode(t, tt.after))
+			if want := mustDecode(t, tt.want); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
+
+// widgetRemover removes the note widgets of dashboards.
+type widgetRemover struct{}
+
+func (widgetRemover) PatchMonitor(context.Context, config.Config, *datadogV1.Monitor) (bool, error) {
+	return false, nil
+}
+
+func (widgetRemover) PatchDashboard(_ context.Context, _ config.Config, dashboard *datadogV1.Dashboard) (bool, error) {
+	widgets := []datadogV1.Widget{}
+	for _, widget := range dashboard.Widgets {
+		if widget.Definition.NoteWidgetDefinition == nil {
+			widgets = append(widgets, widget)
+		}
+	}
+	patched := len(widgets) != len(dashboard.Widgets)
+	dashboard.Widgets = widgets
+	return patched, nil
+}
+
+func TestTypedPatcherKeepsUnknownFields(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{
+		"title": "a",
+		"layout_type": "ordered",
+		"widgets": [
+			{"definition": {"type": "note", "content": "a"}},
+			{"definition": {"type": "timeseries", "requests": [{"q": "avg:a{*}"}], "new_option": 1}, "unknown": true}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := NewTypedPatcher(widgetRemover{}).PatchRaw(context.Background(), config.Config{}, DashboardType, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patched {
+		t.Fatal("dashboard not patched")
+	}
+
+	want := mustDecode(t, `{
+		"title": "a",
+		"layout_type": "ordered",
+		"widgets": [
+			{"definition": {"type": "timeseries", "requests": [{"q": "avg:a{*}"}], "new_option": 1}, "unknown": true}
+		]
+	}`)
+	if !reflect.DeepEqual(any(doc), want) {
+		got, _ := json.Marshal(doc)
+		t.Errorf("got %s", got)
+	}
+}
+
+func mustDecode(t *testing.T, content string) any {
+	t.Helper()
+	doc, err := DecodeJSON([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DashboardType = "dashboard"
+	MonitorType   = "monitor"
+
+	objRefSep = "-"
+	jsonExt   = ".json"
+	yamlExt   = ".yaml"
+
+	// touchedExt marks the files patched by versions of the tool predating the state manifest
+	touchedExt = ".touched"
+)
+
+// ObjectRef identifies a Datadog object of an org.
+type ObjectRef struct {
+	OrgID int    `json:"ORG_ID"`
+	Type  string `json:"TYPE"`
+	ID    string `json:"ID"`
+}
+
+func (ref ObjectRef) String() string {
+	return strconv.Itoa(ref.OrgID) + "/" + ref.Type + objRefSep + ref.ID
+}
+
+// Less orders references by org, type and ID.
+func (ref ObjectRef) Less(other ObjectRef) bool {
+	if ref.OrgID != other.OrgID {
+		return ref.OrgID < other.OrgID
+	}
+	if ref.Type != other.Type {
+		return ref.Type < other.Type
+	}
+	return ref.ID < other.ID
+}
+
+// ObjectFilePath returns the path of an object file, relative to the objects folder.
+func ObjectFilePath(orgID int, objType, objID, format string) string {
+	// orgID/objType-objID.json or orgID/objType-objID.yaml
+	return filepath.Join(strconv.Itoa(orgID), objType+objRefSep+objID+FormatExt(format))
+}
+
+func parseObjectFileName(name string) (string, string, string, error) {
+	// objType-objID.json or objType-objID.yaml
+	ext := filepath.Ext(name)
+	if ext != jsonExt && ext != yamlExt {
+		return "", "", ext, fmt.Errorf("invalid file extension: %s", ext)
+	}
+
+	// objType-objID
+	base := strings.TrimSuffix(name, ext)
+	split := strings.SplitN(base, objRefSep, 2)
+	if len(split) != 2 {
+		return "", "", ext, fmt.Errorf("invalid file name: %s", name)
+	}
+
+	return split[0], split[1], ext, nil
+}
+
+// ObjectRefFromFile parses the reference of an object file from its org folder and file name.
+func ObjectRefFromFile(folder, name string) (ObjectRef, error) {
+	var objRef ObjectRef
+
+	if orgID, err := strconv.ParseInt(folder, 10, 64); err == nil {
+		objRef.OrgID = int(orgID)
+	} else {
+		return objRef, err
+	}
+
+	objType, objID, _, err := parseObjectFileName(name)
+	if err != nil {
+		return objRef, err
+	}
+
+	if objID != "" {
+		objRef.ID = objID
+	} else {
+		return objRef, fmt.Errorf("invalid object ID: %s", objID)
+	}
+
+	switch objType {
+	case DashboardType, MonitorType:
+		objRef.Type = objType
+	default:
+		return objRef, fmt.Errorf("invalid object type: %s", objType)
+	}
+
+	return objRef, nil
+}
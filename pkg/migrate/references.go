@@ -0,0 +1,90 @@
+package migrate
+
+import (
+	"regexp"
+)
+
+// linkPrefix matches the start of links to the Datadog app: a Datadog host, or a relative link that is not
+// part of another URL or path.
+const linkPrefix = `(?:https?://(?:[a-z0-9-]+\.)*(?:datadoghq\.com|datadoghq\.eu|ddog-gov\.com)|^|[\s("'\[<>=,;])`
+
+var (
+	monitorLinkRegexp     = regexp.MustCompile(linkPrefix + `/monitors/(\d+)\b`)
+	dashboardLinkRegexp   = regexp.MustCompile(linkPrefix + `/dashboard/([a-z0-9]{3}-[a-z0-9]{3}-[a-z0-9]{3})\b`)
+	compositeIDRegexp     = regexp.MustCompile(`\b\d+\b`)
+	sloQueryIDRegexp      = regexp.MustCompile(`(?:error_budget|burn_rate)\("([a-f0-9]{32})"\)`)
+	monitorSearchIDRegexp = regexp.MustCompile(`\bid:(\d+)\b`)
+)
+
+// SLOType is the type of SLO references. SLOs are not handled by the tool: they are reported but never dumped or copied.
+const SLOType = "slo"
+
+// ReferenceVisitor is called for every reference to another object and returns the ID to use instead.
+type ReferenceVisitor func(objType, id string) string
+
+// VisitReferences walks a raw JSON object and calls visit for every reference to another object:
+//   - monitor IDs in composite monitor queries
+//   - monitor IDs in widgets (`alert_id` of alert graph and alert value widgets, `id:<id>` in the monitor
+//     search query of monitor summary widgets)
+//   - links to monitors and dashboards of the Datadog app in any string (custom links, notes, messages)
+//   - SLO IDs in SLO alert monitor queries and in SLO widgets (`slo_id`)
+//
+// References are replaced in place by the IDs returned by visit.
+func VisitReferences(objType string, doc any, visit ReferenceVisitor) any {
+	if obj, ok := doc.(map[string]any); ok && objType == MonitorType {
+		if query, ok := obj["query"].(string); ok {
+			switch obj["type"] {
+			case "composite":
+				obj["query"] = compositeIDRegexp.ReplaceAllStringFunc(query, func(id string) string {
+					return visit(MonitorType, id)
+				})
+			case "slo alert":
+				obj["query"] = replaceLinkIDs(query, sloQueryIDRegexp, SLOType, visit)
+			}
+		}
+	}
+
+	return visitValue(doc, visit)
+}
+
+func visitValue(value any, visit ReferenceVisitor) any {
+	switch v := value.(type) {
+	case map[string]any:
+		if query, ok := v["query"].(string); ok && v["type"] == "manage_status" {
+			v["query"] = replaceLinkIDs(query, monitorSearchIDRegexp, MonitorType, visit)
+		}
+		for key, child := range v {
+			if id, ok := child.(string); ok && key == "alert_id" {
+				v[key] = visit(MonitorType, id)
+				continue
+			}
+			if id, ok := child.(string); ok && key == "slo_id" {
+				v[key] = visit(SLOType, id)
+				continue
+			}
+			v[key] = visitValue(child, visit)
+		}
+		return v
+
+	case []any:
+		for i, child := range v {
+			v[i] = visitValue(child, visit)
+		}
+		return v
+
+	case string:
+		v = replaceLinkIDs(v, monitorLinkRegexp, MonitorType, visit)
+		return replaceLinkIDs(v, dashboardLinkRegexp, DashboardType, visit)
+
+	default:
+		return v
+	}
+}
+
+// replaceLinkIDs replaces the IDs captured by the first group of linkRegexp.
+func replaceLinkIDs(s string, linkRegexp *regexp.Regexp, objType string, visit ReferenceVisitor) string {
+	return linkRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		loc := linkRegexp.FindStringSubmatchIndex(match)
+		return match[:loc[2]] + visit(objType, match[loc[2]:loc[3]]) + match[loc[3]:]
+	})
+}
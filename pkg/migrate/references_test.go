@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVisitReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		objType  string
+		input    string
+		wantRefs []string
+	}{
+		{
+			name:     "composite monitor",
+			objType:  MonitorType,
+			input:    `{"type":"composite","query":"123 && !456","message":"See /monitors/789"}`,
+			wantRefs: []string{"monitor 123", "monitor 456", "monitor 789"},
+		},
+		{
+			name:     "SLO alert monitor",
+			objType:  MonitorType,
+			input:    `{"type":"slo alert","query":"error_budget(\"0123456789abcdef0123456789abcdef\").over(\"7d\") > 50"}`,
+			wantRefs: []string{"slo 0123456789abcdef0123456789abcdef"},
+		},
+		{
+			name:    "Datadog and relative links",
+			objType: MonitorType,
+			input: `{"type":"metric alert","query":"avg:a{*} > 1","message":` +
+				`"https://app.datadoghq.com/monitors/1 https://us5.datadoghq.com/dashboard/abc-def-ghi/x [b](/monitors/2)\n/dashboard/jkl-mno-pqr"}`,
+			wantRefs: []string{"monitor 1", "dashboard abc-def-ghi", "monitor 2", "dashboard jkl-mno-pqr"},
+		},
+		{
+			name:    "external links",
+			objType: MonitorType,
+			input: `{"type":"metric alert","query":"avg:a{*} > 1","message":` +
+				`"https://example.com/monitors/1 https://datadoghq.com.example.com/monitors/2 https://grafana/d/dashboard/abc-def-ghi /api/monitors/3 /monitors/4abc"}`,
+			wantRefs: []string{},
+		},
+		{
+			name:    "dashboard widgets",
+			objType: DashboardType,
+			input: `{"widgets":[
+				{"definition":{"type":"alert_graph","alert_id":"10"}},
+				{"definition":{"type":"group","widgets":[{"definition":{"type":"alert_value","alert_id":"11"}}]}},
+				{"definition":{"type":"manage_status","query":"id:12 OR tag:team:a"}},
+				{"definition":{"type":"check_status","check":"id:13","grouping":"check"}},
+				{"definition":{"type":"slo","slo_id":"abcdef"}}
+			]}`,
+			wantRefs: []string{"monitor 10", "monitor 11", "monitor 12", "slo abcdef"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseDocument([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refs := []string{}
+			VisitReferences(tt.objType, doc, func(objType, id string) string {
+				refs = append(refs, objType+" "+id)
+				return id
+			})
+			if !sameElements(refs, tt.wantRefs) {
+				t.Errorf("got %q, want %q", refs, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestVisitReferencesReplacesIDs(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{
+		"type": "composite",
+		"query": "1 || 2",
+		"message": "[Runbook](https://app.datadoghq.com/monitors/1?from_ts=0) https://example.com/monitors/1"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	VisitReferences(MonitorType, doc, func(objType, id string) string {
+		return id + "0"
+	})
+
+	want := map[string]any{
+		"type":    "composite",
+		"query":   "10 || 20",
+		"message": "[Runbook](https://app.datadoghq.com/monitors/10?from_ts=0) https://example.com/monitors/1",
+	}
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("got %v", doc)
+	}
+}
+
+// sameElements compares string slices regardless of order, as objects are visited in map order.
+func sameElements(a, b []string) bool {
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+	}
+	for _, count := range counts {
+		if count != 0 {
+			return false
+		}
+	}
+	return true
+}
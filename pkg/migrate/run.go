@@ -0,0 +1,465 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/client"
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+// Alerting policies of Run, for monitors alerting when they are about to be updated.
+const (
+	SkipAlerting  = "skip"
+	DeferAlerting = "defer"
+	ForceAlerting = "force"
+)
+
+// Outcomes of the objects processed by Run.
+const (
+	FailedOutcome    = "failed"
+	UpdatedOutcome   = "updated"
+	RecreatedOutcome = "recreated"
+	AlertingOutcome  = "skipped-alerting"
+	SkippedOutcome   = "skipped"
+)
+
+// RunOptions configures Updater.Run. The zero value updates the pending objects in a single wave,
+// alerting monitors included.
+type RunOptions struct {
+	// All updates all object files, not just the pending ones.
+	All bool
+	// Filter removes the objects not to update from the selected files, before validation.
+	// It returns the errors of the files that could not be checked.
+	Filter func(files map[ObjectRef]string) ([]error, error)
+	// Validate validates all monitors with the Datadog API before the first update.
+	Validate bool
+	// CreateMissing recreates objects that no longer exist, their file is moved to the new reference.
+	CreateMissing bool
+	// Verify fetches objects after update and checks they match their file.
+	Verify bool
+
+	// AlertingPolicy is SkipAlerting, DeferAlerting or ForceAlerting (default).
+	// Deferred monitors are retried every DeferInterval, which must be positive, until DeferTimeout, after the waves.
+	AlertingPolicy string
+	DeferInterval  time.Duration
+	DeferTimeout   time.Duration
+
+	// MuteDuring mutes each monitor with a downtime of this duration before updating it, reported in the
+	// Downtime of its result. The downtimes of each wave are cancelled after MuteSettle, if set.
+	MuteDuring time.Duration
+	MuteSettle time.Duration
+	// OnUnmute is called for every downtime cancelled after the settle period.
+	// Errors are returned as failures of the run.
+	OnUnmute func(rec DowntimeRecord) error
+
+	// Waves splits the objects to update in ordered waves. All objects are updated in one wave if nil.
+	Waves func(refs []ObjectRef) ([][]ObjectRef, error)
+	// BeforeWave is called before every wave but the first one, and AfterWave after every wave.
+	// An error halts the run.
+	BeforeWave func(ctx context.Context, wave, waveCount int) error
+	AfterWave  func(stats WaveStats) error
+
+	// OnResult is called for every object once its outcome is recorded in the manifest, including the objects
+	// skipped after a halt, with the state of the object before the update, nil if it was not tracked.
+	// Errors are returned as failures of the run.
+	OnResult func(res UpdateResult, before *ObjectState) error
+}
+
+// UpdateResult is the outcome of the update of one object.
+type UpdateResult struct {
+	Ref  ObjectRef
+	Path string
+	// Content of the object file, moved to NewRef for recreated objects
+	Content  []byte
+	NewRef   *ObjectRef
+	Downtime *DowntimeRecord
+	Alerting bool
+	// Mutated reports whether the object was changed in Datadog, even if a later step failed
+	Mutated  bool
+	Verified bool
+	Mismatch bool
+	// Skipped reports that the wave of the object was not started after a halt
+	Skipped bool
+	// Wave is the 1-based index of the wave of the object
+	Wave int
+	// Duration of the last update attempt
+	Duration time.Duration
+	Err      error
+}
+
+func (res UpdateResult) Outcome() string {
+	switch {
+	case res.Err != nil:
+		return FailedOutcome
+	case res.Skipped:
+		return SkippedOutcome
+	case res.Alerting:
+		return AlertingOutcome
+	case res.NewRef != nil:
+		return RecreatedOutcome
+	default:
+		return UpdatedOutcome
+	}
+}
+
+// WaveStats counts the failures and verification mismatches of a wave.
+type WaveStats struct {
+	Total      int
+	Failed     int
+	Mismatched int
+}
+
+func (stats *WaveStats) add(res UpdateResult) {
+	stats.Total++
+	if res.Err != nil {
+		stats.Failed++
+	}
+	if res.Mismatch {
+		stats.Mismatched++
+	}
+}
+
+// RunResult is the outcome of Updater.Run.
+type RunResult struct {
+	// Files are the selected object files, after filtering.
+	Files map[ObjectRef]string
+	// Results are the outcomes of the processed objects, in order.
+	Results []UpdateResult
+	// Skipped are the objects of the waves not started after a halt.
+	Skipped []ObjectRef
+	// Failures are the errors not attached to an object, such as files that could not be read.
+	Failures []error
+	// Halt is the reason why the run stopped before the last wave.
+	Halt error
+}
+
+// ValidationError lists the monitors that failed validation, by reference.
+type ValidationError struct {
+	Invalid map[ObjectRef]error
+}
+
+func (err *ValidationError) Error() string {
+	return fmt.Sprintf("aborted update, %d monitors failed validation", len(err.Invalid))
+}
+
+// Select returns the object files to update: all of them or only the ones pending in the manifest.
+func (s Store) Select(manifest *Manifest, all bool) (map[ObjectRef]string, []error, error) {
+	selected := map[ObjectRef]string{}
+	var readFailures []error
+
+	failures, err := s.Walk(func(path string, ref ObjectRef) {
+		if !all {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				readFailures = append(readFailures, fmt.Errorf("failed to read file at %s, err: %w", path, err))
+				return
+			}
+			if !manifest.Pending(ref, content) {
+				return
+			}
+		}
+
+		selected[ref] = path
+	})
+
+	return selected, append(failures, readFailures...), err
+}
+
+// ValidateFiles validates every monitor in files, with the credentials of its org, and returns the validation
+// errors by reference. Monitors that no longer exist are validated as new monitors.
+func (u *Updater) ValidateFiles(ctx context.Context, cfg config.Config, files map[ObjectRef]string) map[ObjectRef]error {
+	invalid := map[ObjectRef]error{}
+
+	i := 0
+	for ref, path := range files {
+		if ref.Type != MonitorType {
+			continue
+		}
+
+		if i%10 == 0 {
+			log.Println("Progressing, validating monitor", i)
+		}
+		i++
+
+		if err := u.validateFile(ctx, cfg, ref, path); err != nil {
+			invalid[ref] = err
+		}
+	}
+
+	return invalid
+}
+
+func (u *Updater) validateFile(ctx context.Context, cfg config.Config, ref ObjectRef, path string) error {
+	// Set proper creds
+	credCtx, err := client.DatadogCredentials(ctx, cfg, ref.OrgID)
+	if err != nil {
+		return fmt.Errorf("%w object type: %s, id: %s", err, ref.Type, ref.ID)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file at %s, err: %w", path, err)
+	}
+
+	return u.Validate(credCtx, ref, content)
+}
+
+// Run updates the objects of the store in Datadog and records them in the manifest, which is saved at the end
+// of the run and whenever a downtime is created. The objects are selected, filtered and validated first, any
+// error at this stage stops the run before the first update.
+func (u *Updater) Run(ctx context.Context, cfg config.Config, store Store, manifest *Manifest, opts RunOptions) (RunResult, error) {
+	result := RunResult{}
+
+	if opts.AlertingPolicy == DeferAlerting && opts.DeferInterval <= 0 {
+		return result, fmt.Errorf("invalid defer interval %s, it must be positive", opts.DeferInterval)
+	}
+
+	files, failures, err := store.Select(manifest, opts.All)
+	result.Failures = append(result.Failures, failures...)
+	if err != nil {
+		return result, err
+	}
+	if opts.Filter != nil {
+		failures, err := opts.Filter(files)
+		result.Failures = append(result.Failures, failures...)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Files = files
+
+	// Validate all monitors before the first write
+	if opts.Validate {
+		if invalid := u.ValidateFiles(ctx, cfg, files); len(invalid) > 0 {
+			return result, &ValidationError{Invalid: invalid}
+		}
+	}
+
+	refs := make([]ObjectRef, 0, len(files))
+	for ref := range files {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Less(refs[j])
+	})
+	waves := [][]ObjectRef{refs}
+	if opts.Waves != nil {
+		if waves, err = opts.Waves(refs); err != nil {
+			return result, err
+		}
+	}
+
+	// Downtimes created since the last settle period
+	createdDowntimes := []DowntimeRecord{}
+	settle := func() {
+		if opts.MuteSettle <= 0 || len(createdDowntimes) == 0 {
+			return
+		}
+		failures := u.settleAndUnmute(ctx, cfg, manifest, createdDowntimes, opts.MuteSettle, opts.OnUnmute)
+		result.Failures = append(result.Failures, failures...)
+		createdDowntimes = []DowntimeRecord{}
+	}
+	record := func(res UpdateResult) {
+		// Persist downtimes right away, so an aborted run can clean them up
+		if res.Downtime != nil {
+			createdDowntimes = append(createdDowntimes, *res.Downtime)
+			manifest.Downtimes = append(manifest.Downtimes, *res.Downtime)
+			if err := manifest.Save(); err != nil {
+				result.Failures = append(result.Failures, err)
+			}
+		}
+
+		var before *ObjectState
+		if state := manifest.Get(res.Ref); state != nil {
+			copied := *state
+			before = &copied
+		}
+
+		switch res.Outcome() {
+		case RecreatedOutcome:
+			manifest.Recreated(res.Ref, *res.NewRef, res.Content)
+		case UpdatedOutcome:
+			manifest.Updated(res.Ref, res.Content)
+			if res.Verified {
+				manifest.Verified(res.Ref)
+			}
+		}
+
+		result.Results = append(result.Results, res)
+		if opts.OnResult != nil {
+			if err := opts.OnResult(res, before); err != nil {
+				result.Failures = append(result.Failures, err)
+			}
+		}
+	}
+
+	i, nextWave := 0, 0
+	deferred := []UpdateResult{}
+	for waveIndex, wave := range waves {
+		if waveIndex > 0 && opts.BeforeWave != nil {
+			if err := opts.BeforeWave(ctx, waveIndex, len(waves)); err != nil {
+				result.Halt = err
+				break
+			}
+		}
+		if len(waves) > 1 {
+			log.Println("Starting wave", waveIndex+1, "out of", len(waves), "with", len(wave), "objects")
+		}
+
+		nextWave++
+
+		stats := WaveStats{}
+		for _, ref := range wave {
+			if i%10 == 0 {
+				log.Println("Progressing, updating", ref.Type, "object", i, "out of", len(files))
+			}
+			i++
+
+			start := time.Now()
+			res := u.updateObject(ctx, cfg, store, ref, files[ref], opts)
+			res.Wave, res.Duration = waveIndex+1, time.Since(start)
+			stats.add(res)
+
+			if res.Alerting && opts.AlertingPolicy == DeferAlerting {
+				deferred = append(deferred, res)
+				continue
+			}
+			record(res)
+		}
+		settle()
+
+		if opts.AfterWave != nil {
+			if err := opts.AfterWave(stats); err != nil {
+				result.Halt = fmt.Errorf("halted after wave %d out of %d: %w", waveIndex+1, len(waves), err)
+				break
+			}
+		}
+	}
+
+	// Retry deferred monitors until they are no longer alerting or the timeout is reached
+	deadline := time.Now().Add(opts.DeferTimeout)
+	for len(deferred) > 0 && result.Halt == nil && time.Now().Add(opts.DeferInterval).Before(deadline) {
+		log.Println("Waiting", opts.DeferInterval, "before retrying", len(deferred), "alerting monitors")
+		select {
+		case <-ctx.Done():
+			result.Halt = fmt.Errorf("stopped while waiting for alerting monitors: %w", ctx.Err())
+		case <-time.After(opts.DeferInterval):
+		}
+		if result.Halt != nil {
+			break
+		}
+
+		stillAlerting := []UpdateResult{}
+		for _, prev := range deferred {
+			start := time.Now()
+			res := u.updateObject(ctx, cfg, store, prev.Ref, prev.Path, opts)
+			res.Wave, res.Duration = prev.Wave, time.Since(start)
+			if res.Alerting {
+				stillAlerting = append(stillAlerting, res)
+				continue
+			}
+			record(res)
+		}
+		deferred = stillAlerting
+	}
+	for _, res := range deferred {
+		record(res)
+	}
+
+	for waveIndex := nextWave; waveIndex < len(waves); waveIndex++ {
+		for _, ref := range waves[waveIndex] {
+			result.Skipped = append(result.Skipped, ref)
+			record(UpdateResult{Ref: ref, Path: files[ref], Skipped: true, Wave: waveIndex + 1})
+		}
+	}
+
+	// Deferred alerting monitors are updated after the waves
+	settle()
+
+	if err := manifest.Save(); err != nil {
+		result.Failures = append(result.Failures, err)
+	}
+
+	return result, nil
+}
+
+// updateObject updates a single object, recreating it if needed, and verifies it when requested.
+func (u *Updater) updateObject(ctx context.Context, cfg config.Config, store Store, ref ObjectRef, path string, opts RunOptions) UpdateResult {
+	res := UpdateResult{Ref: ref, Path: path}
+
+	// Set proper creds
+	credCtx, err := client.DatadogCredentials(ctx, cfg, ref.OrgID)
+	if err != nil {
+		res.Err = fmt.Errorf("%w object type: %s, id: %s", err, ref.Type, ref.ID)
+		return res
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		res.Err = fmt.Errorf("failed to read file at %s, err: %w", path, err)
+		return res
+	}
+	res.Content = content
+
+	if opts.AlertingPolicy != "" && opts.AlertingPolicy != ForceAlerting && ref.Type == MonitorType {
+		alerting, err := u.Alerting(credCtx, ref)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		if alerting {
+			res.Alerting = true
+			return res
+		}
+	}
+
+	if opts.MuteDuring > 0 && ref.Type == MonitorType {
+		downtime, err := u.Mute(credCtx, ref, opts.MuteDuring)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Downtime = downtime
+	}
+
+	notFound, err := u.Update(credCtx, ref, content)
+	if notFound && opts.CreateMissing {
+		newRef, newContent, err := u.Create(credCtx, ref, content)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.NewRef = &newRef
+		res.Mutated = true
+
+		movedContent, err := store.MoveRecreated(path, newRef, newContent)
+		if err != nil {
+			res.Err = fmt.Errorf("recreated %s as %s but failed to move its file, err: %w", ref, newRef, err)
+			return res
+		}
+		res.Content = movedContent
+		return res
+	}
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Mutated = true
+
+	if opts.Verify {
+		matches, err := u.Verify(credCtx, ref, content)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Verified = matches
+		res.Mismatch = !matches
+	}
+
+	return res
+}
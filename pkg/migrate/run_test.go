@@ -0,0 +1,301 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+)
+
+// fakeMonitors serves the monitor and downtime endpoints used by Run. Updates of failing monitors are rejected,
+// and alerting monitors report an alert state for the given number of fetches.
+type fakeMonitors struct {
+	mu        sync.Mutex
+	failing   map[string]bool
+	alerting  map[string]int
+	updated   []string
+	downtimes []string
+}
+
+func (f *fakeMonitors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/monitor/")
+	w.Header().Set("Content-Type", "application/json")
+
+	if strings.HasPrefix(r.URL.Path, "/api/v1/downtime") {
+		switch r.Method {
+		case http.MethodPost:
+			f.downtimes = append(f.downtimes, "created")
+			fmt.Fprintf(w, `{"id": %d}`, len(f.downtimes))
+		case http.MethodDelete:
+			f.downtimes = append(f.downtimes, "cancelled "+strings.TrimPrefix(r.URL.Path, "/api/v1/downtime/"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		state := "OK"
+		if f.alerting[id] != 0 {
+			state = "Alert"
+			f.alerting[id]--
+		}
+		fmt.Fprintf(w, `{"id": %s, "type": "metric alert", "query": "avg:x{*} > 1", "overall_state": %q}`, id, state)
+
+	case http.MethodPut:
+		if f.failing[id] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors": ["invalid query"]}`))
+			return
+		}
+		f.updated = append(f.updated, id)
+		fmt.Fprintf(w, `{"id": %s, "type": "metric alert", "query": "avg:x{*} > 1"}`, id)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRun(t *testing.T) {
+	oneWavePerObject := func(refs []ObjectRef) ([][]ObjectRef, error) {
+		waves := [][]ObjectRef{}
+		for _, ref := range refs {
+			waves = append(waves, []ObjectRef{ref})
+		}
+		return waves, nil
+	}
+	haltOnFailure := func(stats WaveStats) error {
+		if stats.Failed > 0 {
+			return fmt.Errorf("%d failures", stats.Failed)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		opts        RunOptions
+		failing     map[string]bool
+		alerting    map[string]int
+		want        []string
+		wantUpdated []string
+		wantHalt    bool
+		wantErr     bool
+	}{
+		{
+			name:        "single wave",
+			want:        []string{"1 updated 1", "2 updated 1", "3 updated 1"},
+			wantUpdated: []string{"1", "2", "3"},
+		},
+		{
+			name:        "failures do not stop a wave",
+			failing:     map[string]bool{"2": true},
+			want:        []string{"1 updated 1", "2 failed 1", "3 updated 1"},
+			wantUpdated: []string{"1", "3"},
+		},
+		{
+			name:        "waves",
+			opts:        RunOptions{Waves: oneWavePerObject, AfterWave: haltOnFailure},
+			want:        []string{"1 updated 1", "2 updated 2", "3 updated 3"},
+			wantUpdated: []string{"1", "2", "3"},
+		},
+		{
+			name:        "halt after a wave over the threshold",
+			opts:        RunOptions{Waves: oneWavePerObject, AfterWave: haltOnFailure},
+			failing:     map[string]bool{"2": true},
+			want:        []string{"1 updated 1", "2 failed 2", "3 skipped 3"},
+			wantUpdated: []string{"1"},
+			wantHalt:    true,
+		},
+		{
+			name: "halt before a wave",
+			opts: RunOptions{Waves: oneWavePerObject, BeforeWave: func(ctx context.Context, wave, waveCount int) error {
+				return errors.New("stopped")
+			}},
+			want:        []string{"1 updated 1", "2 skipped 2", "3 skipped 3"},
+			wantUpdated: []string{"1"},
+			wantHalt:    true,
+		},
+		{
+			name:        "skip alerting monitors",
+			opts:        RunOptions{AlertingPolicy: SkipAlerting},
+			alerting:    map[string]int{"2": -1},
+			want:        []string{"1 updated 1", "2 skipped-alerting 1", "3 updated 1"},
+			wantUpdated: []string{"1", "3"},
+		},
+		{
+			name:        "force alerting monitors",
+			opts:        RunOptions{AlertingPolicy: ForceAlerting},
+			alerting:    map[string]int{"2": -1},
+			want:        []string{"1 updated 1", "2 updated 1", "3 updated 1"},
+			wantUpdated: []string{"1", "2", "3"},
+		},
+		{
+			name: "defer alerting monitors until they recover",
+			opts: RunOptions{
+				Waves:          oneWavePerObject,
+				AlertingPolicy: DeferAlerting,
+				DeferInterval:  time.Millisecond,
+				DeferTimeout:   time.Second,
+			},
+			alerting:    map[string]int{"1": 2},
+			want:        []string{"2 updated 2", "3 updated 3", "1 updated 1"},
+			wantUpdated: []string{"2", "3", "1"},
+		},
+		{
+			name: "defer alerting monitors until the timeout",
+			opts: RunOptions{
+				AlertingPolicy: DeferAlerting,
+				DeferInterval:  time.Millisecond,
+				DeferTimeout:   20 * time.Millisecond,
+			},
+			alerting:    map[string]int{"1": -1},
+			want:        []string{"2 updated 1", "3 updated 1", "1 skipped-alerting 1"},
+			wantUpdated: []string{"2", "3"},
+		},
+		{
+			name:    "defer without interval",
+			opts:    RunOptions{AlertingPolicy: DeferAlerting},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			directory := t.TempDir()
+			orgDir := filepath.Join(directory, "3000")
+			if err := os.MkdirAll(orgDir, 0o770); err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"1", "2", "3"} {
+				content := fmt.Sprintf(`{"id": %s, "name": "monitor %s", "query": "avg:x{*} > 1"}`, id, id)
+				if err := os.WriteFile(filepath.Join(orgDir, "monitor-"+id+".json"), []byte(content), 0o660); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			api := &fakeMonitors{failing: tt.failing, alerting: tt.alerting}
+			updater := newTestUpdater(t, api.ServeHTTP, AllMonitorFields())
+			cfg := config.Config{Credentials: map[string]config.DatadogCredential{"3000": {}}}
+			store := NewStore(directory)
+			manifest, err := store.LoadManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			opts := tt.opts
+			opts.All = true
+			opts.OnResult = func(res UpdateResult, _ *ObjectState) error {
+				got = append(got, fmt.Sprintf("%s %s %d", res.Ref.ID, res.Outcome(), res.Wave))
+				return nil
+			}
+
+			result, err := updater.Run(context.Background(), cfg, store, manifest, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (result.Halt != nil) != tt.wantHalt {
+				t.Errorf("got halt %v", result.Halt)
+			}
+			if len(result.Failures) > 0 {
+				t.Errorf("got failures %v", result.Failures)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got results %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(api.updated, tt.wantUpdated) && len(api.updated)+len(tt.wantUpdated) > 0 {
+				t.Errorf("got updates %q, want %q", api.updated, tt.wantUpdated)
+			}
+
+			// Only the updated monitors are recorded in the manifest
+			for _, id := range []string{"1", "2", "3"} {
+				ref := ObjectRef{OrgID: 3000, Type: MonitorType, ID: id}
+				updated := manifest.Get(ref) != nil
+				if want := contains(tt.wantUpdated, id); updated != want {
+					t.Errorf("got monitor %s recorded %v, want %v", id, updated, want)
+				}
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunMute(t *testing.T) {
+	directory := t.TempDir()
+	orgDir := filepath.Join(directory, "3000")
+	if err := os.MkdirAll(orgDir, 0o770); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		content := fmt.Sprintf(`{"id": %s, "name": "monitor %s", "query": "avg:x{*} > 1"}`, id, id)
+		if err := os.WriteFile(filepath.Join(orgDir, "monitor-"+id+".json"), []byte(content), 0o660); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api := &fakeMonitors{failing: map[string]bool{"2": true}}
+	updater := newTestUpdater(t, api.ServeHTTP, AllMonitorFields())
+	cfg := config.Config{Credentials: map[string]config.DatadogCredential{"3000": {}}}
+	store := NewStore(directory)
+	manifest, err := store.LoadManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Downtimes are reported when created, even if the update fails, and when cancelled after the settle period
+	got := []string{}
+	opts := RunOptions{
+		All:        true,
+		MuteDuring: time.Hour,
+		MuteSettle: time.Millisecond,
+		OnResult: func(res UpdateResult, _ *ObjectState) error {
+			if res.Downtime != nil {
+				got = append(got, fmt.Sprintf("muted %s %d", res.Downtime.MonitorID, res.Downtime.DowntimeID))
+			}
+			return nil
+		},
+		OnUnmute: func(rec DowntimeRecord) error {
+			got = append(got, fmt.Sprintf("unmuted %s %d", rec.MonitorID, rec.DowntimeID))
+			return nil
+		},
+	}
+
+	if _, err := updater.Run(context.Background(), cfg, store, manifest, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"muted 1 1", "muted 2 2", "unmuted 1 1", "unmuted 2 2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	wantCalls := []string{"created", "created", "cancelled 1", "cancelled 2"}
+	if !reflect.DeepEqual(api.downtimes, wantCalls) {
+		t.Errorf("got downtime calls %q, want %q", api.downtimes, wantCalls)
+	}
+	if len(manifest.Downtimes) > 0 {
+		t.Errorf("got downtimes left in the manifest %v", manifest.Downtimes)
+	}
+}
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Store is a folder of object files, stored as orgID/objType-objID.json (or .yaml),
+// with the state manifest at its root.
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) Store {
+	return Store{Dir: dir}
+}
+
+// Path returns the path of the object file in the given format.
+func (s Store) Path(ref ObjectRef, format string) string {
+	return filepath.Join(s.Dir, ObjectFilePath(ref.OrgID, ref.Type, ref.ID, format))
+}
+
+// Find returns the path of the object file in any format, if it exists.
+func (s Store) Find(ref ObjectRef) (string, bool) {
+	return ExistingObjectFile(s.Path(ref, JSONFormat))
+}
+
+// LoadManifest reads the state manifest of the store.
+func (s Store) LoadManifest() (*Manifest, error) {
+	return LoadManifest(s.Dir)
+}
+
+// Walk calls fn for every object file in the store.
+// Hidden files, such as the state manifest, and legacy .touched markers are skipped.
+// Files that cannot be walked or parsed are returned as errors, the walk continues.
+func (s Store) Walk(fn func(path string, ref ObjectRef)) ([]error, error) {
+	var failures []error
+
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		// If d is nil, it means we were not able to go into the root directory.
+		if d == nil {
+			return err
+		}
+
+		// Skip non-regular and hidden files, and legacy markers.
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") || filepath.Ext(d.Name()) == touchedExt {
+			return nil
+		}
+
+		// If we fail on a file, we just record the error and continue.
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to walk file at %s, err: %w", path, err))
+			return nil
+		}
+
+		ref, err := ObjectRefFromFile(filepath.Base(filepath.Dir(path)), d.Name())
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to parse file name at %s, err: %w", path, err))
+			return nil
+		}
+
+		fn(path, ref)
+		return nil
+	})
+
+	return failures, err
+}
+
+// Write stores the object in the given format and removes its files in other formats.
+// It returns the path and the content written.
+func (s Store) Write(ref ObjectRef, format string, obj any) (string, []byte, error) {
+	orgDir := filepath.Join(s.Dir, strconv.Itoa(ref.OrgID))
+	if err := os.MkdirAll(orgDir, 0o770); err != nil {
+		return "", nil, fmt.Errorf("failed to create output folder %s: %w", orgDir, err)
+	}
+
+	path := s.Path(ref, format)
+	objBytes, err := MarshalObject(format, ref.Type, obj)
+	if err != nil {
+		return path, nil, fmt.Errorf("failed to marshal object from org: %d, type: %s, id: %s: %w", ref.OrgID, ref.Type, ref.ID, err)
+	}
+
+	if err := os.WriteFile(path, objBytes, 0o660); err != nil {
+		return path, nil, fmt.Errorf("failed to write object from org: %d, type: %s, id: %s: %w", ref.OrgID, ref.Type, ref.ID, err)
+	}
+
+	// Switching format replaces the object file
+	if err := RemoveOtherFormats(path); err != nil {
+		return path, nil, err
+	}
+
+	return path, objBytes, nil
+}
+
+// MoveRecreated writes the recreated object at its new path, in the format of the old file, and removes the old file.
+// It returns the content written.
+func (s Store) MoveRecreated(oldPath string, newRef ObjectRef, newContent any) ([]byte, error) {
+	format := FileFormat(oldPath)
+	newPath := s.Path(newRef, format)
+
+	objBytes, err := MarshalObject(format, newRef.Type, newContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal recreated object at %s, err: %w", newPath, err)
+	}
+
+	if err := os.WriteFile(newPath, objBytes, 0o660); err != nil {
+		return nil, fmt.Errorf("failed to write recreated object at %s, err: %w", newPath, err)
+	}
+
+	if err := os.Remove(oldPath); err != nil {
+		return nil, fmt.Errorf("failed to remove old object at %s, err: %w", oldPath, err)
+	}
+
+	return objBytes, nil
+}
@@ -0,0 +1,237 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+)
+
+// Updater pushes object files to Datadog. The context given to its methods must carry the
+// credentials of the org of the object.
+type Updater struct {
+	// MonitorFields are the monitor fields sent on update and compared on verification.
+	MonitorFields MonitorFieldSet
+
+	dashAPI      *datadogV1.DashboardsApi
+	monitorsAPI  *datadogV1.MonitorsApi
+	downtimesAPI *datadogV1.DowntimesApi
+}
+
+func NewUpdater(datadogClient *datadog.APIClient, monitorFields MonitorFieldSet) *Updater {
+	return &Updater{
+		MonitorFields: monitorFields,
+		dashAPI:       datadogV1.NewDashboardsApi(datadogClient),
+		monitorsAPI:   datadogV1.NewMonitorsApi(datadogClient),
+		downtimesAPI:  datadogV1.NewDowntimesApi(datadogClient),
+	}
+}
+
+// Update pushes the object content to Datadog.
+// The raw document is sent, so fields unknown to the Datadog client are kept.
+// It reports whether the failure was caused by the object not existing anymore.
+func (u *Updater) Update(ctx context.Context, ref ObjectRef, content []byte) (bool, error) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	switch ref.Type {
+	case DashboardType:
+		_, httpResp, err := u.dashAPI.UpdateDashboard(ctx, ref.ID, datadogV1.Dashboard{UnparsedObject: doc})
+		if err != nil {
+			return IsNotFound(httpResp), fmt.Errorf("failed to update dashboard %s, err: %w", ref.ID, err)
+		}
+
+	case MonitorType:
+		intID, err := strconv.Atoi(ref.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
+		}
+
+		body := datadogV1.MonitorUpdateRequest{UnparsedObject: u.MonitorFields.UpdateBody(doc)}
+		_, httpResp, err := u.monitorsAPI.UpdateMonitor(ctx, int64(intID), body)
+		if err != nil {
+			return IsNotFound(httpResp), fmt.Errorf("failed to update monitor %s, err: %w", ref.ID, err)
+		}
+
+	default:
+		return false, fmt.Errorf("invalid object type: %s", ref.Type)
+	}
+
+	return false, nil
+}
+
+// Create recreates the object in Datadog and returns its new reference and content.
+func (u *Updater) Create(ctx context.Context, ref ObjectRef, content []byte) (ObjectRef, any, error) {
+	newRef := ObjectRef{OrgID: ref.OrgID, Type: ref.Type}
+
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return newRef, nil, fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	switch ref.Type {
+	case DashboardType:
+		body := datadogV1.Dashboard{UnparsedObject: WithoutFields(doc, DashboardReadOnlyFields)}
+		created, _, err := u.dashAPI.CreateDashboard(ctx, body)
+		if err != nil {
+			return newRef, nil, fmt.Errorf("failed to recreate dashboard %s, err: %w", ref.ID, err)
+		}
+		newRef.ID = created.GetId()
+		return newRef, created, nil
+
+	case MonitorType:
+		body := datadogV1.Monitor{UnparsedObject: WithoutFields(doc, MonitorReadOnlyFields)}
+		created, _, err := u.monitorsAPI.CreateMonitor(ctx, body)
+		if err != nil {
+			return newRef, nil, fmt.Errorf("failed to recreate monitor %s, err: %w", ref.ID, err)
+		}
+		newRef.ID = strconv.FormatInt(created.GetId(), 10)
+		return newRef, created, nil
+
+	default:
+		return newRef, nil, fmt.Errorf("invalid object type: %s", ref.Type)
+	}
+}
+
+// Verify fetches the object from Datadog and checks that it matches the content sent.
+// Fields missing from the content, such as monitor options left to their default, are not compared.
+func (u *Updater) Verify(ctx context.Context, ref ObjectRef, content []byte) (bool, error) {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	var fetched any
+
+	switch ref.Type {
+	case DashboardType:
+		fetched, _, err = u.dashAPI.GetDashboard(ctx, ref.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch dashboard %s for verification, err: %w", ref.ID, err)
+		}
+
+	case MonitorType:
+		intID, err := strconv.Atoi(ref.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
+		}
+
+		fetched, _, err = u.monitorsAPI.GetMonitor(ctx, int64(intID))
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch monitor %s for verification, err: %w", ref.ID, err)
+		}
+
+	default:
+		return false, fmt.Errorf("invalid object type: %s", ref.Type)
+	}
+
+	fetchedBytes, err := json.Marshal(fetched)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal remote %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+	fetchedDoc, err := ParseDocument(fetchedBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal remote %s %s, err: %w", ref.Type, ref.ID, err)
+	}
+
+	// Only compare the fields we sent, Datadog fills in defaults for the others
+	var local map[string]any
+	if ref.Type == DashboardType {
+		ignored := append(append([]string{}, DashboardReadOnlyFields...), VolatileFields[DashboardType]...)
+		local = WithoutFields(doc, ignored)
+	} else {
+		local = u.MonitorFields.UpdateBody(doc)
+	}
+
+	return containsValue(fetchedDoc, local), nil
+}
+
+// Validate checks the monitor content with the Datadog API. Only the fields sent on update are taken from
+// the local content, over the remote monitor, so that the monitor is validated as it will be after the update.
+// Monitors that no longer exist are validated as new monitors.
+func (u *Updater) Validate(ctx context.Context, ref ObjectRef, content []byte) error {
+	doc, err := ParseDocument(content)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal monitor %s, err: %w", ref.ID, err)
+	}
+
+	intID, err := strconv.Atoi(ref.ID)
+	if err != nil {
+		return fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
+	}
+
+	remote, httpResp, err := u.monitorsAPI.GetMonitor(ctx, int64(intID))
+	if IsNotFound(httpResp) {
+		monitor := datadogV1.Monitor{UnparsedObject: WithoutFields(doc, MonitorReadOnlyFields)}
+		if _, _, err := u.monitorsAPI.ValidateMonitor(ctx, monitor); err != nil {
+			return fmt.Errorf("monitor %s failed validation, err: %w%s", ref.ID, err, APIErrorDetails(err))
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch monitor %s for validation, err: %w", ref.ID, err)
+	}
+
+	remoteBytes, err := json.Marshal(remote)
+	if err != nil {
+		return fmt.Errorf("failed to marshal remote monitor %s, err: %w", ref.ID, err)
+	}
+	remoteDoc, err := ParseDocument(remoteBytes)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal remote monitor %s, err: %w", ref.ID, err)
+	}
+
+	merged := WithoutFields(remoteDoc, MonitorReadOnlyFields)
+	for field, value := range u.MonitorFields.UpdateBody(doc) {
+		merged[field] = value
+	}
+
+	if _, _, err := u.monitorsAPI.ValidateExistingMonitor(ctx, int64(intID), datadogV1.Monitor{UnparsedObject: merged}); err != nil {
+		return fmt.Errorf("monitor %s failed validation, err: %w%s", ref.ID, err, APIErrorDetails(err))
+	}
+	return nil
+}
+
+// Alerting fetches the monitor and reports whether it is currently alerting.
+func (u *Updater) Alerting(ctx context.Context, ref ObjectRef) (bool, error) {
+	intID, err := strconv.Atoi(ref.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse monitor ID %s, err: %w", ref.ID, err)
+	}
+
+	monitor, httpResp, err := u.monitorsAPI.GetMonitor(ctx, int64(intID))
+	if IsNotFound(httpResp) {
+		// Let the update report or recreate the missing monitor
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch state of monitor %s, err: %w", ref.ID, err)
+	}
+
+	switch monitor.GetOverallState() {
+	case datadogV1.MONITOROVERALLSTATES_ALERT, datadogV1.MONITOROVERALLSTATES_WARN, datadogV1.MONITOROVERALLSTATES_NO_DATA:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func IsNotFound(httpResp *http.Response) bool {
+	return httpResp != nil && httpResp.StatusCode == http.StatusNotFound
+}
+
+// APIErrorDetails returns the body of a Datadog API error, which carries the reason of the failure.
+func APIErrorDetails(err error) string {
+	var apiErr datadog.GenericOpenAPIError
+	if errors.As(err, &apiErr) && len(apiErr.ErrorBody) > 0 {
+		return ", details: " + string(apiErr.ErrorBody)
+	}
+	return ""
+}
@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+)
+
+// newTestUpdater returns an updater sending its requests to the handler instead of the Datadog API.
+func newTestUpdater(t *testing.T, handler http.HandlerFunc, monitorFields MonitorFieldSet) *Updater {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	configuration := datadog.NewConfiguration()
+	configuration.Servers = datadog.ServerConfigurations{{URL: server.URL}}
+	return NewUpdater(datadog.NewAPIClient(configuration), monitorFields)
+}
+
+// serveObject answers requests on the path with the JSON object.
+func serveObject(path, object string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(object))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	monitor := ObjectRef{OrgID: 1, Type: MonitorType, ID: "10"}
+	dashboard := ObjectRef{OrgID: 1, Type: DashboardType, ID: "abc-def-ghi"}
+
+	// Remote objects have the defaults and read-only fields filled in by Datadog
+	remoteMonitor := `{
+		"id": 10, "name": "a", "type": "metric alert", "query": "avg:x{*} > 1", "message": "m", "tags": ["env:prod"],
+		"created": "2024-01-01T00:00:00Z", "overall_state": "OK",
+		"options": {"notify_audit": false, "include_tags": true, "new_group_delay": 60, "thresholds": {"critical": 1}}
+	}`
+	remoteDashboard := `{
+		"id": "abc-def-ghi", "title": "a", "layout_type": "ordered", "author_handle": "me", "modified_at": "2024-01-01T00:00:00Z",
+		"reflow_type": "auto", "widgets": [{"id": 1, "definition": {"type": "note", "content": "x", "font_size": "14"}}]
+	}`
+
+	tests := []struct {
+		name   string
+		ref    ObjectRef
+		remote string
+		fields MonitorFieldSet
+		local  string
+		want   bool
+	}{
+		{
+			name:   "minimal monitor",
+			ref:    monitor,
+			remote: remoteMonitor,
+			local:  `{"id": 10, "name": "a", "type": "metric alert", "query": "avg:x{*} > 1", "message": "m", "tags": ["env:prod"], "options": {"thresholds": {"critical": 1.0}}}`,
+			want:   true,
+		},
+		{
+			name:   "monitor with an explicit default",
+			ref:    monitor,
+			remote: remoteMonitor,
+			local:  `{"name": "a", "options": {"notify_audit": false, "thresholds": {"critical": 1}}}`,
+			want:   true,
+		},
+		{
+			name:   "monitor with a different option",
+			ref:    monitor,
+			remote: remoteMonitor,
+			local:  `{"name": "a", "options": {"new_group_delay": 120}}`,
+		},
+		{
+			name:   "monitor with a missing tag",
+			ref:    monitor,
+			remote: remoteMonitor,
+			local:  `{"name": "a", "tags": ["env:prod", "team:a"]}`,
+		},
+		{
+			name:   "monitor field not sent",
+			ref:    monitor,
+			remote: remoteMonitor,
+			fields: MonitorFieldSet{MonitorQueryField: {}},
+			local:  `{"name": "b", "query": "avg:x{*} > 1"}`,
+			want:   true,
+		},
+		{
+			name:   "dashboard",
+			ref:    dashboard,
+			remote: remoteDashboard,
+			local:  `{"id": "abc-def-ghi", "title": "a", "layout_type": "ordered", "author_handle": "you", "widgets": [{"definition": {"type": "note", "content": "x"}}]}`,
+			want:   true,
+		},
+		{
+			name:   "dashboard with a different widget",
+			ref:    dashboard,
+			remote: remoteDashboard,
+			local:  `{"title": "a", "widgets": [{"definition": {"type": "note", "content": "y"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/v1/monitor/" + tt.ref.ID
+			if tt.ref.Type == DashboardType {
+				path = "/api/v1/dashboard/" + tt.ref.ID
+			}
+			fields := tt.fields
+			if fields == nil {
+				fields = AllMonitorFields()
+			}
+			updater := newTestUpdater(t, serveObject(path, tt.remote), fields)
+
+			got, err := updater.Verify(context.Background(), tt.ref, []byte(tt.local))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
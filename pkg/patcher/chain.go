@@ -0,0 +1,174 @@
+package patcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// Pipeline is the content of a pipeline file, listing the patchers of a chain.
+type Pipeline struct {
+	Patchers    []string `yaml:"patchers"`
+	StopOnError bool     `yaml:"stop_on_error"`
+}
+
+// LoadPipeline reads the pipeline file at path, in YAML or JSON.
+func LoadPipeline(path string) (Pipeline, error) {
+	pipeline := Pipeline{}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return pipeline, fmt.Errorf("failed to read pipeline file at %s, err: %w", path, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&pipeline); err != nil && !errors.Is(err, io.EOF) {
+		return pipeline, fmt.Errorf("invalid pipeline file at %s, err: %w", path, err)
+	}
+	if len(pipeline.Patchers) == 0 {
+		return pipeline, fmt.Errorf("invalid pipeline file at %s: no patchers", path)
+	}
+	return pipeline, nil
+}
+
+// SplitSpecs splits a comma separated list of patchers. Commas in the argument of a patcher, such as
+// `exec:jq .a,.b`, are kept in the argument unless they are followed by the name of a registered patcher.
+func SplitSpecs(specs string) []string {
+	parts := []string{}
+	for _, part := range strings.Split(specs, ",") {
+		if len(parts) > 0 && takesArgument(parts[len(parts)-1]) && strings.TrimSpace(part) != "" && !startsPatcher(part) {
+			parts[len(parts)-1] += "," + part
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	res := []string{}
+	for _, spec := range parts {
+		if spec = strings.TrimSpace(spec); spec != "" {
+			res = append(res, spec)
+		}
+	}
+	return res
+}
+
+// takesArgument reports whether spec selects a registered patcher with an argument.
+func takesArgument(spec string) bool {
+	name, arg := ParseSpec(spec)
+	info, found := Lookup(name)
+	return found && info.Arg != "" && arg != ""
+}
+
+// startsPatcher reports whether spec starts with the name of a registered patcher.
+func startsPatcher(spec string) bool {
+	name, _ := ParseSpec(spec)
+	_, found := Lookup(name)
+	return found
+}
+
+// Chain applies patchers in order to each object. A patcher failing on an object is skipped, and the next ones
+// still apply, unless the chain stops on errors: the object then fails with the first error.
+type Chain struct {
+	links       []chainLink
+	stopOnError bool
+}
+
+type chainLink struct {
+	patcher migrate.Patcher
+	info    Info
+}
+
+// NewChain builds the patchers selected by specs, with their options from the config file.
+// The returned info is named after the comma separated specs, and has no version of its own.
+func NewChain(cfg config.Config, specs []string, stopOnError bool) (*Chain, Info, error) {
+	chain := &Chain{stopOnError: stopOnError}
+	info := Info{Description: "Chain of patchers"}
+	names := []string{}
+
+	for _, spec := range specs {
+		p, linkInfo, err := FromConfig(cfg, spec)
+		if err != nil {
+			return nil, info, errors.Join(err, chain.Close())
+		}
+
+		chain.links = append(chain.links, chainLink{patcher: p, info: linkInfo})
+		names = append(names, linkInfo.Name)
+		for _, objType := range linkInfo.ObjectTypes {
+			if !info.Supports(objType) {
+				info.ObjectTypes = append(info.ObjectTypes, objType)
+			}
+		}
+	}
+	if len(chain.links) == 0 {
+		return nil, info, fmt.Errorf("missing patchers in chain")
+	}
+
+	info.Name = strings.Join(names, ",")
+	return chain, info, nil
+}
+
+// PatchRaw applies the patchers of the chain in order. Each patcher works on a copy of the document,
+// so that a failing patcher leaves no partial changes. The patchers that modified the object and the errors
+// of the skipped ones are recorded in the trace of the context; without a trace, errors are returned.
+func (chain *Chain) PatchRaw(ctx context.Context, cfg config.Config, objType string, doc map[string]any) (bool, error) {
+	trace := migrate.PatchTraceFromContext(ctx)
+
+	patched := false
+	var errs []error
+	for _, link := range chain.links {
+		work := migrate.CopyValue(doc).(map[string]any)
+		linkPatched, err := link.patcher.PatchRaw(ctx, cfg, objType, work)
+		if err != nil {
+			err = fmt.Errorf("patcher %s failed, err: %w", link.info.Name, err)
+			if chain.stopOnError {
+				return false, err
+			}
+			if trace == nil {
+				errs = append(errs, err)
+			} else {
+				trace.Skipped = append(trace.Skipped, err)
+			}
+			continue
+		}
+		if !linkPatched {
+			continue
+		}
+
+		for key := range doc {
+			delete(doc, key)
+		}
+		for key, value := range work {
+			doc[key] = value
+		}
+		patched = true
+		if trace != nil {
+			trace.Applied = append(trace.Applied, migrate.PatcherRef{Name: link.info.Name, Version: link.info.Version})
+		}
+	}
+
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+	return patched, nil
+}
+
+// Close stops the resources of the patchers of the chain.
+func (chain *Chain) Close() error {
+	var errs []error
+	for _, link := range chain.links {
+		if closer, ok := link.patcher.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,143 @@
+package patcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// setPatcher sets the field named by its argument to true, and fails on objects with a "fail" field.
+type setPatcher struct {
+	field string
+}
+
+func (p setPatcher) PatchRaw(_ context.Context, _ config.Config, _ string, doc map[string]any) (bool, error) {
+	if _, found := doc["fail"]; found {
+		return false, errors.New("failing object")
+	}
+	if doc[p.field] == true {
+		return false, nil
+	}
+	doc[p.field] = true
+	return true, nil
+}
+
+type noopPatcher struct{}
+
+func (noopPatcher) PatchRaw(context.Context, config.Config, string, map[string]any) (bool, error) {
+	return false, nil
+}
+
+func init() {
+	Register(Info{Name: "test-set", Version: "1.0.0", ObjectTypes: []string{migrate.MonitorType}, Arg: "field"},
+		func(arg string, _ json.RawMessage) (migrate.Patcher, error) {
+			return setPatcher{field: arg}, nil
+		})
+	Register(Info{Name: "test-noop", Version: "2.0.0", ObjectTypes: []string{migrate.MonitorType}},
+		func(string, json.RawMessage) (migrate.Patcher, error) {
+			return noopPatcher{}, nil
+		})
+}
+
+func TestSplitSpecs(t *testing.T) {
+	tests := []struct {
+		specs string
+		want  []string
+	}{
+		{specs: "test-noop", want: []string{"test-noop"}},
+		{specs: "test-noop, test-set:a ,", want: []string{"test-noop", "test-set:a"}},
+		{specs: "test-set:.a,.b", want: []string{"test-set:.a,.b"}},
+		{specs: "test-set:.a,.b,test-noop", want: []string{"test-set:.a,.b", "test-noop"}},
+		{specs: "test-set:a,test-set:b", want: []string{"test-set:a", "test-set:b"}},
+		{specs: "test-noop,unknown", want: []string{"test-noop", "unknown"}},
+		{specs: "", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.specs, func(t *testing.T) {
+			if got := SplitSpecs(tt.specs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	tests := []struct {
+		name        string
+		specs       []string
+		stopOnError bool
+		input       map[string]any
+		want        map[string]any
+		wantPatched bool
+		wantApplied []migrate.PatcherRef
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name:        "applied patchers are traced",
+			specs:       []string{"test-set:a", "test-noop", "test-set:b"},
+			input:       map[string]any{},
+			want:        map[string]any{"a": true, "b": true},
+			wantPatched: true,
+			wantApplied: []migrate.PatcherRef{{Name: "test-set:a", Version: "1.0.0"}, {Name: "test-set:b", Version: "1.0.0"}},
+		},
+		{
+			name:        "unchanged object",
+			specs:       []string{"test-set:a", "test-noop"},
+			input:       map[string]any{"a": true},
+			want:        map[string]any{"a": true},
+			wantApplied: nil,
+		},
+		{
+			name:        "failing patchers are skipped",
+			specs:       []string{"test-set:a", "test-set:b"},
+			input:       map[string]any{"fail": 1},
+			want:        map[string]any{"fail": 1},
+			wantSkipped: 2,
+		},
+		{
+			name:        "stop on error",
+			specs:       []string{"test-set:a"},
+			stopOnError: true,
+			input:       map[string]any{"fail": 1},
+			want:        map[string]any{"fail": 1},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, info, err := NewChain(config.Config{}, tt.specs, tt.stopOnError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Supports(migrate.MonitorType) {
+				t.Errorf("chain %s does not support monitors", info.Name)
+			}
+
+			trace := &migrate.PatchTrace{}
+			patched, err := chain.PatchRaw(migrate.WithPatchTrace(context.Background(), trace), config.Config{}, migrate.MonitorType, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if patched != tt.wantPatched {
+				t.Errorf("got patched %v", patched)
+			}
+			if !reflect.DeepEqual(tt.input, tt.want) {
+				t.Errorf("got %v, want %v", tt.input, tt.want)
+			}
+			if !reflect.DeepEqual(trace.Applied, tt.wantApplied) {
+				t.Errorf("got applied %v, want %v", trace.Applied, tt.wantApplied)
+			}
+			if len(trace.Skipped) != tt.wantSkipped {
+				t.Errorf("got skipped %v", trace.Skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Package external runs patchers as external processes, exchanging objects as JSON on stdin and stdout.
+//
+// For each object, the process reads a request line:
+//
+//	{"type":"monitor","org":3000,"id":"123","object":{...}}
+//
+// and writes back a response line, with the patched object or an error:
+//
+//	{"patched":true,"object":{...}}
+//	{"patched":false}
+//	{"error":"reason"}
+//
+// The command line is split into arguments as a shell does, quotes and backslashes included, without expansions.
+// By default, a process is started for each object. In long-running mode, a single process handles
+// all objects, one line per object, until its stdin is closed.
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+)
+
+func init() {
+	patcher.Register(patcher.Info{
+		Name:        "exec",
+		Description: "Run an external command patching objects as JSON on stdin and stdout",
+		Version:     "1.0.0",
+		ObjectTypes: []string{migrate.DashboardType, migrate.MonitorType},
+		Arg:         "command",
+	}, newPatcher)
+}
+
+type options struct {
+	// LongRunning keeps a single process for all objects
+	LongRunning bool `json:"long_running"`
+	// Timeout of the patch of one object, for instance "30s"
+	Timeout string `json:"timeout"`
+}
+
+type request struct {
+	Type   string         `json:"type"`
+	Org    int            `json:"org,omitempty"`
+	ID     string         `json:"id,omitempty"`
+	Object map[string]any `json:"object"`
+}
+
+type response struct {
+	Patched bool            `json:"patched"`
+	Object  json.RawMessage `json:"object,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Patcher sends objects to an external command.
+type Patcher struct {
+	args        []string
+	longRunning bool
+	timeout     time.Duration
+
+	mu   sync.Mutex
+	proc *process
+}
+
+func newPatcher(arg string, rawOptions json.RawMessage) (migrate.Patcher, error) {
+	opts := options{}
+	if err := patcher.DecodeOptions(rawOptions, &opts); err != nil {
+		return nil, err
+	}
+
+	args, err := splitArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Patcher{
+		args:        args,
+		longRunning: opts.LongRunning,
+	}
+	if opts.Timeout != "" {
+		timeout, err := time.ParseDuration(opts.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %s, err: %w", opts.Timeout, err)
+		}
+		p.timeout = timeout
+	}
+	if _, err := exec.LookPath(p.args[0]); err != nil {
+		return nil, fmt.Errorf("command %s not found, err: %w", p.args[0], err)
+	}
+
+	return p, nil
+}
+
+// splitArgs splits a command line into arguments: arguments are separated by blanks, single and double quotes
+// group characters, and backslashes escape the next character outside single quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("invalid command %s: unterminated quote or escape", line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid command: empty")
+	}
+	return args, nil
+}
+
+func (p *Patcher) PatchRaw(ctx context.Context, _ config.Config, objType string, doc map[string]any) (bool, error) {
+	req := request{Type: objType, Object: doc}
+	if ref, ok := migrate.ObjectRefFromContext(ctx); ok {
+		req.Org, req.ID = ref.OrgID, ref.ID
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal request, err: %w", err)
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	var out []byte
+	if p.longRunning {
+		out, err = p.roundTrip(ctx, line)
+	} else {
+		out, err = p.run(ctx, line)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return applyResponse(out, doc)
+}
+
+// Close stops the long-running process, letting it finish once its stdin is closed.
+func (p *Patcher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.proc == nil {
+		return nil
+	}
+	err := p.proc.close()
+	p.proc = nil
+	return err
+}
+
+// run starts a process for a single object.
+func (p *Patcher) run(ctx context.Context, line []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, p.args[0], p.args[1:]...)
+	cmd.Stdin = bytes.NewReader(append(line, '\n'))
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("command %s stopped, err: %w", p.args[0], ctx.Err())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("command %s failed, err: %w", p.args[0], err)
+	}
+	return out, nil
+}
+
+// roundTrip sends the request to the long-running process, started on first use, and reads its response.
+// On failure or timeout the process is stopped, and a new one is started for the next object.
+func (p *Patcher) roundTrip(ctx context.Context, line []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.proc == nil {
+		proc, err := startProcess(p.args)
+		if err != nil {
+			return nil, err
+		}
+		p.proc = proc
+	}
+
+	out, err := p.proc.roundTrip(ctx, line)
+	if err != nil {
+		p.proc.kill()
+		p.proc = nil
+		return nil, err
+	}
+	return out, nil
+}
+
+// applyResponse replaces the content of doc with the patched object of the response.
+func applyResponse(out []byte, doc map[string]any) (bool, error) {
+	res := response{}
+	if err := json.Unmarshal(bytes.TrimSpace(out), &res); err != nil {
+		return false, fmt.Errorf("invalid response %q, err: %w", truncate(out), err)
+	}
+	if res.Error != "" {
+		return false, errors.New(res.Error)
+	}
+	if !res.Patched {
+		return false, nil
+	}
+
+	patched, err := migrate.DecodeJSON(res.Object)
+	if err != nil {
+		return false, fmt.Errorf("invalid patched object, err: %w", err)
+	}
+	obj, ok := patched.(map[string]any)
+	if !ok {
+		return false, fmt.Errorf("invalid patched object: not a JSON object")
+	}
+
+	for key := range doc {
+		delete(doc, key)
+	}
+	for key, value := range obj {
+		doc[key] = value
+	}
+	return true, nil
+}
+
+func truncate(out []byte) string {
+	const maxLen = 200
+	if len(out) > maxLen {
+		return string(out[:maxLen]) + "..."
+	}
+	return string(out)
+}
+
+type process struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func startProcess(args []string) (*process, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command %s, err: %w", args[0], err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command %s, err: %w", args[0], err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command %s, err: %w", args[0], err)
+	}
+
+	return &process{name: args[0], cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// roundTrip writes the request and reads the response in the background, so that a process that stops reading
+// or writing cannot block the patch beyond the context. The caller kills the process on error.
+func (proc *process) roundTrip(ctx context.Context, line []byte) ([]byte, error) {
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		if _, err := proc.stdin.Write(append(line, '\n')); err != nil {
+			done <- result{err: fmt.Errorf("failed to write to command %s, err: %w", proc.name, err)}
+			return
+		}
+
+		out, err := proc.stdout.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(bytes.TrimSpace(out)) == 0) {
+			err = fmt.Errorf("failed to read from command %s, err: %w", proc.name, err)
+		} else {
+			err = nil
+		}
+		done <- result{out, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("command %s stopped, err: %w", proc.name, ctx.Err())
+	case res := <-done:
+		return res.out, res.err
+	}
+}
+
+func (proc *process) close() error {
+	proc.stdin.Close()
+	if err := proc.cmd.Wait(); err != nil {
+		return fmt.Errorf("command %s failed, err: %w", proc.name, err)
+	}
+	return nil
+}
+
+func (proc *process) kill() {
+	proc.stdin.Close()
+	_ = proc.cmd.Process.Kill()
+	_ = proc.cmd.Wait()
+}
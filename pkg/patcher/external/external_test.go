@@ -0,0 +1,227 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+const helperModeEnv = "EXTERNAL_PATCHER_HELPER_MODE"
+
+// TestMain runs the test binary as the external command when the helper mode is set.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(helperModeEnv); mode != "" {
+		os.Exit(runHelper(mode, os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper answers the requests of stdin according to the mode, until stdin is closed.
+func runHelper(mode string, args []string) int {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		req := request{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		switch mode {
+		case "patch":
+			req.Object["name"] = fmt.Sprintf("%s (%s %d/%s, %s)", req.Object["name"], req.Type, req.Org, req.ID, strings.Join(args, "|"))
+			line, _ := json.Marshal(response{Patched: true, Object: mustMarshal(req.Object)})
+			fmt.Println(string(line))
+		case "unchanged":
+			fmt.Println(`{"patched":false}`)
+		case "error":
+			fmt.Println(`{"error":"unsupported query"}`)
+		case "malformed":
+			fmt.Println(`patched!`)
+		case "exit":
+			return 3
+		case "hang":
+			time.Sleep(time.Hour)
+		}
+	}
+	return 0
+}
+
+func mustMarshal(v any) json.RawMessage {
+	content, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return content
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "jq .a", want: []string{"jq", ".a"}},
+		{line: "  python3\tscript.py  ", want: []string{"python3", "script.py"}},
+		{line: `python3 'my scripts/patch.py' "a b" c\ d`, want: []string{"python3", "my scripts/patch.py", "a b", "c d"}},
+		{line: `sh -c 'echo "$X"' "it's" ""`, want: []string{"sh", "-c", `echo "$X"`, "it's", ""}},
+		{line: `a "b\"c" 'd\e'`, want: []string{"a", `b"c`, `d\e`}},
+		{line: `a 'b`, wantErr: true},
+		{line: `a b\`, wantErr: true},
+		{line: "  ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := splitArgs(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchRaw(t *testing.T) {
+	ref := migrate.ObjectRef{OrgID: 3000, Type: migrate.MonitorType, ID: "10"}
+
+	tests := []struct {
+		name        string
+		mode        string
+		timeout     string
+		doc         map[string]any
+		want        map[string]any
+		wantPatched bool
+		wantErr     string
+	}{
+		{
+			name:        "patched",
+			mode:        "patch",
+			doc:         map[string]any{"name": "a", "query": "q"},
+			want:        map[string]any{"name": "a (monitor 3000/10, my arg|b)", "query": "q"},
+			wantPatched: true,
+		},
+		{
+			name: "unchanged",
+			mode: "unchanged",
+			doc:  map[string]any{"name": "a"},
+			want: map[string]any{"name": "a"},
+		},
+		{
+			name:    "error",
+			mode:    "error",
+			doc:     map[string]any{"name": "a"},
+			want:    map[string]any{"name": "a"},
+			wantErr: "unsupported query",
+		},
+		{
+			name:    "malformed output",
+			mode:    "malformed",
+			doc:     map[string]any{"name": "a"},
+			want:    map[string]any{"name": "a"},
+			wantErr: `invalid response "patched!\n"`,
+		},
+		{
+			name: "timeout",
+			mode: "hang",
+			// Too large for the pipe buffer, so that the write blocks too in long-running mode
+			timeout: "200ms",
+			doc:     map[string]any{"name": strings.Repeat("a", 1<<20)},
+			want:    map[string]any{"name": strings.Repeat("a", 1<<20)},
+			wantErr: "stopped, err: context deadline exceeded",
+		},
+	}
+
+	for _, longRunning := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s long-running %v", tt.name, longRunning), func(t *testing.T) {
+				t.Setenv(helperModeEnv, tt.mode)
+
+				options := mustMarshal(map[string]any{"long_running": longRunning, "timeout": tt.timeout})
+				p, err := newPatcher(fmt.Sprintf("'%s' 'my arg' b", os.Args[0]), options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer p.(*Patcher).Close()
+
+				// Twice, so that long-running processes handle several objects or are restarted
+				for i := 0; i < 2; i++ {
+					doc := migrate.CopyValue(tt.doc).(map[string]any)
+					patched, err := p.PatchRaw(migrate.WithObjectRef(context.Background(), ref), config.Config{}, migrate.MonitorType, doc)
+					if tt.wantErr == "" && err != nil {
+						t.Fatal(err)
+					}
+					if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+						t.Fatalf("got error %v, want %s", err, tt.wantErr)
+					}
+					if patched != tt.wantPatched {
+						t.Errorf("got patched %v", patched)
+					}
+					if !reflect.DeepEqual(doc, tt.want) {
+						t.Errorf("got %v, want %v", truncate(mustMarshal(doc)), truncate(mustMarshal(tt.want)))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPatchRawExit(t *testing.T) {
+	tests := []struct {
+		longRunning bool
+		wantErr     string
+	}{
+		{longRunning: false, wantErr: "failed, err: exit status 3"},
+		{longRunning: true, wantErr: "failed to read from command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("long-running %v", tt.longRunning), func(t *testing.T) {
+			t.Setenv(helperModeEnv, "exit")
+
+			p, err := newPatcher(os.Args[0], mustMarshal(map[string]any{"long_running": tt.longRunning}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.(*Patcher).Close()
+
+			_, err = p.PatchRaw(context.Background(), config.Config{}, migrate.MonitorType, map[string]any{"name": "a"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPatcher(t *testing.T) {
+	tests := []struct {
+		arg     string
+		options string
+		wantErr string
+	}{
+		{arg: "migrate-tool-missing-command", wantErr: "not found"},
+		{arg: "'unterminated", wantErr: "unterminated quote"},
+		{arg: "", wantErr: "empty"},
+		{arg: os.Args[0], options: `{"timeout": "soon"}`, wantErr: "invalid timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			_, err := newPatcher(tt.arg, json.RawMessage(tt.options))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
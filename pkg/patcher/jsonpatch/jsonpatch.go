@@ -0,0 +1,500 @@
+// Package jsonpatch patches raw objects with JSON Patch (RFC 6902) operations and JSONPath rules,
+// applied when conditions on the JSON values of the object hold.
+package jsonpatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+)
+
+func init() {
+	patcher.Register(patcher.Info{
+		Name:        "jsonpatch",
+		Description: "Apply the JSON Patch operations and JSONPath rules of a YAML or JSON file",
+		Version:     "1.0.0",
+		ObjectTypes: []string{migrate.DashboardType, migrate.MonitorType},
+		Arg:         "file",
+	}, func(arg string, options json.RawMessage) (migrate.Patcher, error) {
+		// No options yet
+		if err := patcher.DecodeOptions(options, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return Load(arg)
+	})
+}
+
+// File is the content of a patch file. Rules are applied in order.
+// A file holding a JSON Patch document, an array of operations, is a single rule applied to all objects.
+type File struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule applies either a JSON Patch, or an operation on the values selected by a JSONPath,
+// to the objects of the given types, all types if empty.
+type Rule struct {
+	ObjectTypes []string `json:"object_types"`
+	// When lists the conditions that must all hold. With Select, they are checked for each selected value.
+	When []Condition `json:"when"`
+
+	// Patch is a JSON Patch (RFC 6902), with JSON pointer paths
+	Patch []Operation `json:"patch"`
+
+	// Select is a JSONPath selecting the values Op applies to: set or remove
+	Select string          `json:"select"`
+	Op     string          `json:"op"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// Operation is a JSON Patch operation: add, remove, replace, move, copy or test.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Condition checks the values selected by a JSONPath, from the object with $ or from the selected value with @.
+// A condition holds when all its checks do.
+type Condition struct {
+	Path string `json:"path"`
+	// Exists checks whether the path selects a value
+	Exists *bool `json:"exists"`
+	// Equals checks that a selected value is equal, NotEquals that none is
+	Equals    json.RawMessage `json:"equals"`
+	NotEquals json.RawMessage `json:"not_equals"`
+	// Matches checks that a selected string value matches the regular expression
+	Matches string `json:"matches"`
+}
+
+// Patcher applies the rules of a patch file.
+type Patcher struct {
+	rules []*rule
+}
+
+// Load reads the patch file at path, in YAML or JSON.
+func Load(path string) (*Patcher, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch file at %s, err: %w", path, err)
+	}
+
+	p, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch file at %s, err: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse builds a patcher from the content of a patch file. Unknown keys and invalid rules are rejected.
+func Parse(content []byte) (*Patcher, error) {
+	// YAML is converted to JSON, so that values are decoded as in objects
+	var raw any
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	if operations, ok := raw.([]any); ok {
+		raw = map[string]any{"rules": []any{map[string]any{"patch": operations}}}
+	}
+	content, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	file := File{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	if len(file.Rules) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+
+	p := &Patcher{}
+	for i, r := range file.Rules {
+		compiled, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %d, err: %w", i+1, err)
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+func (p *Patcher) PatchRaw(_ context.Context, _ config.Config, objType string, doc map[string]any) (bool, error) {
+	// Rules apply to a copy, so that the object is unchanged if one fails
+	var patched any = migrate.CopyValue(doc)
+	for i, r := range p.rules {
+		if !r.appliesTo(objType) {
+			continue
+		}
+
+		var err error
+		patched, err = r.apply(patched)
+		if err != nil {
+			return false, fmt.Errorf("rule %d failed, err: %w", i+1, err)
+		}
+	}
+
+	patchedDoc, ok := patched.(map[string]any)
+	if !ok {
+		return false, fmt.Errorf("invalid patched object: not a JSON object")
+	}
+	if reflect.DeepEqual(patchedDoc, doc) {
+		return false, nil
+	}
+
+	for key := range doc {
+		delete(doc, key)
+	}
+	for key, value := range patchedDoc {
+		doc[key] = value
+	}
+	return true, nil
+}
+
+type rule struct {
+	objectTypes []string
+	conditions  []condition
+	operations  []operation
+	selector    *jsonPath
+	op          string
+	value       any
+}
+
+type operation struct {
+	op    string
+	path  pointer
+	from  pointer
+	value any
+}
+
+type condition struct {
+	path      jsonPath
+	exists    *bool
+	equals    []any
+	notEquals []any
+	matches   *regexp.Regexp
+}
+
+func compileRule(r Rule) (*rule, error) {
+	compiled := &rule{objectTypes: r.ObjectTypes, op: r.Op}
+
+	for _, objType := range r.ObjectTypes {
+		if objType != migrate.DashboardType && objType != migrate.MonitorType {
+			return nil, fmt.Errorf("invalid object type: %s", objType)
+		}
+	}
+
+	for i, c := range r.When {
+		cond, err := compileCondition(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition %d, err: %w", i+1, err)
+		}
+		compiled.conditions = append(compiled.conditions, cond)
+	}
+
+	switch {
+	case len(r.Patch) > 0 && r.Select == "":
+		if r.Op != "" || len(r.Value) > 0 {
+			return nil, fmt.Errorf("op and value require select, patch operations have their own")
+		}
+		for i, o := range r.Patch {
+			op, err := compileOperation(o)
+			if err != nil {
+				return nil, fmt.Errorf("invalid operation %d, err: %w", i+1, err)
+			}
+			compiled.operations = append(compiled.operations, op)
+		}
+
+	case len(r.Patch) == 0 && r.Select != "":
+		selector, err := parsePath(r.Select)
+		if err != nil {
+			return nil, err
+		}
+		if selector.relative {
+			return nil, fmt.Errorf("invalid select %s: must start with $", r.Select)
+		}
+		compiled.selector = &selector
+
+		switch r.Op {
+		case "set":
+			if len(r.Value) == 0 {
+				return nil, fmt.Errorf("op set requires a value")
+			}
+			if compiled.value, err = migrate.DecodeJSON(r.Value); err != nil {
+				return nil, fmt.Errorf("invalid value, err: %w", err)
+			}
+		case "remove":
+			if len(r.Value) > 0 {
+				return nil, fmt.Errorf("op remove does not take a value")
+			}
+		default:
+			return nil, fmt.Errorf("invalid op %q, must be set or remove", r.Op)
+		}
+
+	default:
+		return nil, fmt.Errorf("a rule requires either patch, or select and op")
+	}
+
+	return compiled, nil
+}
+
+func compileOperation(o Operation) (operation, error) {
+	op := operation{op: o.Op}
+
+	var err error
+	if op.path, err = parsePointer(o.Path); err != nil {
+		return op, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		if len(o.Value) == 0 {
+			return op, fmt.Errorf("op %s requires a value", o.Op)
+		}
+		if op.value, err = migrate.DecodeJSON(o.Value); err != nil {
+			return op, fmt.Errorf("invalid value, err: %w", err)
+		}
+	case "move", "copy":
+		if o.From == "" {
+			return op, fmt.Errorf("op %s requires from", o.Op)
+		}
+		if op.from, err = parsePointer(o.From); err != nil {
+			return op, err
+		}
+		if o.Op == "move" && op.from.isPrefixOf(op.path) {
+			return op, fmt.Errorf("cannot move %s into itself", o.From)
+		}
+	case "remove":
+	default:
+		return op, fmt.Errorf("invalid op %q", o.Op)
+	}
+
+	return op, nil
+}
+
+func compileCondition(c Condition) (condition, error) {
+	cond := condition{exists: c.Exists}
+
+	var err error
+	if cond.path, err = parsePath(c.Path); err != nil {
+		return cond, err
+	}
+
+	if len(c.Equals) > 0 {
+		value, err := migrate.DecodeJSON(c.Equals)
+		if err != nil {
+			return cond, fmt.Errorf("invalid equals value, err: %w", err)
+		}
+		cond.equals = []any{value}
+	}
+	if len(c.NotEquals) > 0 {
+		value, err := migrate.DecodeJSON(c.NotEquals)
+		if err != nil {
+			return cond, fmt.Errorf("invalid not_equals value, err: %w", err)
+		}
+		cond.notEquals = []any{value}
+	}
+	if c.Matches != "" {
+		if cond.matches, err = regexp.Compile(c.Matches); err != nil {
+			return cond, fmt.Errorf("invalid pattern %s, err: %w", c.Matches, err)
+		}
+	}
+
+	if cond.exists == nil && cond.equals == nil && cond.notEquals == nil && cond.matches == nil {
+		return cond, fmt.Errorf("condition on %s has no check: exists, equals, not_equals or matches", c.Path)
+	}
+	return cond, nil
+}
+
+func (r *rule) appliesTo(objType string) bool {
+	if len(r.objectTypes) == 0 {
+		return true
+	}
+	for _, t := range r.objectTypes {
+		if t == objType {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies the rule to doc and returns the new document.
+func (r *rule) apply(doc any) (any, error) {
+	root := node{ptr: pointer{}, value: doc, exists: true}
+
+	if r.selector == nil {
+		if !r.holds(root, root) {
+			return doc, nil
+		}
+
+		var err error
+		for i, op := range r.operations {
+			if doc, err = op.apply(doc); err != nil {
+				return nil, fmt.Errorf("operation %d (%s %s) failed, err: %w", i+1, op.op, op.path, err)
+			}
+		}
+		return doc, nil
+	}
+
+	// Values are selected before being changed
+	selected := []node{}
+	for _, n := range r.selector.evaluate(root) {
+		if r.holds(root, n) {
+			selected = append(selected, n)
+		}
+	}
+
+	var err error
+	switch r.op {
+	case "set":
+		for _, n := range selected {
+			if n.exists {
+				doc, err = replace(doc, n.ptr, migrate.CopyValue(r.value))
+			} else {
+				doc, err = add(doc, n.ptr, migrate.CopyValue(r.value))
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case "remove":
+		// Last array elements and descendants first, so that the other pointers stay valid
+		sort.Slice(selected, func(i, j int) bool {
+			return pointerLess(selected[j].ptr, selected[i].ptr)
+		})
+		for _, n := range selected {
+			if !n.exists {
+				continue
+			}
+			if doc, err = remove(doc, n.ptr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func (op operation) apply(doc any) (any, error) {
+	switch op.op {
+	case "add":
+		return add(doc, op.path, migrate.CopyValue(op.value))
+	case "replace":
+		return replace(doc, op.path, migrate.CopyValue(op.value))
+	case "remove":
+		return remove(doc, op.path)
+	case "move":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = remove(doc, op.from); err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, migrate.CopyValue(value))
+	case "test":
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !valuesEqual(value, op.value) {
+			return nil, fmt.Errorf("test failed: value is different")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("invalid op %q", op.op)
+	}
+}
+
+// holds reports whether all conditions hold, for the selected node.
+func (r *rule) holds(root, selected node) bool {
+	for _, cond := range r.conditions {
+		base := root
+		if cond.path.relative {
+			base = selected
+		}
+		if !cond.holds(cond.path.evaluate(base)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cond condition) holds(nodes []node) bool {
+	values := []any{}
+	for _, n := range nodes {
+		if n.exists {
+			values = append(values, n.value)
+		}
+	}
+
+	if cond.exists != nil && (len(values) > 0) != *cond.exists {
+		return false
+	}
+	if cond.equals != nil && !containsValue(values, cond.equals[0]) {
+		return false
+	}
+	if cond.notEquals != nil && containsValue(values, cond.notEquals[0]) {
+		return false
+	}
+	if cond.matches != nil {
+		matched := false
+		for _, value := range values {
+			if s, ok := value.(string); ok && cond.matches.MatchString(s) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsValue(values []any, expected any) bool {
+	for _, value := range values {
+		if valuesEqual(value, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointerLess orders pointers as paths, array indexes numerically.
+func pointerLess(a, b pointer) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		aIndex, aErr := strconv.Atoi(a[i])
+		bIndex, bErr := strconv.Atoi(b[i])
+		if aErr == nil && bErr == nil {
+			return aIndex < bIndex
+		}
+		return a[i] < b[i]
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,206 @@
+package jsonpatch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath selector. The supported subset is:
+//
+//	$ or @        the document, or the selected value in conditions
+//	.name ['name'] a member of an object
+//	[0] [-1]      an element of an array, negative indexes count from the end
+//	.* [*]        all members or elements
+//	..            the value and all its descendants, followed by one of the above
+type jsonPath struct {
+	relative bool
+	segments []pathSegment
+}
+
+type pathSegment struct {
+	name       string
+	index      *int
+	wildcard   bool
+	descendant bool
+}
+
+// node is a value selected by a JSONPath. Missing members are selected when they end the path, so that they can be set.
+type node struct {
+	ptr    pointer
+	value  any
+	exists bool
+}
+
+func parsePath(s string) (jsonPath, error) {
+	path := jsonPath{}
+	switch {
+	case strings.HasPrefix(s, "$"):
+	case strings.HasPrefix(s, "@"):
+		path.relative = true
+	default:
+		return path, fmt.Errorf("invalid JSONPath %s: must start with $ or @", s)
+	}
+
+	rest := s[1:]
+	for rest != "" {
+		segment := pathSegment{}
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			segment.descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+		default:
+			return path, fmt.Errorf("invalid JSONPath %s at %s", s, rest)
+		}
+
+		var err error
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return path, fmt.Errorf("invalid JSONPath %s: missing ]", s)
+			}
+			err = segment.parseBracket(rest[1:end])
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if rest[:end] == "*" {
+				segment.wildcard = true
+			} else {
+				segment.name = rest[:end]
+			}
+			if rest[:end] == "" {
+				err = fmt.Errorf("empty member name")
+			}
+			rest = rest[end:]
+		}
+		if err != nil {
+			return path, fmt.Errorf("invalid JSONPath %s, err: %w", s, err)
+		}
+
+		path.segments = append(path.segments, segment)
+	}
+
+	return path, nil
+}
+
+func (segment *pathSegment) parseBracket(content string) error {
+	content = strings.TrimSpace(content)
+	switch {
+	case content == "*":
+		segment.wildcard = true
+	case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+		segment.name = content[1 : len(content)-1]
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return fmt.Errorf("invalid selector [%s]", content)
+		}
+		segment.index = &index
+	}
+	return nil
+}
+
+// evaluate returns the nodes selected from root, without duplicates.
+func (path jsonPath) evaluate(root node) []node {
+	nodes := []node{root}
+	for i, segment := range path.segments {
+		last := i == len(path.segments)-1
+
+		next := []node{}
+		for _, n := range nodes {
+			candidates := []node{n}
+			if segment.descendant {
+				candidates = descendants(n)
+			}
+			for _, candidate := range candidates {
+				next = append(next, segment.apply(candidate, last && !segment.descendant)...)
+			}
+		}
+		nodes = next
+	}
+
+	seen := map[string]bool{}
+	res := nodes[:0]
+	for _, n := range nodes {
+		key := n.ptr.String()
+		if !seen[key] {
+			seen[key] = true
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+func (segment pathSegment) apply(n node, allowMissing bool) []node {
+	switch value := n.value.(type) {
+	case map[string]any:
+		if segment.wildcard {
+			return children(n)
+		}
+		if segment.index != nil {
+			return nil
+		}
+		child, found := value[segment.name]
+		if !found && !allowMissing {
+			return nil
+		}
+		return []node{{ptr: n.ptr.child(segment.name), value: child, exists: found}}
+	case []any:
+		if segment.wildcard {
+			return children(n)
+		}
+		if segment.index == nil {
+			return nil
+		}
+		index := *segment.index
+		if index < 0 {
+			index += len(value)
+		}
+		if index < 0 || index >= len(value) {
+			return nil
+		}
+		return []node{{ptr: n.ptr.child(strconv.Itoa(index)), value: value[index], exists: true}}
+	default:
+		return nil
+	}
+}
+
+// children returns the members of an object, sorted by name, or the elements of an array.
+func children(n node) []node {
+	res := []node{}
+	switch value := n.value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			res = append(res, node{ptr: n.ptr.child(key), value: value[key], exists: true})
+		}
+	case []any:
+		for i, elem := range value {
+			res = append(res, node{ptr: n.ptr.child(strconv.Itoa(i)), value: elem, exists: true})
+		}
+	}
+	return res
+}
+
+// descendants returns n and all its descendants, parents first.
+func descendants(n node) []node {
+	if !n.exists {
+		return nil
+	}
+	res := []node{n}
+	for _, child := range children(n) {
+		res = append(res, descendants(child)...)
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{input: "$"},
+		{input: "@.type"},
+		{input: "$.widgets[0].definition['type']"},
+		{input: `$["a.b"][-1]`},
+		{input: "$..widgets[*].definition"},
+		{input: "$.*"},
+		{input: "widgets", wantErr: true},
+		{input: "$.widgets[0", wantErr: true},
+		{input: "$.widgets[a]", wantErr: true},
+		{input: "$.", wantErr: true},
+		{input: "$widgets", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := parsePath(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	doc, err := migrate.ParseDocument([]byte(`{
+		"a.b": 1,
+		"tags": ["env:prod", "team:a"],
+		"widgets": [
+			{"definition": {"type": "note"}},
+			{"definition": {"type": "group", "widgets": [{"definition": {"type": "timeseries"}}]}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{path: "$", want: []string{""}},
+		{path: "$.tags[0]", want: []string{"/tags/0"}},
+		{path: "$.tags[-1]", want: []string{"/tags/1"}},
+		{path: "$.tags[2]", want: []string{}},
+		{path: "$['a.b']", want: []string{"/a.b"}},
+		{path: "$.tags[*]", want: []string{"/tags/0", "/tags/1"}},
+		// Missing members are selected at the end of the path only, so that they can be set
+		{path: "$.missing", want: []string{"/missing"}},
+		{path: "$.missing.child", want: []string{}},
+		{path: "$.*", want: []string{"/a.b", "/tags", "/widgets"}},
+		{path: "$..type", want: []string{"/widgets/0/definition/type", "/widgets/1/definition/type", "/widgets/1/definition/widgets/0/definition/type"}},
+		{path: "$..widgets[*].definition.type", want: []string{"/widgets/0/definition/type", "/widgets/1/definition/type", "/widgets/1/definition/widgets/0/definition/type"}},
+		{path: "$..[0]", want: []string{"/tags/0", "/widgets/0", "/widgets/1/definition/widgets/0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := parsePath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, n := range path.evaluate(node{ptr: pointer{}, value: doc, exists: true}) {
+				got = append(got, n.ptr.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectRules(t *testing.T) {
+	dashboard := `{
+		"widgets": [
+			{"definition": {"type": "group", "title": "Old", "widgets": [
+				{"definition": {"type": "note", "content": "a"}},
+				{"definition": {"type": "timeseries"}},
+				{"definition": {"type": "note", "content": "b"}},
+				{"definition": {"type": "group", "widgets": [
+					{"definition": {"type": "note", "content": "c"}},
+					{"definition": {"type": "note", "content": "d"}}
+				]}}
+			]}},
+			{"definition": {"type": "note", "content": "e"}},
+			{"definition": {"type": "query_value", "title": "Old"}},
+			{"definition": {"type": "note", "content": "f"}}
+		]
+	}`
+
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{
+			name: "remove in nested groups",
+			rules: `
+rules:
+  - select: $..widgets[*]
+    when:
+      - path: "@.definition.type"
+        equals: note
+    op: remove
+`,
+			want: `{
+				"widgets": [
+					{"definition": {"type": "group", "title": "Old", "widgets": [
+						{"definition": {"type": "timeseries"}},
+						{"definition": {"type": "group", "widgets": []}}
+					]}},
+					{"definition": {"type": "query_value", "title": "Old"}}
+				]
+			}`,
+		},
+		{
+			name: "remove groups with their selected children",
+			rules: `
+rules:
+  - select: $..widgets[*]
+    when:
+      - path: "@.definition.type"
+        not_equals: timeseries
+    op: remove
+`,
+			want: `{"widgets": []}`,
+		},
+		{
+			name: "set existing and missing members",
+			rules: `
+rules:
+  - select: $..widgets[*].definition.title
+    when:
+      - path: "@"
+        exists: false
+    op: set
+    value: Untitled
+  - select: $..widgets[*].definition.title
+    when:
+      - path: "@"
+        matches: ^Old$
+    op: set
+    value: New
+`,
+			want: `{
+				"widgets": [
+					{"definition": {"type": "group", "title": "New", "widgets": [
+						{"definition": {"type": "note", "content": "a", "title": "Untitled"}},
+						{"definition": {"type": "timeseries", "title": "Untitled"}},
+						{"definition": {"type": "note", "content": "b", "title": "Untitled"}},
+						{"definition": {"type": "group", "title": "Untitled", "widgets": [
+							{"definition": {"type": "note", "content": "c", "title": "Untitled"}},
+							{"definition": {"type": "note", "content": "d", "title": "Untitled"}}
+						]}}
+					]}},
+					{"definition": {"type": "note", "content": "e", "title": "Untitled"}},
+					{"definition": {"type": "query_value", "title": "New"}},
+					{"definition": {"type": "note", "content": "f", "title": "Untitled"}}
+				]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patchDocument(t, tt.rules, dashboard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertDocument(t, got, tt.want)
+		})
+	}
+}
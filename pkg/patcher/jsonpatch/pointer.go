@@ -0,0 +1,240 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pointer is a parsed JSON pointer (RFC 6901), empty for the whole document.
+type pointer []string
+
+func parsePointer(s string) (pointer, error) {
+	if s == "" {
+		return pointer{}, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %s: must start with /", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func (p pointer) String() string {
+	var b strings.Builder
+	for _, token := range p {
+		b.WriteString("/")
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+func (p pointer) child(token string) pointer {
+	res := make(pointer, len(p), len(p)+1)
+	copy(res, p)
+	return append(res, token)
+}
+
+// isPrefixOf reports whether p is other or one of its ancestors.
+func (p pointer) isPrefixOf(other pointer) bool {
+	if len(p) > len(other) {
+		return false
+	}
+	for i := range p {
+		if p[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the value at p.
+func get(doc any, p pointer) (any, error) {
+	node := doc
+	for i, token := range p {
+		switch value := node.(type) {
+		case map[string]any:
+			child, found := value[token]
+			if !found {
+				return nil, fmt.Errorf("path %s not found", p[:i+1])
+			}
+			node = child
+		case []any:
+			index, err := arrayIndex(token, len(value))
+			if err != nil {
+				return nil, fmt.Errorf("path %s not found, err: %w", p[:i+1], err)
+			}
+			node = value[index]
+		default:
+			return nil, fmt.Errorf("path %s not found", p[:i+1])
+		}
+	}
+	return node, nil
+}
+
+// add sets the member of an object, or inserts into an array, at p. It returns the new document.
+func add(doc any, p pointer, value any) (any, error) {
+	return update(doc, p, p, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			container[token] = value
+			return container, nil
+		case []any:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			index, err := arrayIndex(token, len(container)+1)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s, err: %w", p, err)
+			}
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("invalid path %s: parent is not an object or an array", p)
+		}
+	})
+}
+
+// replace sets the existing value at p. It returns the new document.
+func replace(doc any, p pointer, value any) (any, error) {
+	return update(doc, p, p, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, found := container[token]; !found {
+				return nil, fmt.Errorf("path %s not found", p)
+			}
+			container[token] = value
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, fmt.Errorf("path %s not found, err: %w", p, err)
+			}
+			container[index] = value
+			return container, nil
+		default:
+			return nil, fmt.Errorf("path %s not found", p)
+		}
+	})
+}
+
+// remove deletes the value at p. It returns the new document.
+func remove(doc any, p pointer) (any, error) {
+	return update(doc, p, p, func(parent any, token string) (any, error) {
+		switch container := parent.(type) {
+		case map[string]any:
+			if _, found := container[token]; !found {
+				return nil, fmt.Errorf("path %s not found", p)
+			}
+			delete(container, token)
+			return container, nil
+		case []any:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, fmt.Errorf("path %s not found, err: %w", p, err)
+			}
+			return append(container[:index], container[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %s not found", p)
+		}
+	})
+}
+
+// update calls fn with the parent of the last token of p, and stores the parent it returns.
+// Arrays are values, so the new parents are stored up to the document, which is returned.
+func update(node any, full, p pointer, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(p) == 0 {
+		return nil, fmt.Errorf("the whole object cannot be changed")
+	}
+	if len(p) == 1 {
+		return fn(node, p[0])
+	}
+
+	switch container := node.(type) {
+	case map[string]any:
+		child, found := container[p[0]]
+		if !found {
+			return nil, fmt.Errorf("path %s not found", full[:len(full)-len(p)+1])
+		}
+		newChild, err := update(child, full, p[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[p[0]] = newChild
+		return container, nil
+	case []any:
+		index, err := arrayIndex(p[0], len(container))
+		if err != nil {
+			return nil, fmt.Errorf("path %s not found, err: %w", full[:len(full)-len(p)+1], err)
+		}
+		newChild, err := update(container[index], full, p[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = newChild
+		return container, nil
+	default:
+		return nil, fmt.Errorf("path %s not found", full[:len(full)-len(p)+1])
+	}
+}
+
+// arrayIndex parses an array index, which must be lower than size.
+func arrayIndex(token string, size int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %s", token)
+	}
+	if index >= size {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+// valuesEqual compares JSON values, numbers by value.
+func valuesEqual(a, b any) bool {
+	switch aValue := a.(type) {
+	case json.Number:
+		bValue, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if aValue == bValue {
+			return true
+		}
+		aFloat, aErr := aValue.Float64()
+		bFloat, bErr := bValue.Float64()
+		return aErr == nil && bErr == nil && aFloat == bFloat
+	case map[string]any:
+		bValue, ok := b.(map[string]any)
+		if !ok || len(aValue) != len(bValue) {
+			return false
+		}
+		for key, elem := range aValue {
+			other, found := bValue[key]
+			if !found || !valuesEqual(elem, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bValue, ok := b.([]any)
+		if !ok || len(aValue) != len(bValue) {
+			return false
+		}
+		for i := range aValue {
+			if !valuesEqual(aValue[i], bValue[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,258 @@
+package jsonpatch
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    pointer
+		wantErr bool
+	}{
+		{input: "", want: pointer{}},
+		{input: "/", want: pointer{""}},
+		{input: "/foo/0", want: pointer{"foo", "0"}},
+		{input: "/a~1b/m~0n", want: pointer{"a/b", "m~n"}},
+		{input: "/~01", want: pointer{"~1"}},
+		{input: "/~10", want: pointer{"/0"}},
+		{input: "foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parsePointer(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got.String() != tt.input {
+				t.Errorf("got string %s, want %s", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+// TestRFC6902Examples runs the examples of RFC 6902 appendix A. A.11 is left out: unknown members of operations
+// are rejected, as in all files of the tool, and A.13 is not valid JSON for the decoder.
+func TestRFC6902Examples(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"}]`,
+			want:  `{"foo":"bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo":["bar","qux","baz"]}`,
+			patch: `[{"op":"remove","path":"/foo/1"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			want:  `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo":["all","grass","cows","eat"]}`,
+			patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			want:  `{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			want:  `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:    "A.9 testing a value: error",
+			doc:     `{"baz":"qux"}`,
+			patch:   `[{"op":"test","path":"/baz","value":"bar"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			want:  `{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			name:    "A.12 adding to a nonexistent target",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/":9,"~1":10}`,
+			patch: `[{"op":"test","path":"/~01","value":10}]`,
+			want:  `{"/":9,"~1":10}`,
+		},
+		{
+			name:    "A.15 comparing strings and numbers",
+			doc:     `{"/":9,"~1":10}`,
+			patch:   `[{"op":"test","path":"/~01","value":"10"}]`,
+			wantErr: true,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			want:  `{"foo":["bar",["abc","def"]]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patchDocument(t, tt.patch, tt.doc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			assertDocument(t, got, tt.want)
+		})
+	}
+}
+
+func TestArrayEndIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "add appends",
+			patch: `[{"op":"add","path":"/tags/-","value":"team:a"}]`,
+			want:  `{"tags":["env:prod","team:a"],"widgets":[]}`,
+		},
+		{
+			name:  "add appends to an empty array",
+			patch: `[{"op":"add","path":"/widgets/-","value":{"id":1}}]`,
+			want:  `{"tags":["env:prod"],"widgets":[{"id":1}]}`,
+		},
+		{
+			name:  "copy appends",
+			patch: `[{"op":"copy","from":"/tags/0","path":"/tags/-"}]`,
+			want:  `{"tags":["env:prod","env:prod"],"widgets":[]}`,
+		},
+		{
+			name:  "move appends",
+			patch: `[{"op":"add","path":"/tags/-","value":"team:a"},{"op":"move","from":"/tags/0","path":"/tags/-"}]`,
+			want:  `{"tags":["team:a","env:prod"],"widgets":[]}`,
+		},
+		{
+			name:    "replace fails",
+			patch:   `[{"op":"replace","path":"/tags/-","value":"team:a"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "remove fails",
+			patch:   `[{"op":"remove","path":"/tags/-"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "test fails",
+			patch:   `[{"op":"test","path":"/tags/-","value":"env:prod"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "not a parent",
+			patch:   `[{"op":"add","path":"/tags/-/a","value":1}]`,
+			wantErr: true,
+		},
+		{
+			name:    "index past the end",
+			patch:   `[{"op":"add","path":"/tags/2","value":"team:a"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "leading zero",
+			patch:   `[{"op":"add","path":"/tags/01","value":"team:a"}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := patchDocument(t, tt.patch, `{"tags":["env:prod"],"widgets":[]}`)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			assertDocument(t, got, tt.want)
+		})
+	}
+}
+
+// patchDocument applies the patch file content to the document, as the patcher does for monitors.
+func patchDocument(t *testing.T, patch, doc string) (map[string]any, error) {
+	t.Helper()
+
+	p, err := Parse([]byte(patch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := migrate.ParseDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.PatchRaw(context.Background(), config.Config{}, migrate.MonitorType, obj)
+	return obj, err
+}
+
+func assertDocument(t *testing.T, got map[string]any, want string) {
+	t.Helper()
+
+	wantDoc, err := migrate.ParseDocument([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantDoc) {
+		gotJSON, _ := json.Marshal(got)
+		t.Errorf("got %s, want %s", gotJSON, want)
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 )
 
 var ksmTagMapping = map[string]string{
@@ -43,24 +41,24 @@ var ksmTagReplaceRegexp = regexp.MustCompile(
 	strings.Replace(`[\{\, ](PLACEHOLDER)[\}\:\, ]`, "PLACEHOLDER", strings.Join(ksmOriginalTags(), "|"), 1),
 )
 
-var variableReferenceRegexp = regexp.MustCompile(`\$[a-zA-Z0-9_-]+`)
-
 type patchResult struct {
 	err     error
 	patched string
 }
 
-func patchQueryString(query string, usedVariables map[string]struct{}) (res patchResult) {
-	if !strings.Contains(query, "kubernetes_state.") {
-		return
-	}
+// patchQuery patches dashboard queries, only KSM queries are relevant.
+func patchQuery(query string) (string, bool, error) {
+	res := patchQueryString(query)
+	return res.patched, isKSMQuery(query), res.err
+}
 
-	// Tracking template variables used by KSM queries
-	if usedVariables != nil {
-		varMatch := variableReferenceRegexp.FindAllString(query, -1)
-		for _, v := range varMatch {
-			usedVariables[v[1:]] = struct{}{}
-		}
+func isKSMQuery(query string) bool {
+	return strings.Contains(query, "kubernetes_state.")
+}
+
+func patchQueryString(query string) (res patchResult) {
+	if !isKSMQuery(query) {
+		return
 	}
 
 	// Replace tags
@@ -87,47 +85,6 @@ func patchQueryString(query string, usedVariables map[string]struct{}) (res patc
 	return
 }
 
-type requestWidgetInterface interface {
-	GetQOk() (*string, bool)
-	SetQ(v string)
-	GetQueriesOk() (*[]datadogV1.FormulaAndFunctionQueryDefinition, bool)
-}
-
-func patchRequestWidget(reqWidget requestWidgetInterface, usedVariables map[string]struct{}) (bool, error) {
-	widgetPatched := false
-
-	if q, ok := reqWidget.GetQOk(); ok && q != nil {
-		res := patchQueryString(*q, usedVariables)
-		if res.err != nil {
-			return widgetPatched, res.err
-		}
-
-		if res.patched != "" {
-			widgetPatched = true
-			reqWidget.SetQ(res.patched)
-		}
-	}
-
-	if queries, ok := reqWidget.GetQueriesOk(); ok && queries != nil {
-		for i := range *queries {
-			query := &(*queries)[i]
-			if query.FormulaAndFunctionMetricQueryDefinition != nil {
-				res := patchQueryString(query.FormulaAndFunctionMetricQueryDefinition.Query, usedVariables)
-				if res.err != nil {
-					return widgetPatched, res.err
-				}
-
-				if res.patched != "" {
-					widgetPatched = true
-					query.FormulaAndFunctionMetricQueryDefinition.Query = res.patched
-				}
-			}
-		}
-	}
-
-	return widgetPatched, nil
-}
-
 var templateVarRegexp = regexp.MustCompile(
 	strings.Replace(`(PLACEHOLDER)\.name`, "PLACEHOLDER", strings.Join(ksmOriginalTags(), "|"), 1),
 )
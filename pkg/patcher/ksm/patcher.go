@@ -2,15 +2,38 @@ package ksm
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
 	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+	"github.com/DataDog/migrate-tool/pkg/patcher/widgets"
 )
 
+func init() {
+	patcher.Register(patcher.Info{
+		Name:        "ksm-to-core",
+		Description: "Migrate kubernetes_state metrics and tags to the KSM core check",
+		Version:     Patcher{}.Version(),
+		ObjectTypes: []string{migrate.DashboardType, migrate.MonitorType},
+	}, func(_ string, options json.RawMessage) (migrate.Patcher, error) {
+		// No options yet
+		if err := patcher.DecodeOptions(options, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return migrate.NewTypedPatcher(Patcher{}), nil
+	})
+}
+
 type Patcher struct{}
 
+func (Patcher) Version() string {
+	return "1.0.0"
+}
+
 func (Patcher) PatchMonitor(_ context.Context, _ config.Config, monitor *datadogV1.Monitor) (bool, error) {
-	res := patchQueryString(monitor.Query, nil)
+	res := patchQueryString(monitor.Query)
 	if res.err != nil {
 		return false, res.err
 	}
@@ -50,107 +73,14 @@ func (Patcher) PatchDashboard(_ context.Context, _ config.Config, dashboard *dat
 	// Tracking template variables used by KSM queries
 	usedTemplateVariables := make(map[string]struct{})
 
-	dashboardPatched, err := patchWidgets(dashboard.Widgets, usedTemplateVariables)
+	dashboardPatched, err := widgets.PatchQueries(dashboard.Widgets, patchQuery, usedTemplateVariables)
 	if err != nil {
 		return false, err
 	}
 
-	for varIndex := range dashboard.TemplateVariables {
-		variable := &dashboard.TemplateVariables[varIndex]
-
-		currentPrefix := variable.Prefix.Get()
-		if _, found := usedTemplateVariables[variable.Name]; found && currentPrefix != nil {
-			if newVal, found := ksmTagMapping[*currentPrefix]; found {
-				variable.Prefix.Set(&newVal)
-				dashboardPatched = true
-			}
-		}
+	if widgets.PatchVariablePrefixes(dashboard, usedTemplateVariables, ksmTagMapping) {
+		dashboardPatched = true
 	}
 
 	return dashboardPatched, nil
 }
-
-func patchWidgets(widgets []datadogV1.Widget, usedTemplateVariables map[string]struct{}) (bool, error) {
-	widgetsPatched := false
-
-	for widgetIndex := range widgets {
-		widget := &widgets[widgetIndex]
-
-		if widget.Definition.GroupWidgetDefinition != nil {
-			patched, err := patchWidgets(widget.Definition.GroupWidgetDefinition.Widgets, usedTemplateVariables)
-			if err != nil {
-				return false, err
-			}
-
-			widgetsPatched = widgetsPatched || patched
-		}
-
-		if widget.Definition.ChangeWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.ChangeWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.ChangeWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-
-		if widget.Definition.TableWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.TableWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.TableWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-
-		if widget.Definition.QueryValueWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.QueryValueWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.QueryValueWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-
-		if widget.Definition.TimeseriesWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.TimeseriesWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.TimeseriesWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-
-		if widget.Definition.ToplistWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.ToplistWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.ToplistWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-
-		if widget.Definition.TreeMapWidgetDefinition != nil {
-			for reqIndex := range widget.Definition.TreeMapWidgetDefinition.Requests {
-				patched, err := patchRequestWidget(&widget.Definition.TreeMapWidgetDefinition.Requests[reqIndex], usedTemplateVariables)
-				if err != nil {
-					return false, err
-				}
-
-				widgetsPatched = widgetsPatched || patched
-			}
-		}
-	}
-
-	return widgetsPatched, nil
-}
@@ -0,0 +1,192 @@
+// Package patcher is the registry of patchers. Patchers register themselves in their init function,
+// and are built by name with their options from the config file.
+//
+// Patchers taking an argument, such as a command or a file, are selected with `name:argument`.
+package patcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// Info describes a registered patcher.
+type Info struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	ObjectTypes []string `json:"object_types"`
+	// Arg describes the argument of the patcher, empty if it takes none
+	Arg string `json:"arg,omitempty"`
+}
+
+// Usage returns how the patcher is selected, with its argument if any.
+func (info Info) Usage() string {
+	if info.Arg == "" {
+		return info.Name
+	}
+	return info.Name + ":<" + info.Arg + ">"
+}
+
+// Supports reports whether the patcher handles objects of the given type.
+func (info Info) Supports(objType string) bool {
+	for _, supported := range info.ObjectTypes {
+		if supported == objType {
+			return true
+		}
+	}
+	return false
+}
+
+// Factory builds a patcher from its argument and its options in the config file. Options are nil when not set.
+type Factory func(arg string, options json.RawMessage) (migrate.Patcher, error)
+
+type registration struct {
+	info    Info
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]registration{}
+)
+
+// Register makes a patcher available by name. It panics if the name is empty or already registered.
+func Register(info Info, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := strings.ToLower(info.Name)
+	if name == "" || factory == nil {
+		panic("patcher: Register called with an empty name or a nil factory")
+	}
+	if _, found := registry[name]; found {
+		panic("patcher: Register called twice for patcher " + name)
+	}
+
+	info.Name = name
+	registry[name] = registration{info: info, factory: factory}
+}
+
+// List returns the registered patchers sorted by name.
+func List() []Info {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]Info, 0, len(registry))
+	for _, reg := range registry {
+		infos = append(infos, reg.info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Lookup returns the description of the patcher registered with the name.
+func Lookup(name string) (Info, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	reg, found := registry[strings.ToLower(name)]
+	return reg.info, found
+}
+
+// ParseSpec splits a patcher selection into the registered name and the argument.
+func ParseSpec(spec string) (string, string) {
+	name, arg, _ := strings.Cut(spec, ":")
+	return strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(arg)
+}
+
+// New builds the patcher selected by spec, `name` or `name:argument`. Objects of types it does not support
+// are left unchanged. The returned info is named after the whole spec, so that it identifies the patcher
+// in the state manifest.
+func New(spec string, options json.RawMessage) (migrate.Patcher, Info, error) {
+	name, arg := ParseSpec(spec)
+
+	registryMu.RLock()
+	reg, found := registry[name]
+	registryMu.RUnlock()
+	if !found {
+		return nil, Info{}, fmt.Errorf("missing or unknown patcher %s, available patchers: %s", spec, strings.Join(usages(), ", "))
+	}
+
+	info := reg.info
+	switch {
+	case info.Arg == "" && arg != "":
+		return nil, info, fmt.Errorf("patcher %s does not take an argument", name)
+	case info.Arg != "" && arg == "":
+		return nil, info, fmt.Errorf("patcher %s requires an argument: %s", name, info.Usage())
+	case arg != "":
+		info.Name = name + ":" + arg
+	}
+
+	p, err := reg.factory(arg, options)
+	if err != nil {
+		return nil, info, fmt.Errorf("failed to create patcher %s, err: %w", info.Name, err)
+	}
+
+	return scopedPatcher{Patcher: p, info: info}, info, nil
+}
+
+// FromConfig builds the patcher selected by spec, with the options of its registered name from the config file.
+func FromConfig(cfg config.Config, spec string) (migrate.Patcher, Info, error) {
+	name, _ := ParseSpec(spec)
+	return New(spec, cfg.Patchers[name])
+}
+
+// DecodeOptions decodes patcher options into v. Unknown options are rejected, so that typos are not ignored.
+func DecodeOptions(options json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(options)) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(options))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid options, err: %w", err)
+	}
+	return nil
+}
+
+func usages() []string {
+	infos := List()
+	res := make([]string, 0, len(infos))
+	for _, info := range infos {
+		res = append(res, info.Usage())
+	}
+	return res
+}
+
+// scopedPatcher skips objects of types the patcher does not support, and reports the registered version.
+type scopedPatcher struct {
+	migrate.Patcher
+	info Info
+}
+
+func (p scopedPatcher) Version() string {
+	return p.info.Version
+}
+
+// Close stops the resources of the patcher, such as external processes.
+func (p scopedPatcher) Close() error {
+	if closer, ok := p.Patcher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (p scopedPatcher) PatchRaw(ctx context.Context, cfg config.Config, objType string, doc map[string]any) (bool, error) {
+	if !p.info.Supports(objType) {
+		return false, nil
+	}
+	return p.Patcher.PatchRaw(ctx, cfg, objType, doc)
+}
@@ -0,0 +1,253 @@
+package rules
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher/widgets"
+)
+
+// metricRegexp matches metric names, followed by their scope
+var metricRegexp = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9_.]*\{`)
+
+// scopeRegexp matches the scopes and groupings of queries, such as {env:prod,!pod:a} or by {host}
+var scopeRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+// tagTermRegexp matches the tags of a scope
+var tagTermRegexp = regexp.MustCompile(`[^,{}()!\s]+`)
+
+func (p *Patcher) PatchMonitor(_ context.Context, _ config.Config, monitor *datadogV1.Monitor) (bool, error) {
+	monitorPatched := false
+
+	for _, set := range p.sets {
+		if !set.appliesTo(migrate.MonitorType) {
+			continue
+		}
+
+		patched, relevant := set.patchQuery(monitor.Query)
+		if patched != "" {
+			monitor.Query = patched
+			monitorPatched = true
+		}
+
+		if monitor.Name != nil {
+			if patched := set.patchText("name", *monitor.Name, relevant); patched != "" {
+				monitor.Name = &patched
+				monitorPatched = true
+			}
+		}
+
+		if monitor.Message != nil {
+			if patched := set.patchText("message", *monitor.Message, relevant); patched != "" {
+				monitor.Message = &patched
+				monitorPatched = true
+			}
+		}
+	}
+
+	return monitorPatched, nil
+}
+
+func (p *Patcher) PatchDashboard(_ context.Context, _ config.Config, dashboard *datadogV1.Dashboard) (bool, error) {
+	dashboardPatched := false
+
+	for _, set := range p.sets {
+		if !set.appliesTo(migrate.DashboardType) {
+			continue
+		}
+
+		// Tracking template variables used by the queries the rules apply to
+		usedTemplateVariables := make(map[string]struct{})
+
+		patched, err := widgets.PatchQueries(dashboard.Widgets, func(query string) (string, bool, error) {
+			patched, relevant := set.patchQuery(query)
+			return patched, relevant, nil
+		}, usedTemplateVariables)
+		if err != nil {
+			return false, err
+		}
+		dashboardPatched = dashboardPatched || patched
+
+		if set.patchTemplateVariables(dashboard, usedTemplateVariables) {
+			dashboardPatched = true
+		}
+
+		patched, err = set.renameTemplateVariables(dashboard)
+		if err != nil {
+			return false, err
+		}
+		dashboardPatched = dashboardPatched || patched
+
+		if patched := set.patchText("title", dashboard.Title, false); patched != "" {
+			dashboard.Title = patched
+			dashboardPatched = true
+		}
+
+		if description := dashboard.Description.Get(); description != nil {
+			if patched := set.patchText("description", *description, false); patched != "" {
+				dashboard.Description.Set(&patched)
+				dashboardPatched = true
+			}
+		}
+	}
+
+	return dashboardPatched, nil
+}
+
+// patchQuery applies the metric and tag rules to the query. It returns the patched query, empty if unchanged,
+// and whether the rules apply to the query.
+func (set *ruleSet) patchQuery(query string) (string, bool) {
+	if set.queries != nil && !set.queries.MatchString(query) {
+		return "", false
+	}
+
+	patched := query
+	if len(set.Metrics) > 0 {
+		patched = metricRegexp.ReplaceAllStringFunc(patched, func(match string) string {
+			if newMetric, found := set.Metrics[match[:len(match)-1]]; found {
+				return newMetric + "{"
+			}
+			return match
+		})
+	}
+
+	if len(set.TagKeys) > 0 || len(set.TagValues) > 0 {
+		patched = scopeRegexp.ReplaceAllStringFunc(patched, func(scope string) string {
+			return tagTermRegexp.ReplaceAllStringFunc(scope, set.patchTag)
+		})
+	}
+
+	if patched == query {
+		return "", true
+	}
+	return patched, true
+}
+
+// patchTag rewrites a tag, `key` or `key:value`. Values are looked up with the original key.
+func (set *ruleSet) patchTag(tag string) string {
+	if strings.HasPrefix(tag, "$") {
+		return tag
+	}
+
+	key, value, hasValue := strings.Cut(tag, ":")
+	if hasValue {
+		if newValue, found := set.TagValues[key][value]; found {
+			value = newValue
+		}
+	}
+	if newKey, found := set.TagKeys[key]; found {
+		key = newKey
+	}
+
+	if !hasValue {
+		return key
+	}
+	return key + ":" + value
+}
+
+// patchText applies the replacements of the field to text, and the tag key renames of {{key.name}}
+// if the rules apply to the query of the object. It returns an empty string if text is unchanged.
+func (set *ruleSet) patchText(field, text string, relevant bool) string {
+	patched := text
+	if relevant && set.templateTags != nil {
+		patched = set.templateTags.ReplaceAllStringFunc(patched, func(match string) string {
+			return set.TagKeys[strings.TrimSuffix(match, ".name")] + ".name"
+		})
+	}
+
+	if replaced := set.replaceText(field, patched); replaced != "" {
+		patched = replaced
+	}
+
+	if patched == text {
+		return ""
+	}
+	return patched
+}
+
+// patchTemplateVariables rewrites the values and prefixes of the used template variables.
+func (set *ruleSet) patchTemplateVariables(dashboard *datadogV1.Dashboard, usedTemplateVariables map[string]struct{}) bool {
+	patched := false
+
+	// Values are looked up with the original prefix, before it is renamed
+	variableValues := make(map[string]map[string]string)
+	for varIndex := range dashboard.TemplateVariables {
+		variable := &dashboard.TemplateVariables[varIndex]
+
+		prefix := variable.Prefix.Get()
+		if _, found := usedTemplateVariables[variable.Name]; !found || prefix == nil || len(set.TagValues[*prefix]) == 0 {
+			continue
+		}
+		values := set.TagValues[*prefix]
+		variableValues[variable.Name] = values
+
+		if current := variable.Default.Get(); current != nil {
+			if newValue, found := values[*current]; found {
+				variable.Default.Set(&newValue)
+				patched = true
+			}
+		}
+		if rewriteValues(variable.Defaults, values) {
+			patched = true
+		}
+		if available := variable.AvailableValues.Get(); available != nil && rewriteValues(*available, values) {
+			patched = true
+		}
+	}
+
+	for presetIndex := range dashboard.TemplateVariablePresets {
+		preset := &dashboard.TemplateVariablePresets[presetIndex]
+
+		for valueIndex := range preset.TemplateVariables {
+			presetValue := &preset.TemplateVariables[valueIndex]
+			if presetValue.Name == nil {
+				continue
+			}
+
+			values, found := variableValues[*presetValue.Name]
+			if !found {
+				continue
+			}
+			if presetValue.Value != nil {
+				if newValue, found := values[*presetValue.Value]; found {
+					presetValue.Value = &newValue
+					patched = true
+				}
+			}
+			if rewriteValues(presetValue.Values, values) {
+				patched = true
+			}
+		}
+	}
+
+	if widgets.PatchVariablePrefixes(dashboard, usedTemplateVariables, set.TagKeys) {
+		patched = true
+	}
+
+	return patched
+}
+
+func rewriteValues(values []string, mapping map[string]string) bool {
+	patched := false
+	for i, value := range values {
+		if newValue, found := mapping[value]; found {
+			values[i] = newValue
+			patched = true
+		}
+	}
+	return patched
+}
+
+// renameTemplateVariables renames the template variables, their presets and their references in widget queries.
+func (set *ruleSet) renameTemplateVariables(dashboard *datadogV1.Dashboard) (bool, error) {
+	if len(set.TemplateVariables) == 0 {
+		return false, nil
+	}
+
+	return widgets.RenameVariables(dashboard, set.TemplateVariables)
+}
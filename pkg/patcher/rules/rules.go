@@ -0,0 +1,211 @@
+// Package rules patches objects with the renames and rewrites of a rule file, so that migrations need no Go code.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+)
+
+func init() {
+	patcher.Register(patcher.Info{
+		Name:        "rules",
+		Description: "Apply the renames and rewrites of a YAML or JSON rule file",
+		Version:     "1.0.0",
+		ObjectTypes: []string{migrate.DashboardType, migrate.MonitorType},
+		Arg:         "file",
+	}, func(arg string, options json.RawMessage) (migrate.Patcher, error) {
+		// No options yet
+		if err := patcher.DecodeOptions(options, &struct{}{}); err != nil {
+			return nil, err
+		}
+		p, err := Load(arg)
+		if err != nil {
+			return nil, err
+		}
+		return migrate.NewTypedPatcher(p), nil
+	})
+}
+
+// File is the content of a rule file. Rule sets are applied in order.
+type File struct {
+	Rules []RuleSet `yaml:"rules"`
+}
+
+// RuleSet holds the rules applied to objects of the given types, all types if empty.
+type RuleSet struct {
+	ObjectTypes []string `yaml:"object_types"`
+	// Queries restricts the query rules to the metric queries matching this regular expression
+	Queries string `yaml:"queries"`
+	// Metrics renames metrics in queries
+	Metrics map[string]string `yaml:"metrics"`
+	// TagKeys renames tag keys in queries, in template variable prefixes and in {{key.name}} of monitors
+	TagKeys map[string]string `yaml:"tag_keys"`
+	// TagValues rewrites the values of tags, by original tag key, in queries and template variable values
+	TagValues map[string]map[string]string `yaml:"tag_values"`
+	// TemplateVariables renames dashboard template variables and their references in widget queries
+	TemplateVariables map[string]string `yaml:"template_variables"`
+	// Replacements of regular expressions in names and messages
+	Replacements []Replacement `yaml:"replacements"`
+}
+
+// Replacement replaces the matches of a regular expression in text fields, all of them if none is given.
+// Fields are name and message for monitors, title and description for dashboards.
+type Replacement struct {
+	Fields      []string `yaml:"fields"`
+	Pattern     string   `yaml:"pattern"`
+	Replacement string   `yaml:"replacement"`
+}
+
+var textFields = map[string]string{
+	"name":        migrate.MonitorType,
+	"message":     migrate.MonitorType,
+	"title":       migrate.DashboardType,
+	"description": migrate.DashboardType,
+}
+
+// Patcher applies the rule sets of a rule file.
+type Patcher struct {
+	sets []*ruleSet
+}
+
+// Load reads the rule file at path, in YAML or JSON.
+func Load(path string) (*Patcher, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file at %s, err: %w", path, err)
+	}
+
+	p, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule file at %s, err: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse builds a patcher from the content of a rule file. Unknown keys and invalid patterns are rejected.
+func Parse(content []byte) (*Patcher, error) {
+	file := File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(file.Rules) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+
+	p := &Patcher{}
+	for i, set := range file.Rules {
+		compiled, err := compileRuleSet(set)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule set %d, err: %w", i+1, err)
+		}
+		p.sets = append(p.sets, compiled)
+	}
+	return p, nil
+}
+
+type ruleSet struct {
+	RuleSet
+	queries      *regexp.Regexp
+	templateTags *regexp.Regexp
+	replacements []replacement
+}
+
+type replacement struct {
+	fields      map[string]bool
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func compileRuleSet(set RuleSet) (*ruleSet, error) {
+	compiled := &ruleSet{RuleSet: set}
+
+	for _, objType := range set.ObjectTypes {
+		if objType != migrate.DashboardType && objType != migrate.MonitorType {
+			return nil, fmt.Errorf("invalid object type: %s", objType)
+		}
+	}
+
+	if set.Queries != "" {
+		queries, err := regexp.Compile(set.Queries)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queries pattern %s, err: %w", set.Queries, err)
+		}
+		compiled.queries = queries
+	}
+
+	if len(set.TagKeys) > 0 {
+		keys := make([]string, 0, len(set.TagKeys))
+		for key := range set.TagKeys {
+			keys = append(keys, regexp.QuoteMeta(key))
+		}
+		// Longest keys first, so that they win over their prefixes
+		sort.Slice(keys, func(i, j int) bool {
+			return len(keys[i]) > len(keys[j])
+		})
+		compiled.templateTags = regexp.MustCompile(`\b(` + strings.Join(keys, "|") + `)\.name\b`)
+	}
+
+	for _, r := range set.Replacements {
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replacement pattern %s, err: %w", r.Pattern, err)
+		}
+
+		fields := map[string]bool{}
+		for _, field := range r.Fields {
+			if _, found := textFields[field]; !found {
+				return nil, fmt.Errorf("invalid replacement field: %s", field)
+			}
+			fields[field] = true
+		}
+		if len(fields) == 0 {
+			for field := range textFields {
+				fields[field] = true
+			}
+		}
+
+		compiled.replacements = append(compiled.replacements, replacement{fields: fields, pattern: pattern, replacement: r.Replacement})
+	}
+
+	return compiled, nil
+}
+
+func (set *ruleSet) appliesTo(objType string) bool {
+	if len(set.ObjectTypes) == 0 {
+		return true
+	}
+	for _, t := range set.ObjectTypes {
+		if t == objType {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceText applies the replacements of the field to text. It returns an empty string if text is unchanged.
+func (set *ruleSet) replaceText(field, text string) string {
+	patched := text
+	for _, r := range set.replacements {
+		if r.fields[field] {
+			patched = r.pattern.ReplaceAllString(patched, r.replacement)
+		}
+	}
+	if patched == text {
+		return ""
+	}
+	return patched
+}
@@ -0,0 +1,213 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			content: `
+rules:
+  - metrics:
+      kubernetes_state.pod.ready: kubernetes_state.pod.status_ready
+    tag_keys:
+      pod: pod_name
+`,
+		},
+		{
+			name:    "json",
+			content: `{"rules":[{"object_types":["monitor"],"replacements":[{"fields":["name"],"pattern":"a","replacement":"b"}]}]}`,
+		},
+		{
+			name:    "empty",
+			content: ``,
+			wantErr: "no rules",
+		},
+		{
+			name:    "unknown key",
+			content: "rules:\n  - metric: {}\n",
+			wantErr: "field metric not found",
+		},
+		{
+			name:    "invalid object type",
+			content: "rules:\n  - object_types: [slo]\n",
+			wantErr: "invalid object type: slo",
+		},
+		{
+			name:    "invalid queries pattern",
+			content: "rules:\n  - queries: \"(\"\n",
+			wantErr: "invalid queries pattern",
+		},
+		{
+			name:    "invalid replacement field",
+			content: "rules:\n  - replacements:\n      - fields: [query]\n        pattern: a\n",
+			wantErr: "invalid replacement field: query",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content))
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatchRaw(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		objType string
+		input   string
+		want    string
+	}{
+		{
+			name: "monitor metrics, tags and template tags",
+			rules: `
+rules:
+  - metrics:
+      kubernetes_state.pod.ready: kubernetes_state.pod.status_ready
+    tag_keys:
+      pod: pod_name
+    tag_values:
+      env:
+        production: prod
+`,
+			objType: migrate.MonitorType,
+			input:   `{"name":"Pod {{pod.name}} not ready","type":"query alert","query":"avg(last_5m):avg:kubernetes_state.pod.ready{env:production,!pod:a} by {pod} < 1","message":"{{pod.name}}","custom_field":1.0}`,
+			want:    `{"name":"Pod {{pod_name.name}} not ready","type":"query alert","query":"avg(last_5m):avg:kubernetes_state.pod.status_ready{env:prod,!pod_name:a} by {pod_name} < 1","message":"{{pod_name.name}}","custom_field":1.0}`,
+		},
+		{
+			name: "queries filter",
+			rules: `
+rules:
+  - queries: "^avg:a\\{"
+    tag_keys:
+      pod: pod_name
+`,
+			objType: migrate.MonitorType,
+			input:   `{"name":"{{pod.name}}","type":"query alert","query":"avg(last_5m):avg:b{*} by {pod} > 1"}`,
+			want:    `{"name":"{{pod.name}}","type":"query alert","query":"avg(last_5m):avg:b{*} by {pod} > 1"}`,
+		},
+		{
+			name: "template variables renamed in the queries of all widgets",
+			rules: `
+rules:
+  - template_variables:
+      env: environment
+`,
+			objType: migrate.DashboardType,
+			input: `{
+				"title": "Pods",
+				"layout_type": "ordered",
+				"template_variables": [{"name": "env", "prefix": "env"}, {"name": "cluster", "prefix": "cluster"}],
+				"template_variable_presets": [{"name": "prod", "template_variables": [{"name": "env", "value": "prod"}]}],
+				"widgets": [
+					{"definition": {"type": "timeseries", "requests": [{"q": "avg:a{$env,$cluster}"}]}},
+					{"definition": {"type": "group", "layout_type": "ordered", "widgets": [
+						{"definition": {"type": "query_value", "requests": [{"queries": [{"data_source": "metrics", "name": "q", "query": "avg:b{$env.value}"}], "formulas": [{"formula": "q"}]}]}}
+					]}},
+					{"definition": {"type": "note", "content": "Filtered on $env, not $environment_old"}},
+					{"definition": {"type": "check_status", "check": "kubernetes.up", "grouping": "cluster", "tags": ["$env"]}},
+					{"definition": {"type": "log_stream", "query": "service:a $env", "indexes": []}}
+				]
+			}`,
+			want: `{
+				"title": "Pods",
+				"layout_type": "ordered",
+				"template_variables": [{"name": "environment", "prefix": "env"}, {"name": "cluster", "prefix": "cluster"}],
+				"template_variable_presets": [{"name": "prod", "template_variables": [{"name": "environment", "value": "prod"}]}],
+				"widgets": [
+					{"definition": {"type": "timeseries", "requests": [{"q": "avg:a{$environment,$cluster}"}]}},
+					{"definition": {"type": "group", "layout_type": "ordered", "widgets": [
+						{"definition": {"type": "query_value", "requests": [{"queries": [{"data_source": "metrics", "name": "q", "query": "avg:b{$environment.value}"}], "formulas": [{"formula": "q"}]}]}}
+					]}},
+					{"definition": {"type": "note", "content": "Filtered on $env, not $environment_old"}},
+					{"definition": {"type": "check_status", "check": "kubernetes.up", "grouping": "cluster", "tags": ["$environment"]}},
+					{"definition": {"type": "log_stream", "query": "service:a $environment", "indexes": []}}
+				]
+			}`,
+		},
+		{
+			name: "template variable values and prefixes of matching queries",
+			rules: `
+rules:
+  - tag_keys:
+      kube_namespace: namespace
+    tag_values:
+      kube_namespace:
+        default: main
+`,
+			objType: migrate.DashboardType,
+			input: `{
+				"title": "Namespaces",
+				"layout_type": "ordered",
+				"template_variables": [{"name": "ns", "prefix": "kube_namespace", "default": "default"}],
+				"widgets": [{"definition": {"type": "toplist", "requests": [{"q": "top(avg:a{$ns} by {kube_namespace}, 10, 'mean', 'desc')"}]}}]
+			}`,
+			want: `{
+				"title": "Namespaces",
+				"layout_type": "ordered",
+				"template_variables": [{"name": "ns", "prefix": "namespace", "default": "main"}],
+				"widgets": [{"definition": {"type": "toplist", "requests": [{"q": "top(avg:a{$ns} by {namespace}, 10, 'mean', 'desc')"}]}}]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse([]byte(tt.rules))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			doc, err := migrate.ParseDocument([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := migrate.ParseDocument([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := migrate.NewTypedPatcher(p).PatchRaw(context.Background(), config.Config{}, tt.objType, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantPatched := !reflect.DeepEqual(want, mustParse(t, tt.input)); patched != wantPatched {
+				t.Errorf("got patched %v, want %v", patched, wantPatched)
+			}
+			if !reflect.DeepEqual(doc, want) {
+				got, _ := json.Marshal(doc)
+				t.Errorf("got %s", got)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, content string) map[string]any {
+	t.Helper()
+	doc, err := migrate.ParseDocument([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
@@ -0,0 +1,239 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.starlark.net/starlark"
+
+	"github.com/DataDog/migrate-tool/pkg/patcher/widgets"
+)
+
+// builtins are the helpers predeclared for scripts.
+var builtins = starlark.StringDict{
+	"walk_widgets":                 starlark.NewBuiltin("walk_widgets", walkWidgets),
+	"walk_queries":                 starlark.NewBuiltin("walk_queries", walkQueries),
+	"walk_template_variables":      starlark.NewBuiltin("walk_template_variables", walkTemplateVariables),
+	"template_variable_references": starlark.NewBuiltin("template_variable_references", templateVariableReferences),
+	"regex_match":                  starlark.NewBuiltin("regex_match", regexMatch),
+	"regex_replace":                starlark.NewBuiltin("regex_replace", regexReplace),
+}
+
+// walk_widgets(dashboard, fn) calls fn with each widget, including the widgets of groups.
+func walkWidgets(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var dashboard *starlark.Dict
+	var fn starlark.Callable
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &dashboard, &fn); err != nil {
+		return nil, err
+	}
+
+	err := eachWidget(dashboard, func(widget *starlark.Dict) error {
+		_, err := starlark.Call(thread, fn, starlark.Tuple{widget}, nil)
+		return err
+	})
+	return starlark.None, err
+}
+
+// walk_queries(obj, fn) calls fn with each metric query of a monitor or a dashboard.
+// fn returns the new query, or None to keep it. It returns whether a query was changed.
+func walkQueries(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var obj *starlark.Dict
+	var fn starlark.Callable
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &obj, &fn); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	patchQuery := func(parent *starlark.Dict, key string) error {
+		query, found := getString(parent, key)
+		if !found {
+			return nil
+		}
+
+		res, err := starlark.Call(thread, fn, starlark.Tuple{starlark.String(query)}, nil)
+		if err != nil {
+			return err
+		}
+		if res == starlark.None {
+			return nil
+		}
+		patched, ok := starlark.AsString(res)
+		if !ok {
+			return fmt.Errorf("%s: fn must return a string or None, got %s", b.Name(), res.Type())
+		}
+		if patched != query {
+			changed = true
+			return parent.SetKey(starlark.String(key), starlark.String(patched))
+		}
+		return nil
+	}
+
+	// Monitors have a single query, dashboards have the queries of widget requests
+	if _, found := getString(obj, "query"); found {
+		err := patchQuery(obj, "query")
+		return starlark.Bool(changed), err
+	}
+
+	err := eachWidget(obj, func(widget *starlark.Dict) error {
+		definition, _ := getDict(widget, "definition")
+		for _, request := range requests(definition) {
+			if err := patchQuery(request, "q"); err != nil {
+				return err
+			}
+
+			queries, _ := getList(request, "queries")
+			for i := 0; i < queries.Len(); i++ {
+				query, ok := queries.Index(i).(*starlark.Dict)
+				if !ok {
+					continue
+				}
+				if dataSource, _ := getString(query, "data_source"); dataSource != "metrics" {
+					continue
+				}
+				if err := patchQuery(query, "query"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return starlark.Bool(changed), err
+}
+
+// walk_template_variables(dashboard, fn) calls fn with each template variable of the dashboard.
+func walkTemplateVariables(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var dashboard *starlark.Dict
+	var fn starlark.Callable
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &dashboard, &fn); err != nil {
+		return nil, err
+	}
+
+	variables, _ := getList(dashboard, "template_variables")
+	for i := 0; i < variables.Len(); i++ {
+		if _, err := starlark.Call(thread, fn, starlark.Tuple{variables.Index(i)}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return starlark.None, nil
+}
+
+// template_variable_references(query) returns the names of the template variables referenced by the query.
+func templateVariableReferences(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var query string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &query); err != nil {
+		return nil, err
+	}
+
+	names := []starlark.Value{}
+	for _, name := range widgets.VariableReferences(query) {
+		names = append(names, starlark.String(name))
+	}
+	return starlark.NewList(names), nil
+}
+
+// regex_match(pattern, s) reports whether s contains a match of the regular expression.
+func regexMatch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &pattern, &s); err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %s, err: %w", b.Name(), pattern, err)
+	}
+	return starlark.Bool(re.MatchString(s)), nil
+}
+
+// regex_replace(pattern, replacement, s) replaces the matches of the regular expression, with ${1} for groups.
+func regexReplace(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pattern, replacement, s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 3, &pattern, &replacement, &s); err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %s, err: %w", b.Name(), pattern, err)
+	}
+	return starlark.String(re.ReplaceAllString(s, replacement)), nil
+}
+
+// eachWidget calls fn with each widget of the dashboard, groups before their widgets.
+func eachWidget(parent *starlark.Dict, fn func(*starlark.Dict) error) error {
+	list, _ := getList(parent, "widgets")
+	for i := 0; i < list.Len(); i++ {
+		widget, ok := list.Index(i).(*starlark.Dict)
+		if !ok {
+			continue
+		}
+		if err := fn(widget); err != nil {
+			return err
+		}
+
+		if definition, found := getDict(widget, "definition"); found {
+			if err := eachWidget(definition, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requests returns the requests of a widget definition: a list, or a map for widgets such as scatter plots.
+func requests(definition *starlark.Dict) []*starlark.Dict {
+	if definition == nil {
+		return nil
+	}
+	value, found, _ := definition.Get(starlark.String("requests"))
+	if !found {
+		return nil
+	}
+
+	res := []*starlark.Dict{}
+	switch requests := value.(type) {
+	case *starlark.List:
+		for i := 0; i < requests.Len(); i++ {
+			if request, ok := requests.Index(i).(*starlark.Dict); ok {
+				res = append(res, request)
+			}
+		}
+	case *starlark.Dict:
+		for _, item := range requests.Items() {
+			if request, ok := item[1].(*starlark.Dict); ok {
+				res = append(res, request)
+			}
+		}
+	}
+	return res
+}
+
+func getString(dict *starlark.Dict, key string) (string, bool) {
+	value, found, _ := dict.Get(starlark.String(key))
+	if !found {
+		return "", false
+	}
+	return starlark.AsString(value)
+}
+
+func getDict(dict *starlark.Dict, key string) (*starlark.Dict, bool) {
+	value, found, _ := dict.Get(starlark.String(key))
+	if !found {
+		return nil, false
+	}
+	res, ok := value.(*starlark.Dict)
+	return res, ok
+}
+
+// getList returns the list at key, or an empty list.
+func getList(dict *starlark.Dict, key string) (*starlark.List, bool) {
+	value, found, _ := dict.Get(starlark.String(key))
+	if !found {
+		return starlark.NewList(nil), false
+	}
+	res, ok := value.(*starlark.List)
+	if !ok {
+		return starlark.NewList(nil), false
+	}
+	return res, true
+}
@@ -0,0 +1,159 @@
+package script
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestBuiltins(t *testing.T) {
+	dashboard := `{
+		"template_variables": [{"name": "env", "prefix": "env"}, {"name": "service"}],
+		"widgets": [
+			{"definition": {"type": "group", "widgets": [
+				{"definition": {"type": "timeseries", "requests": [{"queries": [
+					{"data_source": "metrics", "query": "avg:cpu{$env}"},
+					{"data_source": "logs", "query": "service:a"}
+				]}]}}
+			]}},
+			{"definition": {"type": "scatterplot", "requests": {"x": {"q": "avg:cpu{$service}"}, "y": {"q": "avg:mem{*}"}}}},
+			{"definition": {"type": "note", "content": "avg:cpu{*}"}}
+		]
+	}`
+
+	// Scripts append their results to out, which is returned in the patched object
+	tests := []struct {
+		name   string
+		script string
+		want   []any
+	}{
+		{
+			name: "walk_widgets",
+			script: `
+walk_widgets(obj, lambda widget: out.append(widget["definition"]["type"]))
+`,
+			want: []any{"group", "timeseries", "scatterplot", "note"},
+		},
+		{
+			name: "walk_queries",
+			script: `
+walk_queries(obj, lambda query: out.append(query))
+`,
+			want: []any{"avg:cpu{$env}", "avg:cpu{$service}", "avg:mem{*}"},
+		},
+		{
+			name: "walk_queries reports changes",
+			script: `
+out.append(walk_queries(obj, lambda query: None))
+out.append(walk_queries(obj, lambda query: query))
+out.append(walk_queries(obj, lambda query: query.replace("mem", "memory")))
+walk_queries(obj, lambda query: out.append(query))
+`,
+			want: []any{false, false, true, "avg:cpu{$env}", "avg:cpu{$service}", "avg:memory{*}"},
+		},
+		{
+			name: "walk_queries on a monitor",
+			script: `
+out.append(walk_queries({"query": "avg:cpu{*} > 1"}, lambda query: query.replace("cpu", "load")))
+`,
+			want: []any{true},
+		},
+		{
+			name: "walk_template_variables",
+			script: `
+walk_template_variables(obj, lambda variable: out.append(variable["name"]))
+`,
+			want: []any{"env", "service"},
+		},
+		{
+			name: "template_variable_references",
+			script: `
+out.extend(template_variable_references("avg:cpu{$env,$service.value} by {host}"))
+`,
+			want: []any{"env", "service"},
+		},
+		{
+			name: "regex_match and regex_replace",
+			script: `
+out.append(regex_match("^avg:", "avg:cpu{*}"))
+out.append(regex_match("^sum:", "avg:cpu{*}"))
+out.append(regex_replace("kubernetes_state\\.(\\w+)\\.ready", "kubernetes_state.${1}.status_ready", "avg:kubernetes_state.pod.ready{*}"))
+`,
+			want: []any{true, false, "avg:kubernetes_state.pod.status_ready{*}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := "def patch(obj, ctx):\n    out = []\n" + indent(tt.script) + "    obj[\"out\"] = out\n    return True\n"
+			p, _, err := loadScript(t, script, defaultMaxSteps)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			doc, err := migrate.ParseDocument([]byte(dashboard))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.PatchRaw(context.Background(), config.Config{}, migrate.DashboardType, doc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(doc["out"], tt.want) {
+				t.Errorf("got %v, want %v", doc["out"], tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			name:    "invalid pattern",
+			script:  `regex_match("(", "a")`,
+			wantErr: "regex_match: invalid pattern (",
+		},
+		{
+			name:    "query function not returning a string",
+			script:  `walk_queries(obj, lambda query: 1)`,
+			wantErr: "walk_queries: fn must return a string or None, got int",
+		},
+		{
+			name:    "missing argument",
+			script:  `walk_widgets(obj)`,
+			wantErr: "walk_widgets: got 1 arguments, want 2",
+		},
+		{
+			name:    "error in the callback",
+			script:  `walk_queries(obj, lambda query: query + 1)`,
+			wantErr: "unknown binary op: string + int",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, err := loadScript(t, "def patch(obj, ctx):\n    "+tt.script+"\n    return True\n", defaultMaxSteps)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.PatchRaw(context.Background(), config.Config{}, migrate.MonitorType, map[string]any{"query": "avg:cpu{*}"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// indent indents the lines of a script to make them the body of a function.
+func indent(script string) string {
+	lines := strings.Split(strings.Trim(script, "\n"), "\n")
+	return "    " + strings.Join(lines, "\n    ") + "\n"
+}
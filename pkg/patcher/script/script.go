@@ -0,0 +1,150 @@
+// Package script patches objects with user scripts written in Starlark, a sandboxed dialect of Python.
+//
+// A script defines a patch function, called with each object as a dict and a context with its type,
+// org and ID. The function modifies the object in place and returns whether it was patched:
+//
+//	def patch(obj, ctx):
+//	    if ctx.type != "monitor":
+//	        return False
+//	    ...
+//	    return True
+//
+// Changes are discarded when the function returns False.
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+	"github.com/DataDog/migrate-tool/pkg/patcher"
+)
+
+func init() {
+	patcher.Register(patcher.Info{
+		Name:        "starlark",
+		Description: "Run the patch function of a Starlark script",
+		Version:     "1.0.0",
+		ObjectTypes: []string{migrate.DashboardType, migrate.MonitorType},
+		Arg:         "script",
+	}, func(arg string, rawOptions json.RawMessage) (migrate.Patcher, error) {
+		opts := options{MaxSteps: defaultMaxSteps}
+		if err := patcher.DecodeOptions(rawOptions, &opts); err != nil {
+			return nil, err
+		}
+		return Load(arg, opts.MaxSteps)
+	})
+}
+
+const defaultMaxSteps = 10_000_000
+
+type options struct {
+	// MaxSteps limits the computation of the script for one object, 0 for no limit
+	MaxSteps uint64 `json:"max_steps"`
+}
+
+// Patcher calls the patch function of a script.
+type Patcher struct {
+	path     string
+	maxSteps uint64
+	patch    starlark.Callable
+}
+
+// Load runs the script at path, which must define a patch function.
+func Load(path string, maxSteps uint64) (*Patcher, error) {
+	p := &Patcher{path: path, maxSteps: maxSteps}
+
+	globals, err := starlark.ExecFile(p.newThread(), path, nil, builtins)
+	if err != nil {
+		return nil, p.scriptError(err)
+	}
+	globals.Freeze()
+
+	patch, ok := globals["patch"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s does not define a patch function", path)
+	}
+	p.patch = patch
+
+	return p, nil
+}
+
+func (p *Patcher) PatchRaw(ctx context.Context, _ config.Config, objType string, doc map[string]any) (bool, error) {
+	obj, err := toStarlark(doc)
+	if err != nil {
+		return false, fmt.Errorf("failed to convert object, err: %w", err)
+	}
+
+	objCtx := starlark.StringDict{
+		"type": starlark.String(objType),
+		"org":  starlark.None,
+		"id":   starlark.None,
+	}
+	if ref, ok := migrate.ObjectRefFromContext(ctx); ok {
+		objCtx["org"], objCtx["id"] = starlark.MakeInt(ref.OrgID), starlark.String(ref.ID)
+	}
+
+	thread := p.newThread()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	res, err := starlark.Call(thread, p.patch, starlark.Tuple{obj, starlarkstruct.FromStringDict(starlarkstruct.Default, objCtx)}, nil)
+	if err != nil {
+		return false, p.scriptError(err)
+	}
+	patched, ok := res.(starlark.Bool)
+	if !ok {
+		return false, fmt.Errorf("script %s: patch must return a bool, got %s", p.path, res.Type())
+	}
+	if !patched {
+		return false, nil
+	}
+
+	converted, err := fromStarlark(obj, doc)
+	if err != nil {
+		return false, fmt.Errorf("script %s: invalid patched object, err: %w", p.path, err)
+	}
+	for key := range doc {
+		delete(doc, key)
+	}
+	for key, value := range converted.(map[string]any) {
+		doc[key] = value
+	}
+	return true, nil
+}
+
+func (p *Patcher) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: p.path,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", p.path, msg)
+		},
+	}
+	if p.maxSteps > 0 {
+		thread.SetMaxExecutionSteps(p.maxSteps)
+	}
+	return thread
+}
+
+// scriptError returns the error of the script, with its Starlark backtrace.
+func (p *Patcher) scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return fmt.Errorf("script %s failed, err: %s", p.path, evalErr.Backtrace())
+	}
+	return fmt.Errorf("script %s failed, err: %w", p.path, err)
+}
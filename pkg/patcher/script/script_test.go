@@ -0,0 +1,240 @@
+package script
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/migrate-tool/pkg/config"
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// loadScript writes the script to a temporary file and loads it.
+func loadScript(t *testing.T, script string, maxSteps uint64) (*Patcher, string, error) {
+	path := filepath.Join(t.TempDir(), "patch.star")
+	if err := os.WriteFile(path, []byte(script), 0o660); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path, maxSteps)
+	return p, path, err
+}
+
+// patchDocument runs the script on the JSON document and returns the resulting document as JSON.
+func patchDocument(t *testing.T, p *Patcher, ctx context.Context, objType, input string) (bool, string, error) {
+	doc, err := migrate.ParseDocument([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := p.PatchRaw(ctx, config.Config{}, objType, doc)
+	got, marshalErr := json.Marshal(doc)
+	if marshalErr != nil {
+		t.Fatal(marshalErr)
+	}
+	return patched, string(got), err
+}
+
+func TestPatchRaw(t *testing.T) {
+	monitor := `{"id":10,"name":"CPU","query":"avg(last_5m):avg:kubernetes_state.pod.ready{env:prod} < 1","options":{"thresholds":{"critical":1.0}},"tags":["env:prod"]}`
+	dashboard := `{"title":"Pods","widgets":[{"definition":{"type":"timeseries","title":"kubernetes_state.pod.ready","requests":[{"q":"sum:kubernetes_state.pod.ready{*}"}]}}]}`
+
+	tests := []struct {
+		name        string
+		script      string
+		objType     string
+		input       string
+		want        string
+		wantPatched bool
+	}{
+		{
+			name: "monitor",
+			script: `
+def patch(obj, ctx):
+    if ctx.type != "monitor":
+        return False
+    obj["query"] = obj["query"].replace("kubernetes_state.pod.ready", "kubernetes_state.pod.status_ready")
+    obj["tags"].append("migrated:%s-%s" % (ctx.org, ctx.id))
+    return True
+`,
+			objType:     migrate.MonitorType,
+			input:       monitor,
+			want:        `{"id":10,"name":"CPU","options":{"thresholds":{"critical":1.0}},"query":"avg(last_5m):avg:kubernetes_state.pod.status_ready{env:prod} < 1","tags":["env:prod","migrated:3000-10"]}`,
+			wantPatched: true,
+		},
+		{
+			name: "dashboard",
+			script: `
+def patch(obj, ctx):
+    def rename(query):
+        return query.replace("pod.ready", "pod.status_ready")
+    obj["title"] = obj["title"] + " (migrated)"
+    return walk_queries(obj, rename)
+`,
+			objType:     migrate.DashboardType,
+			input:       dashboard,
+			want:        `{"title":"Pods (migrated)","widgets":[{"definition":{"requests":[{"q":"sum:kubernetes_state.pod.status_ready{*}"}],"title":"kubernetes_state.pod.ready","type":"timeseries"}}]}`,
+			wantPatched: true,
+		},
+		{
+			name: "changes discarded when not patched",
+			script: `
+def patch(obj, ctx):
+    obj["name"] = "changed"
+    return False
+`,
+			objType: migrate.MonitorType,
+			input:   monitor,
+			want:    monitor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, err := loadScript(t, tt.script, defaultMaxSteps)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ref := migrate.ObjectRef{OrgID: 3000, Type: tt.objType, ID: "10"}
+			patched, got, err := patchDocument(t, p, migrate.WithObjectRef(context.Background(), ref), tt.objType, tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patched != tt.wantPatched {
+				t.Errorf("got patched %v", patched)
+			}
+
+			want, err := migrate.ParseDocument([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantJSON, _ := json.Marshal(want)
+			if got != string(wantJSON) {
+				t.Errorf("got %s, want %s", got, wantJSON)
+			}
+		})
+	}
+}
+
+func TestPatchRawErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		maxSteps uint64
+		timeout  time.Duration
+		wantErr  []string
+	}{
+		{
+			name: "runtime error",
+			script: `
+def patch(obj, ctx):
+    return check(obj)
+
+def check(obj):
+    return obj["missing"] == 1
+`,
+			wantErr: []string{"patch.star failed", `key "missing" not in dict`, "in check", "in patch"},
+		},
+		{
+			name: "fail",
+			script: `
+def patch(obj, ctx):
+    fail("unsupported monitor", obj["name"])
+`,
+			wantErr: []string{"patch.star failed", "unsupported monitor a"},
+		},
+		{
+			name: "not a bool",
+			script: `
+def patch(obj, ctx):
+    return obj
+`,
+			wantErr: []string{"patch must return a bool, got dict"},
+		},
+		{
+			name: "invalid patched object",
+			script: `
+def patch(obj, ctx):
+    obj["name"] = len
+    return True
+`,
+			wantErr: []string{"invalid patched object"},
+		},
+		{
+			name: "too many steps",
+			script: `
+def patch(obj, ctx):
+    for i in range(1000000):
+        pass
+    return False
+`,
+			maxSteps: 1000,
+			wantErr:  []string{"patch.star failed", "too many steps"},
+		},
+		{
+			name: "timeout",
+			script: `
+def patch(obj, ctx):
+    for i in range(1000000000):
+        pass
+    return False
+`,
+			timeout: 50 * time.Millisecond,
+			wantErr: []string{"patch.star failed", "context deadline exceeded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, err := loadScript(t, tt.script, tt.maxSteps)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			input := `{"name":"a"}`
+			patched, got, err := patchDocument(t, p, ctx, migrate.MonitorType, input)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got error %q, want %q", err, want)
+				}
+			}
+			if patched || got != input {
+				t.Errorf("got patched %v, %s", patched, got)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{name: "syntax error", script: "def patch(obj, ctx)\n    return True\n", wantErr: "got newline, want ':'"},
+		{name: "no patch function", script: "patch = 1\n", wantErr: "does not define a patch function"},
+		{name: "error at load", script: "x = 1 // 0\n", wantErr: "division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, path, err := loadScript(t, tt.script, defaultMaxSteps)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), path) {
+				t.Fatalf("got error %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
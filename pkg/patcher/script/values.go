@@ -0,0 +1,148 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"go.starlark.net/starlark"
+)
+
+// toStarlark converts a raw document value to a Starlark value. Objects become dicts and arrays lists.
+func toStarlark(v any) (starlark.Value, error) {
+	switch value := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(value), nil
+	case string:
+		return starlark.String(value), nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		if i, ok := new(big.Int).SetString(value.String(), 10); ok {
+			return starlark.MakeBigInt(i), nil
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s, err: %w", value, err)
+		}
+		return starlark.Float(f), nil
+	case float64:
+		return starlark.Float(value), nil
+	case []any:
+		elems := make([]starlark.Value, 0, len(value))
+		for _, elem := range value {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, converted)
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		dict := starlark.NewDict(len(value))
+		for _, key := range keys {
+			converted, err := toStarlark(value[key])
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// fromStarlark converts a Starlark value back to a raw document value, with numbers as json.Number.
+// Values are matched with the original ones at the same path: numbers left unchanged by the script keep
+// their original text, so that 1.0 or 0.00001 are not rewritten as 1 or 1e-05.
+func fromStarlark(v starlark.Value, original any) (any, error) {
+	switch value := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(value), nil
+	case starlark.String:
+		return string(value), nil
+	case starlark.Int:
+		return keepNumber(json.Number(value.String()), original), nil
+	case starlark.Float:
+		f := float64(value)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("invalid number %s", value)
+		}
+		return keepNumber(json.Number(strconv.FormatFloat(f, 'g', -1, 64)), original), nil
+	case starlark.Indexable:
+		// Lists and tuples
+		originalElems, _ := original.([]any)
+		elems := make([]any, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			var originalElem any
+			if i < len(originalElems) {
+				originalElem = originalElems[i]
+			}
+			converted, err := fromStarlark(value.Index(i), originalElem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, converted)
+		}
+		return elems, nil
+	case *starlark.Dict:
+		originalObj, _ := original.(map[string]any)
+		obj := make(map[string]any, value.Len())
+		for _, item := range value.Items() {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %s: not a string", item[0])
+			}
+			converted, err := fromStarlark(item[1], originalObj[key])
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = converted
+		}
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", v.Type())
+	}
+}
+
+// keepNumber returns the original number when it has the same value as the converted one.
+func keepNumber(converted json.Number, original any) json.Number {
+	originalNumber, ok := original.(json.Number)
+	if !ok || originalNumber == converted {
+		return converted
+	}
+
+	// Integers are compared exactly, as big integers do not fit in a float
+	a, aInt := new(big.Int).SetString(originalNumber.String(), 10)
+	b, bInt := new(big.Int).SetString(converted.String(), 10)
+	if aInt && bInt {
+		if a.Cmp(b) == 0 {
+			return originalNumber
+		}
+		return converted
+	}
+
+	aFloat, aErr := originalNumber.Float64()
+	bFloat, bErr := converted.Float64()
+	if aErr != nil || bErr != nil || aFloat != bFloat {
+		return converted
+	}
+	return originalNumber
+}
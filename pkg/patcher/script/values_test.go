@@ -0,0 +1,77 @@
+package script
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestValuesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		script func(*starlark.Dict) error
+		want   string
+	}{
+		{
+			name:  "unchanged numbers keep their text",
+			input: `{"a":1.0,"b":0.00001,"c":1e3,"d":[2.50,12345678901234567890],"e":{"f":-0.0}}`,
+			want:  `{"a":1.0,"b":0.00001,"c":1e3,"d":[2.50,12345678901234567890],"e":{"f":-0.0}}`,
+		},
+		{
+			name:  "changed numbers are formatted",
+			input: `{"a":1.0,"b":12345678901234567890}`,
+			script: func(obj *starlark.Dict) error {
+				if err := obj.SetKey(starlark.String("a"), starlark.Float(1.5)); err != nil {
+					return err
+				}
+				return obj.SetKey(starlark.String("b"), starlark.MakeUint64(12345678901234567891))
+			},
+			want: `{"a":1.5,"b":12345678901234567891}`,
+		},
+		{
+			name:  "new values",
+			input: `{"a":[1.0]}`,
+			script: func(obj *starlark.Dict) error {
+				return obj.SetKey(starlark.String("a"), starlark.NewList([]starlark.Value{starlark.Float(1), starlark.Float(0.00001), starlark.None}))
+			},
+			want: `{"a":[1.0,1e-05,null]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := migrate.ParseDocument([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obj, err := toStarlark(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.script != nil {
+				if err := tt.script(obj.(*starlark.Dict)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := fromStarlark(obj, doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := migrate.ParseDocument([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("got %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package widgets walks the metric queries of dashboard widgets, for patchers rewriting queries.
+package widgets
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+// QueryFunc patches a metric query. It returns the patched query, empty if unchanged, and whether the
+// query is relevant to the patcher: template variables referenced by relevant queries are tracked.
+type QueryFunc func(query string) (patched string, relevant bool, err error)
+
+var variableReferenceRegexp = regexp.MustCompile(`\$[a-zA-Z0-9_-]+`)
+
+// VariableReferences returns the names of the template variables referenced by the query.
+func VariableReferences(query string) []string {
+	matches := variableReferenceRegexp.FindAllString(query, -1)
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match[1:])
+	}
+	return names
+}
+
+// RenameVariableReferences renames the template variables referenced by the query.
+// It returns an empty string if the query is unchanged.
+func RenameVariableReferences(query string, names map[string]string) string {
+	patched := variableReferenceRegexp.ReplaceAllStringFunc(query, func(match string) string {
+		if newName, found := names[match[1:]]; found {
+			return "$" + newName
+		}
+		return match
+	})
+	if patched == query {
+		return ""
+	}
+	return patched
+}
+
+// queryKeys are the keys of the widget fields holding queries, which can reference template variables:
+// metric and formula queries, legacy log and APM searches, and the scopes of widgets such as check status.
+var queryKeys = map[string]struct{}{
+	"q":            {},
+	"query":        {},
+	"query_string": {},
+	"filter_by":    {},
+	"tags":         {},
+}
+
+// RenameVariables renames the template variables of the dashboard, their presets and their references
+// in the queries of all widget types. Titles, notes and links are left unchanged.
+func RenameVariables(dashboard *datadogV1.Dashboard, names map[string]string) (bool, error) {
+	patched := false
+
+	doc, err := decode(dashboard.Widgets)
+	if err != nil {
+		return false, err
+	}
+	if renameReferences(doc, false, names) {
+		renamed := []datadogV1.Widget{}
+		if err := encode(doc, &renamed); err != nil {
+			return false, err
+		}
+		dashboard.Widgets = renamed
+		patched = true
+	}
+
+	for varIndex := range dashboard.TemplateVariables {
+		variable := &dashboard.TemplateVariables[varIndex]
+		if newName, found := names[variable.Name]; found {
+			variable.Name = newName
+			patched = true
+		}
+	}
+
+	for presetIndex := range dashboard.TemplateVariablePresets {
+		preset := &dashboard.TemplateVariablePresets[presetIndex]
+		for valueIndex := range preset.TemplateVariables {
+			presetValue := &preset.TemplateVariables[valueIndex]
+			if presetValue.Name == nil {
+				continue
+			}
+			if newName, found := names[*presetValue.Name]; found {
+				presetValue.Name = &newName
+				patched = true
+			}
+		}
+	}
+
+	return patched, nil
+}
+
+// renameReferences renames the references in the query fields of the value, in place.
+// inQuery is set for the values of query fields.
+func renameReferences(value any, inQuery bool, names map[string]string) bool {
+	patched := false
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			_, isQuery := queryKeys[key]
+			if renamed, ok := child.(string); ok && isQuery {
+				if renamed = RenameVariableReferences(renamed, names); renamed != "" {
+					v[key] = renamed
+					patched = true
+				}
+				continue
+			}
+			patched = renameReferences(child, isQuery, names) || patched
+		}
+	case []any:
+		for i, child := range v {
+			if renamed, ok := child.(string); ok && inQuery {
+				if renamed = RenameVariableReferences(renamed, names); renamed != "" {
+					v[i] = renamed
+					patched = true
+				}
+				continue
+			}
+			patched = renameReferences(child, inQuery, names) || patched
+		}
+	}
+	return patched
+}
+
+// PatchQueries applies fn to the metric queries of the widgets: the q field of their requests and their
+// metric formula queries, for all widget types. Widgets of groups, powerpacks and split graphs are included.
+// The template variables referenced by relevant queries are added to usedVariables.
+func PatchQueries(widgets []datadogV1.Widget, fn QueryFunc, usedVariables map[string]struct{}) (bool, error) {
+	doc, err := decode(widgets)
+	if err != nil {
+		return false, err
+	}
+
+	patched, err := patchWidgets(doc, fn, usedVariables)
+	if err != nil || !patched {
+		return false, err
+	}
+
+	res := make([]datadogV1.Widget, 0, len(widgets))
+	if err := encode(doc, &res); err != nil {
+		return false, err
+	}
+	copy(widgets, res)
+	return true, nil
+}
+
+func patchWidgets(widgets any, fn QueryFunc, usedVariables map[string]struct{}) (bool, error) {
+	list, _ := widgets.([]any)
+	widgetsPatched := false
+
+	for _, item := range list {
+		widget, _ := item.(map[string]any)
+		patched, err := patchDefinition(widget["definition"], fn, usedVariables)
+		if err != nil {
+			return false, err
+		}
+		widgetsPatched = widgetsPatched || patched
+	}
+
+	return widgetsPatched, nil
+}
+
+func patchDefinition(value any, fn QueryFunc, usedVariables map[string]struct{}) (bool, error) {
+	definition, ok := value.(map[string]any)
+	if !ok {
+		return false, nil
+	}
+	definitionPatched := false
+
+	// Requests are a list, or a map for widgets such as scatter plots and host maps
+	requests := []any{}
+	switch v := definition["requests"].(type) {
+	case []any:
+		requests = v
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			requests = append(requests, v[key])
+		}
+	}
+	for _, item := range requests {
+		request, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		patched, err := patchRequest(request, fn, usedVariables)
+		if err != nil {
+			return false, err
+		}
+		definitionPatched = definitionPatched || patched
+	}
+
+	// Groups and powerpacks have widgets, split graphs a source widget
+	patched, err := patchWidgets(definition["widgets"], fn, usedVariables)
+	if err != nil {
+		return false, err
+	}
+	definitionPatched = definitionPatched || patched
+
+	patched, err = patchDefinition(definition["source_widget_definition"], fn, usedVariables)
+	if err != nil {
+		return false, err
+	}
+
+	return definitionPatched || patched, nil
+}
+
+func patchRequest(request map[string]any, fn QueryFunc, usedVariables map[string]struct{}) (bool, error) {
+	requestPatched := false
+
+	if q, ok := request["q"].(string); ok {
+		patched, err := patchQuery(q, fn, usedVariables)
+		if err != nil {
+			return false, err
+		}
+
+		if patched != "" {
+			requestPatched = true
+			request["q"] = patched
+		}
+	}
+
+	queries, _ := request["queries"].([]any)
+	for _, item := range queries {
+		query, ok := item.(map[string]any)
+		if !ok || query["data_source"] != "metrics" {
+			continue
+		}
+		q, ok := query["query"].(string)
+		if !ok {
+			continue
+		}
+
+		patched, err := patchQuery(q, fn, usedVariables)
+		if err != nil {
+			return false, err
+		}
+
+		if patched != "" {
+			requestPatched = true
+			query["query"] = patched
+		}
+	}
+
+	return requestPatched, nil
+}
+
+func patchQuery(query string, fn QueryFunc, usedVariables map[string]struct{}) (string, error) {
+	patched, relevant, err := fn(query)
+
+	// Tracking template variables used by relevant queries
+	if relevant && usedVariables != nil {
+		for _, name := range VariableReferences(query) {
+			usedVariables[name] = struct{}{}
+		}
+	}
+
+	return patched, err
+}
+
+// PatchVariablePrefixes changes the prefix (tag key) of the used template variables with the mapping.
+func PatchVariablePrefixes(dashboard *datadogV1.Dashboard, usedVariables map[string]struct{}, mapping map[string]string) bool {
+	patched := false
+
+	for varIndex := range dashboard.TemplateVariables {
+		variable := &dashboard.TemplateVariables[varIndex]
+
+		currentPrefix := variable.Prefix.Get()
+		if _, found := usedVariables[variable.Name]; found && currentPrefix != nil {
+			if newVal, found := mapping[*currentPrefix]; found {
+				variable.Prefix.Set(&newVal)
+				patched = true
+			}
+		}
+	}
+
+	return patched
+}
+
+// decode returns the raw JSON document of the typed value.
+func decode(v any) (any, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal widgets, err: %w", err)
+	}
+	doc, err := migrate.DecodeJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode widgets, err: %w", err)
+	}
+	return doc, nil
+}
+
+// encode converts the raw JSON document back to the typed value.
+func encode(doc any, v any) error {
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal widgets, err: %w", err)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("failed to unmarshal widgets, err: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package widgets
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+
+	"github.com/DataDog/migrate-tool/pkg/migrate"
+)
+
+func TestPatchQueries(t *testing.T) {
+	// Renames metric a to b, in relevant queries referencing it
+	renameMetric := func(query string) (string, bool, error) {
+		if !strings.Contains(query, ":a{") {
+			return "", false, nil
+		}
+		return strings.ReplaceAll(query, ":a{", ":b{"), true, nil
+	}
+
+	tests := []struct {
+		name        string
+		input       string
+		want        string
+		wantPatched bool
+		wantUsed    []string
+	}{
+		{
+			name: "widget types",
+			input: `[
+				{"definition": {"type": "timeseries", "requests": [{"q": "avg:a{$env}", "display_type": "line"}]}},
+				{"definition": {"type": "query_table", "requests": [{"queries": [{"data_source": "metrics", "name": "q1", "query": "avg:a{*} by {host}"}], "response_format": "scalar"}]}},
+				{"definition": {"type": "change", "requests": [{"q": "avg:a{$cluster}"}]}},
+				{"definition": {"type": "distribution", "requests": [{"q": "avg:a{*} by {host}"}]}},
+				{"definition": {"type": "heatmap", "requests": [{"q": "avg:a{*}"}]}},
+				{"definition": {"type": "scatterplot", "requests": {"x": {"q": "avg:a{*} by {host}"}, "y": {"q": "avg:c{$zone} by {host}"}}}},
+				{"definition": {"type": "hostmap", "requests": {"fill": {"q": "avg:a{*} by {host}"}}}},
+				{"definition": {"type": "group", "layout_type": "ordered", "widgets": [
+					{"definition": {"type": "toplist", "requests": [{"q": "top(avg:a{*} by {host}, 10, 'mean', 'desc')"}]}}
+				]}},
+				{"definition": {"type": "sunburst", "requests": [{"queries": [{"data_source": "logs", "name": "q1", "search": {"query": "service:a"}, "compute": {"aggregation": "count"}}]}]}}
+			]`,
+			want: `[
+				{"definition": {"type": "timeseries", "requests": [{"q": "avg:b{$env}", "display_type": "line"}]}},
+				{"definition": {"type": "query_table", "requests": [{"queries": [{"data_source": "metrics", "name": "q1", "query": "avg:b{*} by {host}"}], "response_format": "scalar"}]}},
+				{"definition": {"type": "change", "requests": [{"q": "avg:b{$cluster}"}]}},
+				{"definition": {"type": "distribution", "requests": [{"q": "avg:b{*} by {host}"}]}},
+				{"definition": {"type": "heatmap", "requests": [{"q": "avg:b{*}"}]}},
+				{"definition": {"type": "scatterplot", "requests": {"x": {"q": "avg:b{*} by {host}"}, "y": {"q": "avg:c{$zone} by {host}"}}}},
+				{"definition": {"type": "hostmap", "requests": {"fill": {"q": "avg:b{*} by {host}"}}}},
+				{"definition": {"type": "group", "layout_type": "ordered", "widgets": [
+					{"definition": {"type": "toplist", "requests": [{"q": "top(avg:b{*} by {host}, 10, 'mean', 'desc')"}]}}
+				]}},
+				{"definition": {"type": "sunburst", "requests": [{"queries": [{"data_source": "logs", "name": "q1", "search": {"query": "service:a"}, "compute": {"aggregation": "count"}}]}]}}
+			]`,
+			wantPatched: true,
+			wantUsed:    []string{"cluster", "env"},
+		},
+		{
+			name:     "unchanged",
+			input:    `[{"definition": {"type": "timeseries", "requests": [{"q": "avg:c{$env}"}]}}, {"definition": {"type": "note", "content": "avg:a{*}"}}]`,
+			want:     `[{"definition": {"type": "timeseries", "requests": [{"q": "avg:c{$env}"}]}}, {"definition": {"type": "note", "content": "avg:a{*}"}}]`,
+			wantUsed: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			widgets := []datadogV1.Widget{}
+			if err := json.Unmarshal([]byte(tt.input), &widgets); err != nil {
+				t.Fatal(err)
+			}
+
+			used := map[string]struct{}{}
+			patched, err := PatchQueries(widgets, renameMetric, used)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patched != tt.wantPatched {
+				t.Errorf("got patched %v", patched)
+			}
+			assertJSON(t, widgets, tt.want)
+
+			gotUsed := []string{}
+			for _, name := range []string{"cluster", "env", "zone"} {
+				if _, found := used[name]; found {
+					gotUsed = append(gotUsed, name)
+				}
+			}
+			if !reflect.DeepEqual(gotUsed, tt.wantUsed) {
+				t.Errorf("got used variables %v, want %v", gotUsed, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestRenameVariables(t *testing.T) {
+	input := `{
+		"title": "Pods in $env",
+		"description": "Filtered on $env",
+		"layout_type": "ordered",
+		"template_variables": [{"name": "env", "prefix": "env"}, {"name": "cluster", "prefix": "cluster"}],
+		"template_variable_presets": [{"name": "prod", "template_variables": [{"name": "env", "value": "prod"}]}],
+		"widgets": [
+			{"definition": {"type": "timeseries", "title": "CPU in $env", "requests": [{"q": "avg:a{$env,$cluster}"}]}},
+			{"definition": {"type": "query_table", "requests": [{"queries": [{"data_source": "logs", "name": "q1", "search": {"query": "env:$env"}, "compute": {"aggregation": "count"}}], "response_format": "scalar"}]}},
+			{"definition": {"type": "note", "content": "Filtered on $env"}},
+			{"definition": {"type": "check_status", "check": "kubernetes.up", "grouping": "cluster", "tags": ["$env"]}}
+		]
+	}`
+	want := `{
+		"title": "Pods in $env",
+		"description": "Filtered on $env",
+		"layout_type": "ordered",
+		"template_variables": [{"name": "environment", "prefix": "env"}, {"name": "cluster", "prefix": "cluster"}],
+		"template_variable_presets": [{"name": "prod", "template_variables": [{"name": "environment", "value": "prod"}]}],
+		"widgets": [
+			{"definition": {"type": "timeseries", "title": "CPU in $env", "requests": [{"q": "avg:a{$environment,$cluster}"}]}},
+			{"definition": {"type": "query_table", "requests": [{"queries": [{"data_source": "logs", "name": "q1", "search": {"query": "env:$environment"}, "compute": {"aggregation": "count"}}], "response_format": "scalar"}]}},
+			{"definition": {"type": "note", "content": "Filtered on $env"}},
+			{"definition": {"type": "check_status", "check": "kubernetes.up", "grouping": "cluster", "tags": ["$environment"]}}
+		]
+	}`
+
+	dashboard := datadogV1.Dashboard{}
+	if err := json.Unmarshal([]byte(input), &dashboard); err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := RenameVariables(&dashboard, map[string]string{"env": "environment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patched {
+		t.Error("got not patched")
+	}
+	assertJSON(t, dashboard, want)
+
+	patched, err = RenameVariables(&dashboard, map[string]string{"zone": "region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched {
+		t.Error("got patched without references")
+	}
+}
+
+// assertJSON checks that the value is marshaled to the wanted JSON document.
+func assertJSON(t *testing.T, v any, want string) {
+	t.Helper()
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := migrate.DecodeJSON(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDoc, err := migrate.DecodeJSON([]byte(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantDoc) {
+		t.Errorf("got %s, want %s", content, want)
+	}
+}